@@ -3,95 +3,442 @@
 package ansi
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-// Simple ANSI decoder. Only working on a subset of ANSI codes relevant for
-// usage inside the editor program. For example, arrow keys, home key, and more
-// are supported, but colour codes are not.
-// 
+// ANSI/xterm input decoder. It decodes the keys that terminals send as escape
+// sequences, such as arrow and function keys with modifiers, including the
+// kitty keyboard protocol and xterm's modifyOtherKeys, bracketed paste, SGR
+// mouse events and the replies to queries about the terminal.
+//
 // Will only decode the keys defined in the Key type in this package
 type Decoder struct {
-	rd *bufio.Reader
-	// The last rune processed in the escape sequence
-	state rune
+	// How long to wait for the rest of an escape sequence. The Escape key is
+	// sent on its own so if nothing follows it by then it was pressed on its
+	// own, rather than as the start of a sequence or with Alt.
+	EscapeTimeout time.Duration
+
+	chunks chan chunk
+	// Input that has been read but not decoded yet
+	buf []byte
+	err error
+
+	// The text of the last PasteKey
+	paste string
+	// The event of the last MouseKey
+	mouse Mouse
+	// The reply of the last ReplyKey
+	reply Reply
+	// Set while the terminal has queries to reply to, see ExpectReplies
+	expecting int32
 }
 
+// DefaultEscapeTimeout is long enough for a sequence to arrive over a slow
+// connection, while short enough that Escape doesn't feel slow
+const DefaultEscapeTimeout = 50 * time.Millisecond
+
 var ErrInvalidEscape = errors.New("invalid escape code")
 
-func NewDecoder(r io.Reader) Decoder {
-	return Decoder{
-		rd: bufio.NewReader(r),
+type chunk struct {
+	b   []byte
+	err error
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{
+		EscapeTimeout: DefaultEscapeTimeout,
+		chunks:        make(chan chunk),
 	}
+	go d.read(r)
+	return d
 }
 
-func (d *Decoder) Decode() (Key, error) {
+// read sends the input to Decode, which lets it stop waiting for the rest of
+// an escape sequence
+func (d *Decoder) read(r io.Reader) {
 	for {
-		ru, n, err := d.rd.ReadRune()
+		b := make([]byte, 256)
+		n, err := r.Read(b)
+		if n > 0 {
+			d.chunks <- chunk{b: b[:n]}
+		}
 		if err != nil {
-			return 0, err
+			d.chunks <- chunk{err: err}
+			return
 		}
-		if n == 0 {
-			continue
+	}
+}
+
+// fill adds more input to buf. When timeout is set it gives up after
+// EscapeTimeout. It returns false if nothing was added.
+func (d *Decoder) fill(timeout bool) bool {
+	if d.err != nil {
+		return false
+	}
+
+	var c chunk
+	if timeout {
+		t := time.NewTimer(d.EscapeTimeout)
+		defer t.Stop()
+
+		select {
+		case c = <-d.chunks:
+		case <-t.C:
+			return false
 		}
+	} else {
+		c = <-d.chunks
+	}
 
-		switch d.state {
-		case 0:
-			// hot path: normal character input
-			if ru != rune(EscapeKey) {
-				return Key(ru), nil
-			} else {
-				d.state = ru
-			}
-		case rune(EscapeKey):
-			if ru == '[' {
-				d.state = ru
-			} else {
-				return 0, ErrInvalidEscape
-			}
-		case '[':
-			d.state = 0
-
-			switch ru {
-			case 'A':
-				return UpArrowKey, nil
-			case 'B':
-				return DownArrowKey, nil
-			case 'C':
-				return RightArrowKey, nil
-			case 'D':
-				return LeftArrowKey, nil
-			case 'F':
-				return EndKey, nil
-			case 'H':
-				return HomeKey, nil
-			case '1', '2', '3', '4', '5', '6', '7', '8':
-				d.state = ru
-			default:
-				return 0, ErrInvalidEscape
-			}
-		case '1', '2', '3', '4', '5', '6', '7', '8':
-			state := d.state
-			d.state = 0
+	if c.err != nil {
+		d.err = c.err
+		return false
+	}
+	d.buf = append(d.buf, c.b...)
+	return true
+}
+
+// need waits for buf to have n bytes, it returns false if they don't arrive
+// in time
+func (d *Decoder) need(n int) bool {
+	for len(d.buf) < n {
+		if !d.fill(true) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Decoder) Decode() (Key, error) {
+	for len(d.buf) == 0 {
+		if !d.fill(false) {
+			return 0, d.err
+		}
+	}
+
+	// hot path: normal character input
+	if d.buf[0] != byte(EscapeKey) {
+		return d.decodeRune(), nil
+	}
+
+	if !d.need(2) {
+		d.buf = d.buf[1:]
+		return EscapeKey, nil
+	}
+
+	switch d.buf[1] {
+	case '[':
+		return d.decodeCSI()
+	case 'O':
+		return d.decodeSS3()
+	case 'P', ']':
+		if k, ok, err := d.decodeString(); ok {
+			return k, err
+		}
+	case byte(EscapeKey):
+		// Escape pressed twice, the second may start a sequence
+		d.buf = d.buf[1:]
+		return EscapeKey, nil
+	}
+
+	// Terminals send Alt+key as Escape followed by the key
+	d.buf = d.buf[1:]
+	return d.decodeRune() | ModAlt, nil
+}
+
+func (d *Decoder) decodeRune() Key {
+	for !utf8.FullRune(d.buf) && d.fill(true) {
+	}
+
+	r, n := utf8.DecodeRune(d.buf)
+	d.buf = d.buf[n:]
+	return Key(r)
+}
+
+// csi is a Control Sequence Introducer sequence: ESC [, the parameters, the
+// intermediate bytes and the final byte
+type csi struct {
+	// private marker such as '<', '>' or '?' before the parameters
+	marker byte
+	// The parameters are separated by ';' and can have sub-parameters
+	// separated by ':'. Missing ones are -1.
+	params       [][]int
+	intermediate string
+	final        byte
+}
+
+// param returns the sub-parameter of the i'th parameter, or def if it is
+// missing
+func (c csi) param(i, sub, def int) int {
+	if i >= len(c.params) || sub >= len(c.params[i]) || c.params[i][sub] == -1 {
+		return def
+	}
+	return c.params[i][sub]
+}
+
+func (d *Decoder) decodeCSI() (Key, error) {
+	// ESC [ on its own is Alt+[
+	if !d.need(3) {
+		d.buf = d.buf[1:]
+		return d.decodeRune() | ModAlt, nil
+	}
+
+	i := 2
+	for {
+		if i == len(d.buf) && !d.fill(true) {
+			d.buf = d.buf[i:]
+			return 0, ErrInvalidEscape
+		}
+
+		c := d.buf[i]
+		i++
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+		if c < 0x20 || c > 0x3f {
+			d.buf = d.buf[i:]
+			return 0, ErrInvalidEscape
+		}
+	}
+
+	seq, ok := parseCSI(string(d.buf[2:i]))
+	d.buf = d.buf[i:]
+	if !ok {
+		return 0, ErrInvalidEscape
+	}
+
+	if seq.final == '~' && seq.param(0, 0, 0) == 200 && len(seq.params) == 1 {
+		return d.decodePaste(), nil
+	}
+
+	if m, ok := seq.sgrMouse(); ok {
+		d.mouse = m
+		return MouseKey, nil
+	}
 
-			if ru != '~' {
-				return 0, ErrInvalidEscape
+	if k, ok := seq.key(); ok {
+		return k, nil
+	}
+
+	r, ok := seq.reply()
+	if !ok {
+		return 0, ErrInvalidEscape
+	}
+	d.reply = r
+	return ReplyKey, nil
+}
+
+// Bracketed paste surrounds pasted text with ESC [ 200 ~ and ESC [ 201 ~ so
+// that it isn't taken as typed keys
+var pasteEnd = []byte("\x1b[201~")
+
+// decodePaste reads the pasted text up to the end of the paste
+func (d *Decoder) decodePaste() Key {
+	searched := 0
+	for {
+		if i := bytes.Index(d.buf[searched:], pasteEnd); i != -1 {
+			d.paste = string(d.buf[:searched+i])
+			d.buf = d.buf[searched+i+len(pasteEnd):]
+			return PasteKey
+		}
+
+		// The end may have been cut off by the end of the input read so far
+		searched = len(d.buf) - len(pasteEnd) + 1
+		if searched < 0 {
+			searched = 0
+		}
+
+		if !d.fill(false) {
+			// The input ended before the paste did
+			d.paste = string(d.buf)
+			d.buf = nil
+			return PasteKey
+		}
+	}
+}
+
+// Paste returns the text that was pasted when Decode returned PasteKey
+func (d *Decoder) Paste() string {
+	return d.paste
+}
+
+// Mouse returns the mouse event when Decode returned MouseKey
+func (d *Decoder) Mouse() Mouse {
+	return d.mouse
+}
+
+// parseCSI parses the sequence after ESC [
+func parseCSI(s string) (csi, bool) {
+	var c csi
+
+	c.final = s[len(s)-1]
+	s = s[:len(s)-1]
+
+	end := strings.IndexFunc(s, func(r rune) bool { return r < 0x30 })
+	if end != -1 {
+		c.intermediate = s[end:]
+		s = s[:end]
+	}
+	if strings.IndexFunc(c.intermediate, func(r rune) bool { return r >= 0x30 }) != -1 {
+		// Parameters after intermediate bytes
+		return c, false
+	}
+
+	if len(s) != 0 && strings.IndexByte("<=>?", s[0]) != -1 {
+		c.marker = s[0]
+		s = s[1:]
+	}
+	if len(s) == 0 {
+		return c, true
+	}
+
+	for _, param := range strings.Split(s, ";") {
+		var subs []int
+		for _, sub := range strings.Split(param, ":") {
+			if len(sub) == 0 {
+				subs = append(subs, -1)
+				continue
 			}
 
-			switch state {
-			case '1', '7':
-				return HomeKey, nil
-			case '3':
-				return DeleteKey, nil
-			case '4', '8':
-				return EndKey, nil
-			case '5':
-				return PageUpKey, nil
-			case '6':
-				return PageDownKey, nil
+			n, err := strconv.Atoi(sub)
+			if err != nil {
+				return c, false
 			}
+			subs = append(subs, n)
 		}
+		c.params = append(c.params, subs)
+	}
+	return c, true
+}
+
+// The keys sent as ESC [ <final>, or ESC O <final>, with the modifiers in the
+// second parameter
+var finalKeys = map[byte]Key{
+	'A': UpArrowKey,
+	'B': DownArrowKey,
+	'C': RightArrowKey,
+	'D': LeftArrowKey,
+	'F': EndKey,
+	'H': HomeKey,
+	'P': F1Key,
+	'Q': F2Key,
+	'R': F3Key,
+	'S': F4Key,
+}
+
+// The keys sent as ESC [ <number> ~
+var tildeKeys = map[int]Key{
+	1:  HomeKey,
+	2:  InsertKey,
+	3:  DeleteKey,
+	4:  EndKey,
+	5:  PageUpKey,
+	6:  PageDownKey,
+	7:  HomeKey,
+	8:  EndKey,
+	11: F1Key,
+	12: F2Key,
+	13: F3Key,
+	14: F4Key,
+	15: F5Key,
+	17: F6Key,
+	18: F7Key,
+	19: F8Key,
+	20: F9Key,
+	21: F10Key,
+	23: F11Key,
+	24: F12Key,
+}
+
+func (c csi) key() (Key, bool) {
+	if c.marker != 0 || len(c.intermediate) != 0 {
+		return 0, false
+	}
+
+	switch c.final {
+	case 'Z':
+		return TabKey | ModShift, true
+	case '~':
+		// xterm's modifyOtherKeys: ESC [ 27 ; <modifiers> ; <code> ~
+		if c.param(0, 0, 0) == 27 {
+			return textKey(Key(c.param(2, 0, 0)), modifiers(c.param(1, 0, 1))), true
+		}
+
+		k, ok := tildeKeys[c.param(0, 0, 0)]
+		return k | modifiers(c.param(1, 0, 1)), ok
+	case 'u':
+		// kitty keyboard protocol: ESC [ <code> ; <modifiers> u
+		return textKey(Key(c.param(0, 0, 0)), modifiers(c.param(1, 0, 1))), true
+	}
+
+	k, ok := finalKeys[c.final]
+	return k | modifiers(c.param(1, 0, 1)), ok
+}
+
+func (d *Decoder) decodeSS3() (Key, error) {
+	// ESC O on its own is Alt+O
+	if !d.need(3) {
+		d.buf = d.buf[1:]
+		return d.decodeRune() | ModAlt, nil
+	}
+
+	k, ok := finalKeys[d.buf[2]]
+	d.buf = d.buf[3:]
+	if !ok {
+		return 0, ErrInvalidEscape
+	}
+	return k, nil
+}
+
+// modifiers returns the modifier bits of the parameter that terminals use for
+// them, which is one more than a bit mask
+func modifiers(param int) Key {
+	bits := param - 1
+
+	var mods Key
+	if bits&1 != 0 {
+		mods |= ModShift
+	}
+	// Meta is the same as Alt for us
+	if bits&(2|32) != 0 {
+		mods |= ModAlt
+	}
+	if bits&4 != 0 {
+		mods |= ModCtrl
+	}
+	if bits&8 != 0 {
+		mods |= ModSuper
+	}
+	return mods
+}
+
+// textKey returns the key for a rune sent with modifiers, in the way
+// terminals send it without them where possible. Ctrl+a is Ctrl('a') and
+// Shift+a is 'A'.
+func textKey(k Key, mods Key) Key {
+	if k < 0 || k > unicode.MaxRune {
+		return k | mods
+	}
+
+	if mods&ModCtrl != 0 {
+		switch {
+		case k >= 'a' && k <= 'z', k >= '@' && k <= '_':
+			k, mods = Ctrl(byte(k)), mods&^ModCtrl
+		case k == ' ':
+			k, mods = Ctrl('@'), mods&^ModCtrl
+		}
+		return k | mods
+	}
+
+	if mods&ModShift != 0 && unicode.IsLower(rune(k)) {
+		k, mods = Key(unicode.ToUpper(rune(k))), mods&^ModShift
 	}
+	return k | mods
 }
@@ -3,6 +3,7 @@ package ansi
 import (
 	"bytes"
 	"io"
+	"reflect"
 	"testing"
 )
 
@@ -79,6 +80,61 @@ func TestDecoder(t *testing.T) {
 			in:       []byte("\x1b[B\x1b[6~"),
 			expected: []Key{DownArrowKey, PageDownKey},
 		},
+		// SS3
+		{
+			in:       []byte("\x1bOA\x1bOD\x1bOH\x1bOP\x1bOS"),
+			expected: []Key{UpArrowKey, LeftArrowKey, HomeKey, F1Key, F4Key},
+		},
+		// Parameters with modifiers
+		{
+			in:       []byte("\x1b[1;5C\x1b[1;2A\x1b[1;3H\x1b[1;8D"),
+			expected: []Key{RightArrowKey | ModCtrl, UpArrowKey | ModShift, HomeKey | ModAlt, LeftArrowKey | ModShift | ModAlt | ModCtrl},
+		},
+		{
+			in:       []byte("\x1b[3;5~\x1b[5;2~\x1b[1;9A\x1b[Z"),
+			expected: []Key{DeleteKey | ModCtrl, PageUpKey | ModShift, UpArrowKey | ModSuper, TabKey | ModShift},
+		},
+		// Function keys
+		{
+			in:       []byte("\x1b[11~\x1b[15~\x1b[17~\x1b[21~\x1b[23~\x1b[24~\x1b[1;5P\x1b[2~"),
+			expected: []Key{F1Key, F5Key, F6Key, F10Key, F11Key, F12Key, F1Key | ModCtrl, InsertKey},
+		},
+		// Alt
+		{
+			in:       []byte("\x1bx\x1bé\x1b\x01\x1b\x7f"),
+			expected: []Key{Key('x') | ModAlt, Key('é') | ModAlt, Ctrl('a') | ModAlt, BackspaceKey | ModAlt},
+		},
+		{
+			in:       []byte("\x1b["),
+			expected: []Key{Key('[') | ModAlt},
+		},
+		{
+			in:       []byte("\x1bO"),
+			expected: []Key{Key('O') | ModAlt},
+		},
+		// Escape on its own
+		{
+			in:       []byte("\x1b"),
+			expected: []Key{EscapeKey},
+		},
+		{
+			in:       []byte("\x1b\x1b\x1b[A"),
+			expected: []Key{EscapeKey, EscapeKey, UpArrowKey},
+		},
+		// kitty keyboard protocol
+		{
+			in:       []byte("\x1b[97;5u\x1b[97;6u\x1b[97;2u\x1b[97;3u\x1b[27u\x1b[13;2u\x1b[105;5u"),
+			expected: []Key{Ctrl('a'), Ctrl('a') | ModShift, Key('A'), Key('a') | ModAlt, EscapeKey, CarriageReturnKey | ModShift, TabKey},
+		},
+		{
+			in:       []byte("\x1b[97:65;6u\x1b[32;5u"),
+			expected: []Key{Ctrl('a') | ModShift, Ctrl('@')},
+		},
+		// modifyOtherKeys
+		{
+			in:       []byte("\x1b[27;5;97~\x1b[27;6;97~\x1b[27;5;13~\x1b[27;3;120~"),
+			expected: []Key{Ctrl('a'), Ctrl('a') | ModShift, CarriageReturnKey | ModCtrl, Key('x') | ModAlt},
+		},
 	} {
 		d := NewDecoder(bytes.NewReader(test.in))
 		for i := 0; i < len(test.expected); i++ {
@@ -98,3 +154,155 @@ func TestDecoder(t *testing.T) {
 		}
 	}
 }
+
+func TestDecoderInvalid(t *testing.T) {
+	for _, in := range []string{
+		"\x1b[9~a",
+		"\x1b[1;2Xa",
+		"\x1b[2Ja",
+		"\x1bOxa",
+		"\x1b[1\x01a",
+	} {
+		d := NewDecoder(bytes.NewReader([]byte(in)))
+		if _, err := d.Decode(); err != ErrInvalidEscape {
+			t.Fatalf("%q: expected ErrInvalidEscape, got: %v", in, err)
+		}
+
+		// The rest of the input is still decoded
+		if k, err := d.Decode(); err != nil || k != Key('a') {
+			t.Fatalf("%q: after invalid escape, expected 'a', got: %v %v", in, k, err)
+		}
+	}
+}
+
+func TestDecoderEscapeTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	d := NewDecoder(r)
+
+	go w.Write([]byte("\x1b"))
+	if k, err := d.Decode(); err != nil || k != EscapeKey {
+		t.Fatalf("expected EscapeKey, got: %v %v", k, err)
+	}
+
+	// The rest of a sequence that arrives in time is part of it
+	go func() {
+		w.Write([]byte("\x1b["))
+		w.Write([]byte("1;5"))
+		w.Write([]byte("A"))
+	}()
+	if k, err := d.Decode(); err != nil || k != UpArrowKey|ModCtrl {
+		t.Fatalf("expected Ctrl+Up, got: %v %v", k, err)
+	}
+}
+
+func TestDecoderPaste(t *testing.T) {
+	r, w := io.Pipe()
+	d := NewDecoder(r)
+
+	// The end of the paste may be split between reads
+	go func() {
+		w.Write([]byte("a\x1b[200~one\r\x1b[Atwo\x1b[20"))
+		w.Write([]byte("1~b\x1b[200~"))
+		w.Write([]byte("three"))
+		w.Close()
+	}()
+
+	for _, exp := range []struct {
+		key  Key
+		text string
+	}{
+		{key: Key('a')},
+		{key: PasteKey, text: "one\r\x1b[Atwo"},
+		{key: Key('b')},
+		// The input ended before the paste did
+		{key: PasteKey, text: "three"},
+	} {
+		k, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != exp.key {
+			t.Fatalf("expected=%d got=%d", exp.key, k)
+		}
+		if k == PasteKey && d.Paste() != exp.text {
+			t.Fatalf("expected paste %q, got %q", exp.text, d.Paste())
+		}
+	}
+
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("at end of decoding, expected io.EOF, got: %v", err)
+	}
+}
+
+func TestDecoderMouse(t *testing.T) {
+	d := NewDecoder(bytes.NewReader([]byte("\x1b[<0;1;1M\x1b[<32;10;5M\x1b[<0;10;5m\x1b[<64;3;4M\x1b[<65;3;4M\x1b[<18;80;24M\x1b[<35;2;2Ma")))
+
+	for _, exp := range []Mouse{
+		{Button: MouseLeft, Action: MousePress, X: 0, Y: 0},
+		{Button: MouseLeft, Action: MouseMotion, X: 9, Y: 4},
+		{Button: MouseLeft, Action: MouseRelease, X: 9, Y: 4},
+		{Button: WheelUp, Action: MousePress, X: 2, Y: 3},
+		{Button: WheelDown, Action: MousePress, X: 2, Y: 3},
+		{Button: MouseRight, Action: MousePress, Mods: ModCtrl, X: 79, Y: 23},
+		{Button: MouseNone, Action: MouseMotion, X: 1, Y: 1},
+	} {
+		k, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != MouseKey {
+			t.Fatalf("expected=%d got=%d", MouseKey, k)
+		}
+		if d.Mouse() != exp {
+			t.Fatalf("expected %+v, got %+v", exp, d.Mouse())
+		}
+	}
+
+	if k, err := d.Decode(); err != nil || k != Key('a') {
+		t.Fatalf("after mouse events, expected 'a', got: %v %v", k, err)
+	}
+}
+
+func TestDecoderReply(t *testing.T) {
+	d := NewDecoder(bytes.NewReader([]byte("\x1b[?62;22;52c\x1b[>41;354;0c\x1bP>|xterm(354)\x1b\\\x1b[?2026;2$y\x1b]11;rgb:0000/0000/0000\a\x1bP1+r636f6c6f7273=323536\x1b\\\x1bPa")))
+	d.ExpectReplies(true)
+
+	for _, exp := range []Reply{
+		{Kind: '[', Marker: '?', Params: []int{62, 22, 52}, Final: 'c'},
+		{Kind: '[', Marker: '>', Params: []int{41, 354, 0}, Final: 'c'},
+		{Kind: 'P', Data: ">|xterm(354)"},
+		{Kind: '[', Marker: '?', Params: []int{2026, 2}, Intermediate: "$", Final: 'y'},
+		{Kind: ']', Data: "11;rgb:0000/0000/0000"},
+		{Kind: 'P', Data: "1+r636f6c6f7273=323536"},
+	} {
+		k, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != ReplyKey {
+			t.Fatalf("expected=%d got=%d", ReplyKey, k)
+		}
+		if !reflect.DeepEqual(d.Reply(), exp) {
+			t.Fatalf("expected %+v, got %+v", exp, d.Reply())
+		}
+	}
+
+	// Alt+P isn't the start of a reply
+	if k, err := d.Decode(); err != nil || k != Key('P')|ModAlt {
+		t.Fatalf("expected Alt+P, got: %v %v", k, err)
+	}
+	if k, err := d.Decode(); err != nil || k != Key('a') {
+		t.Fatalf("expected 'a', got: %v %v", k, err)
+	}
+}
+
+// Alt+P and Alt+] followed by a digit are keys unless a reply is expected
+func TestDecoderNoReply(t *testing.T) {
+	d := NewDecoder(bytes.NewReader([]byte("\x1bP1\x1b]2")))
+
+	for _, exp := range []Key{Key('P') | ModAlt, Key('1'), Key(']') | ModAlt, Key('2')} {
+		if k, err := d.Decode(); err != nil || k != exp {
+			t.Fatalf("expected %v, got: %v %v", exp, k, err)
+		}
+	}
+}
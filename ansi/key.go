@@ -1,19 +1,27 @@
 package ansi
 
+// Key is a key press. It is either a rune, for keys that type text or control
+// characters, or one of the special keys below. The modifiers that were held
+// are added to it as bits, e.g. Ctrl+Right is RightArrowKey|ModCtrl.
+//
+// The modifiers that terminals have always sent as part of the rune are not
+// added as bits. Ctrl+a is Ctrl('a') and Shift+a is 'A', but Ctrl+Shift+a is
+// Ctrl('a')|ModShift as only some terminals can tell it apart from Ctrl+a.
 type Key int32
 
-// Assign an arbitrary large number to the following special keys
-// to avoid conflicts with the normal keys.
 const (
 	EnterKey          Key = 10
 	CarriageReturnKey Key = 13
 	BackspaceKey      Key = 127
 	EscapeKey         Key = '\x1b'
+	TabKey            Key = '\t'
+)
 
-	// These keys are accomplished with escape sequences in the terminal,
-	// and so do not normally fit into a single rune character. As such we
-	// have mapped the to runes so that everything just processes runes
-	LeftArrowKey Key = 1000 + iota
+// These keys are sent as escape sequences by the terminal so don't have a rune.
+// They are numbered after the last rune so that they can't be confused with
+// one.
+const (
+	LeftArrowKey Key = 0x110000 + iota
 	RightArrowKey
 	UpArrowKey
 	DownArrowKey
@@ -22,6 +30,36 @@ const (
 	PageDownKey
 	HomeKey
 	EndKey
+	InsertKey
+	F1Key
+	F2Key
+	F3Key
+	F4Key
+	F5Key
+	F6Key
+	F7Key
+	F8Key
+	F9Key
+	F10Key
+	F11Key
+	F12Key
+
+	// Text was pasted, see Decoder.Paste
+	PasteKey
+	// The mouse was used, see Decoder.Mouse
+	MouseKey
+	// The terminal replied to a query, see Decoder.Reply
+	ReplyKey
+)
+
+// Modifier bits of a Key
+const (
+	ModShift Key = 1 << (24 + iota)
+	ModAlt
+	ModCtrl
+	ModSuper
+
+	modMask = ModShift | ModAlt | ModCtrl | ModSuper
 )
 
 // Returns the ASCII for when the character has been pressed with the CTRL key
@@ -29,6 +67,21 @@ func Ctrl(char byte) Key {
 	return Key(char & 0x1f)
 }
 
+// Alt returns the key pressed with Alt, which is also called Meta
+func Alt(k Key) Key {
+	return k | ModAlt
+}
+
+// Base returns the key without its modifiers
+func (k Key) Base() Key {
+	return k &^ modMask
+}
+
+// Mods returns the modifier bits of the key
+func (k Key) Mods() Key {
+	return k & modMask
+}
+
 type Direction int8
 
 const (
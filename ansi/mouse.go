@@ -0,0 +1,84 @@
+package ansi
+
+// MouseButton is the button of a mouse event. The wheel is reported as
+// buttons that are pressed but never released.
+type MouseButton int8
+
+const (
+	MouseLeft MouseButton = iota
+	MouseMiddle
+	MouseRight
+	// The mouse moved without a button held
+	MouseNone
+	WheelUp
+	WheelDown
+	WheelLeft
+	WheelRight
+)
+
+type MouseAction int8
+
+const (
+	MousePress MouseAction = iota
+	MouseRelease
+	// The mouse moved, with Button held unless it is MouseNone
+	MouseMotion
+)
+
+// Mouse is a mouse event, see Decoder.Mouse
+type Mouse struct {
+	Button MouseButton
+	Action MouseAction
+	// The modifier bits of the keys held, ModShift, ModAlt and ModCtrl
+	Mods Key
+	// The cell the mouse is on, the top left is 0, 0
+	X, Y int
+}
+
+// The buttons of the SGR encoding, after the modifiers and motion are taken
+// out
+var sgrButtons = map[int]MouseButton{
+	0:  MouseLeft,
+	1:  MouseMiddle,
+	2:  MouseRight,
+	3:  MouseNone,
+	64: WheelUp,
+	65: WheelDown,
+	66: WheelLeft,
+	67: WheelRight,
+}
+
+// sgrMouse decodes the SGR mouse encoding, which is enabled by mode 1006:
+// ESC [ < <button> ; <x> ; <y> M, or m when the button is released
+func (c csi) sgrMouse() (Mouse, bool) {
+	if c.marker != '<' || len(c.params) != 3 || len(c.intermediate) != 0 {
+		return Mouse{}, false
+	}
+
+	b := c.param(0, 0, 0)
+	m := Mouse{
+		X: c.param(1, 0, 1) - 1,
+		Y: c.param(2, 0, 1) - 1,
+	}
+
+	if b&4 != 0 {
+		m.Mods |= ModShift
+	}
+	if b&8 != 0 {
+		m.Mods |= ModAlt
+	}
+	if b&16 != 0 {
+		m.Mods |= ModCtrl
+	}
+
+	switch {
+	case c.final == 'm':
+		m.Action = MouseRelease
+	case b&32 != 0:
+		m.Action = MouseMotion
+	}
+
+	button, ok := sgrButtons[b&^(4|8|16|32)]
+	m.Button = button
+	return m, ok && (c.final == 'M' || c.final == 'm')
+}
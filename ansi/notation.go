@@ -0,0 +1,160 @@
+package ansi
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Keys can be written as text, e.g. to store a recorded macro in a register
+// that the user can edit. Printable keys are written as themselves and other
+// keys by name in angle brackets, such as "<Esc>" or "<C-a>". Modifiers are
+// prefixed to the name, such as "<A-x>" or "<C-S-Left>". A literal '<' is
+// written as "<lt>".
+var keyNames = map[Key]string{
+	EnterKey:          "Enter",
+	CarriageReturnKey: "CR",
+	BackspaceKey:      "BS",
+	EscapeKey:         "Esc",
+	Key('\t'):         "Tab",
+	Key('<'):          "lt",
+	LeftArrowKey:      "Left",
+	RightArrowKey:     "Right",
+	UpArrowKey:        "Up",
+	DownArrowKey:      "Down",
+	DeleteKey:         "Del",
+	PageUpKey:         "PageUp",
+	PageDownKey:       "PageDown",
+	HomeKey:           "Home",
+	EndKey:            "End",
+	InsertKey:         "Insert",
+	F1Key:             "F1",
+	F2Key:             "F2",
+	F3Key:             "F3",
+	F4Key:             "F4",
+	F5Key:             "F5",
+	F6Key:             "F6",
+	F7Key:             "F7",
+	F8Key:             "F8",
+	F9Key:             "F9",
+	F10Key:            "F10",
+	F11Key:            "F11",
+	F12Key:            "F12",
+	PasteKey:          "Paste",
+}
+
+// The prefixes of the modifiers, in the order they are written
+var modNames = []struct {
+	mod  Key
+	name string
+}{
+	{ModCtrl, "C-"},
+	{ModAlt, "A-"},
+	{ModShift, "S-"},
+	{ModSuper, "D-"},
+}
+
+var namedKeys = map[string]Key{}
+
+func init() {
+	for k, name := range keyNames {
+		namedKeys[name] = k
+	}
+	for c := byte('@'); c <= '_'; c++ {
+		if _, ok := keyNames[Ctrl(c)]; !ok {
+			namedKeys["C-"+strings.ToLower(string(c))] = Ctrl(c)
+		}
+	}
+}
+
+// String writes the key in the notation of FormatKeys
+func (k Key) String() string {
+	mods, base := k.Mods(), k.Base()
+
+	name, ok := keyNames[base]
+	switch {
+	case ok:
+	case base < ' ':
+		mods |= ModCtrl
+		name = strings.ToLower(string(rune(base | 0x40)))
+	case mods == 0:
+		return string(rune(base))
+	default:
+		name = string(rune(base))
+	}
+
+	var s strings.Builder
+	s.WriteByte('<')
+	for _, m := range modNames {
+		if mods&m.mod != 0 {
+			s.WriteString(m.name)
+		}
+	}
+	s.WriteString(name)
+	s.WriteByte('>')
+	return s.String()
+}
+
+// FormatKeys writes the keys as text that ParseKeys reads back
+func FormatKeys(keys []Key) string {
+	var s strings.Builder
+	for _, k := range keys {
+		s.WriteString(k.String())
+	}
+	return s.String()
+}
+
+// ParseKeys reads keys written by FormatKeys. A '<' that doesn't start the
+// name of a key is taken literally.
+func ParseKeys(s string) []Key {
+	var keys []Key
+
+	for len(s) != 0 {
+		if s[0] == '<' {
+			if end := strings.IndexByte(s, '>'); end != -1 {
+				if k, ok := parseKeyName(s[1:end]); ok {
+					keys = append(keys, k)
+					s = s[end+1:]
+					continue
+				}
+			}
+		}
+
+		r := []rune(s)[0]
+		keys = append(keys, Key(r))
+		s = s[len(string(r)):]
+	}
+
+	return keys
+}
+
+// parseKeyName reads the name of a key between angle brackets
+func parseKeyName(name string) (Key, bool) {
+	if k, ok := namedKeys[name]; ok {
+		return k, true
+	}
+
+	var mods Key
+	for len(name) > 2 && name[1] == '-' {
+		i := 0
+		for i < len(modNames) && modNames[i].name != name[:2] {
+			i++
+		}
+		if i == len(modNames) {
+			return 0, false
+		}
+		mods |= modNames[i].mod
+		name = name[2:]
+	}
+	if mods == 0 {
+		return 0, false
+	}
+
+	k, ok := namedKeys[name]
+	if !ok {
+		if utf8.RuneCountInString(name) != 1 {
+			return 0, false
+		}
+		k = Key([]rune(name)[0])
+	}
+	return textKey(k, mods), true
+}
@@ -0,0 +1,34 @@
+package ansi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNotation(t *testing.T) {
+	for _, test := range []struct {
+		keys []Key
+		text string
+	}{
+		{keys: []Key{'d', 'd'}, text: "dd"},
+		{keys: []Key{'i', 'é', EscapeKey}, text: "ié<Esc>"},
+		{keys: []Key{Ctrl('a'), Ctrl('^'), Ctrl('@')}, text: "<C-a><C-^><C-@>"},
+		{keys: []Key{'<', 'l', 't', '>'}, text: "<lt>lt>"},
+		{keys: []Key{UpArrowKey, EnterKey, CarriageReturnKey, '\t'}, text: "<Up><Enter><CR><Tab>"},
+		{keys: []Key{'x' | ModAlt, Ctrl('a') | ModShift, RightArrowKey | ModCtrl | ModShift}, text: "<A-x><C-S-a><C-S-Right>"},
+		{keys: []Key{F1Key, F12Key | ModSuper, TabKey | ModShift, '<' | ModAlt}, text: "<F1><D-F12><S-Tab><A-lt>"},
+		{keys: []Key{PasteKey, 'a', '\n', PasteKey}, text: "<Paste>a<Enter><Paste>"},
+	} {
+		if got := FormatKeys(test.keys); got != test.text {
+			t.Errorf("FormatKeys(%v) = %q, want %q", test.keys, got, test.text)
+		}
+		if got := ParseKeys(test.text); !reflect.DeepEqual(got, test.keys) {
+			t.Errorf("ParseKeys(%q) = %v, want %v", test.text, got, test.keys)
+		}
+	}
+
+	// Brackets that aren't the name of a key are taken literally
+	if got, want := ParseKeys("<b><"), []Key{'<', 'b', '>', '<'}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKeys(%q) = %v, want %v", "<b><", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package ansi
+
+import "sync/atomic"
+
+// Reply is the terminal's reply to a query, see Decoder.Reply
+type Reply struct {
+	// '[' for a CSI sequence, 'P' for DCS and ']' for OSC
+	Kind byte
+
+	// The parts of a CSI sequence. Only the first sub-parameter of each
+	// parameter is kept, missing parameters are -1.
+	Marker       byte
+	Params       []int
+	Intermediate string
+	Final        byte
+
+	// The string of a DCS or OSC sequence, without the terminator
+	Data string
+}
+
+// reply returns the CSI sequence as a reply. Sequences with a private marker
+// or intermediate bytes aren't sent for keys, so are taken as replies.
+func (c csi) reply() (Reply, bool) {
+	if c.marker == 0 && len(c.intermediate) == 0 {
+		return Reply{}, false
+	}
+
+	r := Reply{Kind: '[', Marker: c.marker, Intermediate: c.intermediate, Final: c.final}
+	for i := range c.params {
+		r.Params = append(r.Params, c.param(i, 0, -1))
+	}
+	return r, true
+}
+
+// ExpectReplies sets whether queries were sent to the terminal that it hasn't
+// replied to yet. DCS and OSC replies are only decoded meanwhile, as they start
+// like Alt+P and Alt+] followed by other keys. It can be called while Decode
+// is running.
+func (d *Decoder) ExpectReplies(expect bool) {
+	var v int32
+	if expect {
+		v = 1
+	}
+	atomic.StoreInt32(&d.expecting, v)
+}
+
+// decodeString decodes a DCS or OSC reply, which is ended by ST (ESC \) or BEL.
+// It returns false if buf doesn't start with one, such as when it is Alt+P or
+// Alt+].
+func (d *Decoder) decodeString() (Key, bool, error) {
+	if atomic.LoadInt32(&d.expecting) == 0 || !d.need(3) {
+		return 0, false, nil
+	}
+
+	// Replies start with a number or, for XTVERSION, ">|". Anything else
+	// is taken as a key pressed with Alt.
+	c := d.buf[2]
+	if !(c >= '0' && c <= '9' || c == '>' && d.buf[1] == 'P') {
+		return 0, false, nil
+	}
+
+	for i := 2; ; i++ {
+		if i == len(d.buf) && !d.fill(true) {
+			d.buf = d.buf[i:]
+			return 0, true, ErrInvalidEscape
+		}
+
+		switch {
+		case d.buf[i] == '\a':
+			d.reply = Reply{Kind: d.buf[1], Data: string(d.buf[2:i])}
+			d.buf = d.buf[i+1:]
+			return ReplyKey, true, nil
+		case d.buf[i] == byte(EscapeKey):
+			if i+1 == len(d.buf) && !d.fill(true) {
+				d.buf = d.buf[i+1:]
+				return 0, true, ErrInvalidEscape
+			}
+			if d.buf[i+1] != '\\' {
+				// Another sequence started before this one ended
+				d.buf = d.buf[i:]
+				return 0, true, ErrInvalidEscape
+			}
+
+			d.reply = Reply{Kind: d.buf[1], Data: string(d.buf[2:i])}
+			d.buf = d.buf[i+2:]
+			return ReplyKey, true, nil
+		}
+	}
+}
+
+// Reply returns the reply when Decode returned ReplyKey
+func (d *Decoder) Reply() Reply {
+	return d.reply
+}
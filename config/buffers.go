@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+)
+
+// bufferName is the name of the buffer shown to the user
+func bufferName(b *core.Buffer) string {
+	if len(b.Name()) == 0 {
+		return "[No Name]"
+	}
+	return b.Name()
+}
+
+// bufferList describes all the open buffers e.g. "[1:main.go] 2:li.go+"
+// The current buffer is in brackets and modified buffers end with a '+'
+func bufferList(e *core.E) string {
+	var b strings.Builder
+	for i, buf := range e.Buffers() {
+		desc := fmt.Sprintf("%d:%s", i+1, bufferName(buf))
+		if buf.Modified() {
+			desc += "+"
+		}
+		if i == e.BufferIndex() {
+			desc = "[" + desc + "]"
+		}
+
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(desc)
+	}
+	return b.String()
+}
+
+// selectBuffer shows the list of buffers and switches to the one chosen by
+// either its number or name
+func selectBuffer(e *core.E) {
+	StaticPrompt(e, bufferList(e)+" > ", func(res string) error {
+		if len(res) == 0 {
+			return nil
+		}
+
+		if n, err := strconv.Atoi(res); err == nil {
+			if n < 1 || n > len(e.Buffers()) {
+				return fmt.Errorf("no buffer %d", n)
+			}
+
+			e.SwitchBuffer(n - 1)
+			return nil
+		}
+
+		for i, b := range e.Buffers() {
+			if bufferName(b) == res {
+				e.SwitchBuffer(i)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("no buffer named %s", res)
+	}, BufferCompletion(e))
+}
+
+// BufferCompletion completes the names of the open buffers
+func BufferCompletion(e *core.E) CompletionFunc {
+	return func(a string) ([]CmplItem, error) {
+		var res []CmplItem
+		for _, b := range e.Buffers() {
+			if name := bufferName(b); strings.HasPrefix(name, a) {
+				res = append(res, CmplItem{Display: name, Real: name})
+			}
+		}
+		return res, nil
+	}
+}
+
+// closeBuffer closes the current buffer, asking first if it has unsaved
+// changes
+func closeBuffer(e *core.E) {
+	b := e.Buffer
+
+	err := e.CloseBuffer(b, false)
+	if err == nil {
+		lspClose(b)
+	}
+	if !errors.Is(err, core.ErrUnsavedChanges) {
+		return
+	}
+
+	e.Prompt(bufferName(b)+" has unsaved changes, close it anyway? [y/n] ", func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.Key('y'):
+			if e.CloseBuffer(b, true) == nil {
+				lspClose(b)
+			}
+		case ansi.Key('n'), ansi.EscapeKey:
+		default:
+			return "", false, nil
+		}
+
+		return "", true, nil
+	})
+}
@@ -0,0 +1,449 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+	"codeberg.org/wlcsm/li/fuzzy"
+	"codeberg.org/wlcsm/li/lsp"
+)
+
+// Maximum number of completions shown at once
+const completionHeight = 8
+
+// Completion is a candidate for completing the text before the cursor
+type Completion struct {
+	// replaces the text being completed
+	Text string
+	// shown next to the text, e.g. what kind of thing it is
+	Detail string
+}
+
+// CompletionSource finds completions for the text before the cursor in insert
+// mode
+type CompletionSource struct {
+	Name string
+	// Typing one of these characters opens the completion menu with just
+	// this source
+	Triggers string
+	// Complete must call add exactly once with the completions and the
+	// index in the cursor's row where the text they replace starts. Sources
+	// that have to wait, like language servers, can call it later from the
+	// event loop.
+	Complete func(e *core.E, add func(start int, items []Completion))
+}
+
+// CompletionSources are asked for completions in this order, earlier sources
+// win when they give the same text
+var CompletionSources = []CompletionSource{
+	{Name: "lsp", Triggers: ".", Complete: lspComplete},
+	{Name: "path", Triggers: "/", Complete: pathComplete},
+	{Name: "keyword", Complete: keywordComplete},
+	{Name: "buffer", Complete: bufferComplete},
+}
+
+type completionGroup struct {
+	source int
+	start  int
+	items  []Completion
+}
+
+type completionMatch struct {
+	group *completionGroup
+	item  Completion
+	score int
+}
+
+// completion is the state of the completion menu
+type completion struct {
+	// row being completed
+	y int
+	// number of sources that haven't given their completions yet
+	pending int
+
+	groups  []*completionGroup
+	matches []completionMatch
+
+	// index into matches of the selected completion, and of the first one
+	// shown
+	selected int
+	offset   int
+}
+
+// the open completion menu, if any
+var completing *completion
+
+// startCompletion opens the completion menu with the completions from the
+// sources
+func startCompletion(e *core.E, sources []int) {
+	closeCompletion(e)
+
+	c := &completion{y: e.Y(), pending: len(sources)}
+	completing = c
+
+	for _, i := range sources {
+		i := i
+		called := false
+
+		CompletionSources[i].Complete(e, func(start int, items []Completion) {
+			if called || completing != c {
+				return
+			}
+			called = true
+
+			c.pending--
+			c.groups = append(c.groups, &completionGroup{source: i, start: start, items: items})
+			c.update(e)
+		})
+	}
+}
+
+// completeTrigger opens the completion menu if the character is a trigger for
+// any source
+func completeTrigger(e *core.E, r rune) {
+	var sources []int
+	for i, s := range CompletionSources {
+		if strings.ContainsRune(s.Triggers, r) {
+			sources = append(sources, i)
+		}
+	}
+
+	if len(sources) != 0 {
+		startCompletion(e, sources)
+	}
+}
+
+func closeCompletion(e *core.E) {
+	completing = nil
+	e.SetPopup(nil)
+}
+
+// completionKey handles the keys that control the completion menu while it is
+// open
+func completionKey(e *core.E, k ansi.Key) bool {
+	c := completing
+
+	switch k {
+	case ansi.Ctrl('n'), ansi.DownArrowKey:
+		c.move(1)
+	case ansi.Ctrl('p'), ansi.UpArrowKey:
+		c.move(-1)
+	case ansi.Key('\t'), ansi.EnterKey, ansi.CarriageReturnKey:
+		if len(c.matches) == 0 {
+			closeCompletion(e)
+			return false
+		}
+		c.accept(e)
+	case ansi.Ctrl('e'), ansi.EscapeKey:
+		closeCompletion(e)
+	default:
+		return false
+	}
+
+	if completing == c {
+		c.show(e)
+	}
+	return true
+}
+
+// update filters the completions by the text typed since they were found
+func (c *completion) update(e *core.E) {
+	if e.Y() != c.y {
+		closeCompletion(e)
+		return
+	}
+
+	c.filter(e.Row(c.y), e.X())
+	if len(c.matches) == 0 && c.pending == 0 {
+		closeCompletion(e)
+		return
+	}
+	c.show(e)
+}
+
+// filter finds the completions that match the text of the row before x, the
+// best first, and selects the first
+func (c *completion) filter(row []rune, x int) {
+	seen := map[string]bool{}
+	c.matches = c.matches[:0]
+
+	sort.Slice(c.groups, func(i, j int) bool {
+		return c.groups[i].source < c.groups[j].source
+	})
+
+	for _, g := range c.groups {
+		if g.start > x {
+			continue
+		}
+
+		typed := string(row[g.start:x])
+		for _, item := range g.items {
+			// Don't offer what has already been typed
+			if seen[item.Text] || item.Text == typed {
+				continue
+			}
+
+			if score, ok := fuzzy.Match(typed, item.Text); ok {
+				seen[item.Text] = true
+				c.matches = append(c.matches, completionMatch{group: g, item: item, score: score})
+			}
+		}
+	}
+
+	// Sources are already in order, so a stable sort keeps ties in it
+	sort.SliceStable(c.matches, func(i, j int) bool {
+		return c.matches[i].score > c.matches[j].score
+	})
+
+	c.selected = 0
+	c.offset = 0
+}
+
+func (c *completion) move(n int) {
+	if len(c.matches) == 0 {
+		return
+	}
+
+	// Wrap around at either end
+	c.selected = (c.selected + n + len(c.matches)) % len(c.matches)
+
+	if c.selected < c.offset {
+		c.offset = c.selected
+	}
+	if c.selected >= c.offset+completionHeight {
+		c.offset = c.selected - completionHeight + 1
+	}
+}
+
+// accept replaces the text being completed with the selected completion
+func (c *completion) accept(e *core.E) {
+	m := c.matches[c.selected]
+	x := e.X()
+
+	e.ReplaceText(c.y, m.group.start, c.y, x, m.item.Text)
+	e.SetX(m.group.start + len([]rune(m.item.Text)))
+
+	closeCompletion(e)
+}
+
+func (c *completion) show(e *core.E) {
+	e.SetPopup(c.popup())
+}
+
+// popup returns the menu of the completions around the selected one, or nil
+// if there are none
+func (c *completion) popup() *core.Popup {
+	if len(c.matches) == 0 {
+		return nil
+	}
+
+	end := c.offset + completionHeight
+	if end > len(c.matches) {
+		end = len(c.matches)
+	}
+	shown := c.matches[c.offset:end]
+
+	width := 0
+	for _, m := range shown {
+		if n := len([]rune(m.item.Text)); n > width {
+			width = n
+		}
+	}
+
+	p := &core.Popup{Selected: c.selected - c.offset, X: shown[0].group.start}
+	for _, m := range shown {
+		line := m.item.Text
+		if len(m.item.Detail) != 0 {
+			line = fmt.Sprintf("%-*s  %s", width, m.item.Text, m.item.Detail)
+		}
+		p.Lines = append(p.Lines, line)
+	}
+	return p
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordStart returns the start of the word that ends at the cursor
+func wordStart(e *core.E) int {
+	row := e.Row(e.Y())
+
+	x := e.X()
+	for x > 0 && isWordChar(row[x-1]) {
+		x--
+	}
+	return x
+}
+
+// bufferComplete completes words from the open buffers
+func bufferComplete(e *core.E, add func(int, []Completion)) {
+	start := wordStart(e)
+	y, x := e.Y(), e.X()
+
+	seen := map[string]bool{}
+	var items []Completion
+
+	// Words in the current buffer are the most likely so come first
+	buffers := []*core.Buffer{e.Buffer}
+	for _, b := range e.Buffers() {
+		if b != e.Buffer {
+			buffers = append(buffers, b)
+		}
+	}
+	for _, b := range buffers {
+		for row := 0; row < b.NumRows(); row++ {
+			chars := b.Row(row)
+
+			for i := 0; i < len(chars); {
+				if !isWordChar(chars[i]) {
+					i++
+					continue
+				}
+
+				j := i
+				for j < len(chars) && isWordChar(chars[j]) {
+					j++
+				}
+
+				// Skip the word being typed
+				word := string(chars[i:j])
+				typing := b == e.Buffer && row == y && i == start && j >= x
+				if !typing && len(chars[i:j]) > 1 && !seen[word] {
+					seen[word] = true
+					items = append(items, Completion{Text: word})
+				}
+				i = j
+			}
+		}
+	}
+
+	add(start, items)
+}
+
+// keywordComplete completes the keywords of the buffer's filetype
+func keywordComplete(e *core.E, add func(int, []Completion)) {
+	var items []Completion
+
+	if syntax := e.Syntax(); syntax != nil {
+		for _, kws := range syntax.Keywords {
+			for _, kw := range kws {
+				items = append(items, Completion{Text: kw, Detail: "keyword"})
+			}
+		}
+	}
+
+	add(wordStart(e), items)
+}
+
+// pathComplete completes the names of files when a path is being typed
+func pathComplete(e *core.E, add func(int, []Completion)) {
+	row := e.Row(e.Y())
+
+	start := e.X()
+	for start > 0 && isPathChar(row[start-1]) {
+		start--
+	}
+
+	path := string(row[start:e.X()])
+	slash := strings.LastIndex(path, "/")
+	if slash == -1 {
+		add(e.X(), nil)
+		return
+	}
+
+	dir := path[:slash+1]
+	if strings.HasPrefix(dir, "~/") {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, dir[2:]) + "/"
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		add(e.X(), nil)
+		return
+	}
+
+	// Hidden files are only offered once a "." is typed
+	name := path[slash+1:]
+
+	var items []Completion
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") && !strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if entry.IsDir() {
+			items = append(items, Completion{Text: entry.Name() + "/", Detail: "dir"})
+		} else {
+			items = append(items, Completion{Text: entry.Name(), Detail: "file"})
+		}
+	}
+
+	add(start+len([]rune(path[:slash+1])), items)
+}
+
+func isPathChar(r rune) bool {
+	return isWordChar(r) || strings.ContainsRune("/.-~", r)
+}
+
+// Names of the kinds of LSP completion items
+var completionKinds = map[int]string{
+	2: "method", 3: "func", 4: "constructor", 5: "field", 6: "var",
+	7: "class", 8: "interface", 9: "module", 10: "property", 13: "enum",
+	14: "keyword", 21: "const", 22: "struct", 25: "type",
+}
+
+// lspComplete asks the buffer's language server for completions
+func lspComplete(e *core.E, add func(int, []Completion)) {
+	doc, pos, err := lspCursor(e)
+	start := wordStart(e)
+	if err != nil {
+		add(start, nil)
+		return
+	}
+
+	y := e.Y()
+	go func() {
+		items, err := doc.server.client.Completion(doc.uri, pos)
+
+		e.Post(func(e *core.E) {
+			if err != nil {
+				e.SetStatusLine("err: completion: %s", err)
+				add(start, nil)
+				return
+			}
+
+			var res []Completion
+			for _, item := range items {
+				text := item.Label
+				if len(item.InsertText) != 0 && item.InsertTextFormat != lsp.FormatSnippet {
+					text = item.InsertText
+				}
+				// An edit may replace a different part of the row than
+				// the word, which isn't supported
+				if item.TextEdit != nil && item.InsertTextFormat != lsp.FormatSnippet {
+					r := item.TextEdit.Range
+					if r.Start.Line == y && lsp.FromUTF16(e.Row(y), r.Start.Character) == start {
+						text = item.TextEdit.NewText
+					}
+				}
+
+				detail := completionKinds[item.Kind]
+				if len(item.Detail) != 0 {
+					detail = strings.TrimSpace(detail + " " + item.Detail)
+				}
+
+				res = append(res, Completion{Text: text, Detail: detail})
+			}
+
+			add(start, res)
+		})
+	}()
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"codeberg.org/wlcsm/li/core"
+)
+
+func TestCompletionFilter(t *testing.T) {
+	lsp := &completionGroup{source: 0, start: 4, items: []Completion{
+		{Text: "Println", Detail: "func"},
+		{Text: "Sprintf", Detail: "func"},
+		{Text: "Errorf", Detail: "func"},
+		{Text: "Fprint", Detail: "func"},
+	}}
+	buffer := &completionGroup{source: 3, start: 4, items: []Completion{
+		{Text: "Println"},
+		{Text: "pr"},
+		{Text: "PrintRow"},
+		{Text: "prompt"},
+	}}
+	// Sources give their completions in any order
+	c := &completion{groups: []*completionGroup{buffer, lsp}}
+
+	for _, test := range []struct {
+		typed    string
+		expected []string
+	}{
+		// Everything, in the order of the sources
+		{"", []string{"Println", "Sprintf", "Errorf", "Fprint", "pr", "PrintRow", "prompt"}},
+		// Matching the start scores higher, and the text typed isn't
+		// offered
+		{"pr", []string{"Println", "PrintRow", "prompt", "Sprintf", "Fprint"}},
+		{"prn", []string{"Println", "PrintRow", "Sprintf", "Fprint"}},
+		// Case matters with an uppercase letter
+		{"Pr", []string{"Println", "PrintRow"}},
+		{"pf", []string{"Sprintf"}},
+		{"xyz", nil},
+	} {
+		row := []rune("fmt." + test.typed)
+		c.filter(row, len(row))
+
+		var got []string
+		for _, m := range c.matches {
+			got = append(got, m.item.Text)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("completing %q gives %q, expected %q", test.typed, got, test.expected)
+		}
+	}
+
+	// Words before the start of the source's text aren't completed
+	c.filter([]rune("fmt"), 3)
+	if len(c.matches) != 0 {
+		t.Errorf("%d completions before their start", len(c.matches))
+	}
+}
+
+func TestCompletionPopup(t *testing.T) {
+	g := &completionGroup{start: 2}
+	for i := 0; i < 10; i++ {
+		g.items = append(g.items, Completion{Text: fmt.Sprintf("item%d", i)})
+	}
+	g.items[0].Detail = "first"
+	c := &completion{groups: []*completionGroup{g}}
+
+	for _, test := range []struct {
+		// how far to move the selection after filtering
+		moves    []int
+		typed    string
+		popup    *core.Popup
+		accepted string
+	}{
+		{
+			popup: &core.Popup{Selected: 0, X: 2, Lines: []string{
+				"item0  first", "item1", "item2", "item3", "item4", "item5", "item6", "item7",
+			}},
+			accepted: "item0",
+		},
+		{
+			moves: []int{1, 1},
+			popup: &core.Popup{Selected: 2, X: 2, Lines: []string{
+				"item0  first", "item1", "item2", "item3", "item4", "item5", "item6", "item7",
+			}},
+			accepted: "item2",
+		},
+		// The menu scrolls to keep the selection in view
+		{
+			moves: []int{1, 1, 1, 1, 1, 1, 1, 1, 1},
+			popup: &core.Popup{Selected: 7, X: 2, Lines: []string{
+				"item2", "item3", "item4", "item5", "item6", "item7", "item8", "item9",
+			}},
+			accepted: "item9",
+		},
+		// And wraps around at either end
+		{
+			moves: []int{-1},
+			popup: &core.Popup{Selected: 7, X: 2, Lines: []string{
+				"item2", "item3", "item4", "item5", "item6", "item7", "item8", "item9",
+			}},
+			accepted: "item9",
+		},
+		{
+			moves: []int{-1, 1},
+			popup: &core.Popup{Selected: 0, X: 2, Lines: []string{
+				"item0  first", "item1", "item2", "item3", "item4", "item5", "item6", "item7",
+			}},
+			accepted: "item0",
+		},
+		{
+			typed:    "m3",
+			popup:    &core.Popup{Selected: 0, X: 2, Lines: []string{"item3"}},
+			accepted: "item3",
+		},
+		{typed: "x"},
+	} {
+		row := []rune("a " + test.typed)
+		c.filter(row, len(row))
+		for _, n := range test.moves {
+			c.move(n)
+		}
+
+		if got := c.popup(); !reflect.DeepEqual(got, test.popup) {
+			t.Errorf("after typing %q and moving %v the popup is %+v, expected %+v", test.typed, test.moves, got, test.popup)
+		}
+		if len(c.matches) == 0 {
+			continue
+		}
+		if m := c.matches[c.selected]; m.item.Text != test.accepted || m.group.start != 2 {
+			t.Errorf("after typing %q and moving %v %q from %d is accepted, expected %q", test.typed, test.moves, m.item.Text, m.group.start, test.accepted)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,6 +13,17 @@ import (
 	"codeberg.org/wlcsm/li/core"
 )
 
+// Hooks are run on events in the editor
+var Hooks = core.Hooks{
+	// Keep the language servers up to date with the open buffers
+	core.BufferOpen:    {lspBufferOpen},
+	core.BufferChanged: {lspBufferChanged},
+	core.AfterSave:     {lspAfterSave},
+	core.Quit:          {lspQuit},
+	// Restart li after Rebuild if it couldn't straight away
+	core.Idle: {retryRestart},
+}
+
 type KeyMapName string
 
 type KeyMap struct {
@@ -62,10 +74,20 @@ func basicHandler(e *core.E, k ansi.Key) (bool, error) {
 	case ansi.RightArrowKey:
 		e.SetX(e.X() + 1)
 	case ansi.Ctrl('q'):
+		if unsaved := e.Unsaved(); len(unsaved) != 0 {
+			confirmQuit(e, unsaved)
+			return true, nil
+		}
+
 		return true, core.ErrQuitEditor
 	case ansi.Ctrl('s'):
 		log.Printf("attempting to save: %s\n", e.Filename())
-		if err := e.Save(); err != nil {
+		err := e.Save()
+		if errors.Is(err, core.ErrFileChanged) {
+			confirmForceSave(e)
+			return true, nil
+		}
+		if err != nil {
 			return true, err
 		}
 
@@ -83,9 +105,6 @@ func basicHandler(e *core.E, k ansi.Key) (bool, error) {
 			e.SetX(e.X() - 1)
 		}
 	default:
-		log.Println("insert char: ", rune(k))
-		e.AppendChar(e.Y(), rune(k))
-		e.SetX(e.X() + 1)
 		return false, nil
 	}
 
@@ -93,59 +112,182 @@ func basicHandler(e *core.E, k ansi.Key) (bool, error) {
 }
 
 func insertModeHandler(e *core.E, k ansi.Key) (bool, error) {
+	if completing != nil && completionKey(e, k) {
+		return true, nil
+	}
+
+	x, y := e.X(), e.Y()
+
 	switch k {
-	case ansi.EnterKey:
-		row := e.Row(e.Y())
-		//row, row2 := row[:e.X()], row[e.X():]
+	case ansi.EscapeKey, ansi.Ctrl('c'):
+		setMode(e, CommandMode)
+		return true, nil
+
+	case ansi.Ctrl('n'):
+		sources := make([]int, len(CompletionSources))
+		for i := range sources {
+			sources[i] = i
+		}
+		startCompletion(e, sources)
+		return true, nil
 
-		e.SetRow(e.Y(), row)
-		panic("unimplemented")
-		//e.InsertRow(e.Y()+1, row2)
+	case ansi.EnterKey, ansi.CarriageReturnKey:
+		e.Newline()
 
-		e.SetY(e.Y() + 1)
-		e.SetX(0)
+	case ansi.DeleteKey, ansi.BackspaceKey:
+		if e.DeletePair() {
+			break
+		}
 
-	case ansi.CarriageReturnKey:
-		row := e.Row(e.Y())
-		//row, row2 := row[:e.X()], row[e.X():]
+		if x != 0 {
+			e.DeleteChars(y, x-1, x)
+			e.SetX(x - 1)
+		} else if y != 0 {
+			prevLen := len(e.Row(y - 1))
 
-		e.SetRow(e.Y(), row)
-		panic("unimplemented")
-		//e.InsertRow(e.Y()+1, row2)
+			e.SetRow(y-1, append(append([]rune{}, e.Row(y-1)...), e.Row(y)...))
+			e.DeleteRows(y, y)
 
-		e.SetY(e.Y() + 1)
-		e.SetX(0)
+			e.SetY(y - 1)
+			e.SetX(prevLen)
+		}
 
-	case ansi.DeleteKey, ansi.BackspaceKey:
-		panic("unimplemented")
-		//		x, y := e.X(), e.Y()
-		//		if x != 0 {
-		//			e.SetRow(y, append(e.rows[y].chars[:x-1], e.rows[y].chars[x:]...))
-		//			e.SetX(x - 1)
-		//		} else {
-		//			e.SetY(y - 1)
-		//			e.SetX(len(e.Row(y - 1)))
-		//
-		//			e.SetRow(y-1, append(e.Row(y-1), e.Row(y)...))
-		//			e.DeleteRows(y, y)
-		//		}
+	case ansi.Key('\t'):
+		insertTab(e)
 
 	default:
-		panic("unimplemented")
-		if k == ansi.Key('\t') || core.IsPrintable(k) {
-			//e.InsertChars(e.Y(), e.X(), rune(k))
-			e.SetX(e.X() + 1)
+		if !core.IsPrintable(k) {
+			return false, nil
+		}
+
+		if e.InsertPaired(rune(k)) {
+			break
 		}
+
+		dedent(e, rune(k))
+		e.InsertChars(y, e.X(), rune(k))
+		e.SetX(e.X() + 1)
+	}
+
+	// Narrow down the completions as the text they complete is typed, or
+	// open the menu for a trigger character
+	if completing != nil {
+		completing.update(e)
+	}
+	if completing == nil && core.IsPrintable(k) {
+		completeTrigger(e, rune(k))
 	}
 
 	return true, nil
 }
 
+// insertTab inserts a tab, or spaces up to the next level of indentation when
+// the buffer is indented with spaces
+func insertTab(e *core.E) {
+	indent := e.Indent()
+	if !indent.ExpandTab {
+		e.InsertChars(e.Y(), e.X(), '\t')
+		e.SetX(e.X() + 1)
+		return
+	}
+
+	col := core.CxToRx(e.Row(e.Y()), e.Tabstop(), e.X())
+	n := indent.ShiftWidth - col%indent.ShiftWidth
+	e.InsertChars(e.Y(), e.X(), []rune(strings.Repeat(" ", n))...)
+	e.SetX(e.X() + n)
+}
+
+// dedent moves a row back a level of indentation when the closing bracket r is
+// typed at its start, see EditorSyntax.DedentOn
+func dedent(e *core.E, r rune) {
+	syntax := e.Syntax()
+	if syntax == nil || !strings.ContainsRune(syntax.DedentOn, r) {
+		return
+	}
+
+	row := e.Row(e.Y())
+	if e.X() == 0 || len(core.IndentOf(row)) < e.X() {
+		return
+	}
+
+	width := e.IndentWidth(row) - e.Indent().ShiftWidth
+	if width < 0 {
+		width = 0
+	}
+	e.SetIndentWidth(e.Y(), width)
+}
+
+// confirmQuit asks the user whether to quit when there are unsaved buffers
+func confirmQuit(e *core.E, unsaved []*core.Buffer) {
+	names := make([]string, len(unsaved))
+	for i, b := range unsaved {
+		names[i] = bufferName(b)
+	}
+
+	e.Prompt("unsaved changes in "+strings.Join(names, ", ")+", quit anyway? [y/n] ", func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.Key('y'):
+			e.Quit()
+		case ansi.Key('n'), ansi.EscapeKey:
+		default:
+			return "", false, nil
+		}
+
+		return "", true, nil
+	})
+}
+
+// confirmForceSave asks the user whether to overwrite a file that was changed
+// on disk
+func confirmForceSave(e *core.E) {
+	e.Prompt(e.Filename()+" changed on disk, overwrite it? [y/n] ", func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.Key('y'):
+			if err := e.ForceSave(); err != nil {
+				return "", true, err
+			}
+
+			e.SetStatusLine("saved file: %s", e.Filename())
+		case ansi.Key('n'), ansi.EscapeKey:
+		default:
+			return "", false, nil
+		}
+
+		return "", true, nil
+	})
+}
+
 const (
 	StartSelection = "start"
 )
 
+// The first key of a two key command, e.g. the 'g' in "gl"
+var pendingKey ansi.Key
+
+// The number typed before a command, e.g. the 3 in "3@a", or 0 if there was
+// none
+var count int
+
 func commandModeHandler(e *core.E, k ansi.Key) (bool, error) {
+	if pendingKey != 0 {
+		prefix := pendingKey
+		pendingKey = 0
+		err := prefixHandler(e, prefix, k)
+		count = 0
+		return true, err
+	}
+
+	if k >= '1' && k <= '9' || k == '0' && count > 0 {
+		count = count*10 + int(k-'0')
+		return true, nil
+	}
+	defer func() {
+		// The count is for the command after it
+		if pendingKey == 0 {
+			count = 0
+		}
+	}()
+
 	switch k {
 	case ansi.Key('j'):
 		e.SetY(e.Y() + 1)
@@ -156,39 +298,111 @@ func commandModeHandler(e *core.E, k ansi.Key) (bool, error) {
 	case ansi.Key('l'):
 		e.SetX(e.X() + 1)
 	case ansi.Key('J'):
+		e.PushJump()
 		e.SetY(e.NumRows() - 1)
 	case ansi.Key('K'):
+		e.PushJump()
 		e.SetY(0)
 	case ansi.Key('H'), ansi.Key('0'):
 		e.SetX(0)
 	case ansi.Key('G'):
+		e.PushJump()
 		e.SetY(e.NumRows())
 	case ansi.Key('C'):
 		e.SetRow(e.Y(), []rune{})
+	case ansi.Key('%'):
+		if !e.JumpToMatch() {
+			e.SetStatusLine("no matching bracket")
+		}
+	case ansi.Key('i'):
+		setMode(e, InsertMode)
+	case ansi.Key('a'):
+		e.SetX(e.X() + 1)
+		setMode(e, InsertMode)
+	case ansi.Key('u'):
+		if !e.Undo() {
+			e.SetStatusLine("nothing to undo")
+		}
+	case ansi.Ctrl('r'):
+		if !e.Redo() {
+			e.SetStatusLine("nothing to redo")
+		}
+	case ansi.Key(']'), ansi.Key('['), ansi.Key('g'), ansi.Key('m'), ansi.Key('\''), ansi.Key('@'), ansi.Key('Q'), ansi.Key('d'), ansi.Key('c'):
+		pendingKey = k
+	case ansi.Key('>'), ansi.Key('<'):
+		levels := 1
+		if k == ansi.Key('<') {
+			levels = -1
+		}
+
+		// The selected rows are shifted straight away, otherwise the
+		// key is repeated like ">>"
+		if sel, ok := e.Selection(); ok {
+			from, to := sel.Ordered()
+			e.ShiftRows(from.Y, to.Y, levels)
+		} else {
+			pendingKey = k
+		}
+	case ansi.Key('q'):
+		if len(e.Recording()) != 0 {
+			stopRecording(e)
+		} else {
+			pendingKey = k
+		}
+	case ansi.Ctrl('o'):
+		if !e.JumpBack() {
+			e.SetStatusLine("at the start of the jump list")
+		}
+	case ansi.Key('\t'):
+		if !e.JumpForward() {
+			e.SetStatusLine("at the end of the jump list")
+		}
+	case ansi.Ctrl('^'):
+		e.AlternateBuffer()
+	case ansi.Key('b'):
+		selectBuffer(e)
+	case ansi.Key('X'):
+		closeBuffer(e)
+	case ansi.Ctrl('p'):
+		FuzzyFind(e)
 	case ansi.Key('e'):
-		StaticPrompt(e, "File name: ", func(f string) error {
+		HistoryPrompt(e, PromptHistory, "File name: ", func(f string) error {
 			if len(f) == 0 {
 				return fmt.Errorf("No file name")
 			}
 
+			e.PushJump()
 			return e.OpenFile(f)
 		}, FileCompletion)
 	case ansi.Key('s'):
-		StaticPrompt(e, "$ ", func(res string) error {
+		HistoryPrompt(e, PromptHistory, "$ ", func(res string) error {
 			if len(res) == 0 {
 				return nil
 			}
 
-			c := strings.Split(res, " ")
-			out, err := exec.Command(c[0], c[1:]...).Output()
-			if err != nil {
-				return err
+			return RunCommand(e, res)
+		})
+	case ansi.Ctrl('c'):
+		cancelJob(e)
+	case ansi.EscapeKey:
+		e.ClearSelection()
+	case ansi.Key('y'):
+		return true, copyToClipboard(e)
+	case ansi.Key('!'):
+		HistoryPrompt(e, PromptHistory, "!", func(res string) error {
+			return filterCommand(e, res)
+		})
+	case ansi.Key('S'):
+		HistoryPrompt(e, PromptHistory, "$ ", func(res string) error {
+			if len(res) == 0 {
+				return nil
 			}
 
-			e.SetStatusLine(string(out))
-
-			return nil
+			// Interactive programs, such as git commit, need the terminal
+			return e.RunInteractive(exec.Command("sh", "-c", res))
 		})
+	case ansi.Ctrl('z'):
+		return true, e.Suspend()
 	default:
 		return false, nil
 	}
@@ -196,9 +410,117 @@ func commandModeHandler(e *core.E, k ansi.Key) (bool, error) {
 	return true, nil
 }
 
+// copyToClipboard copies the selection, or the current row if there is none
+func copyToClipboard(e *core.E) error {
+	text := e.SelectedText()
+	if _, ok := e.Selection(); !ok {
+		text = string(e.Row(e.Y()))
+	}
+
+	if err := e.SetClipboard(text); err != nil {
+		return err
+	}
+
+	e.ClearSelection()
+	e.SetStatusLine("copied %d lines", strings.Count(text, "\n")+1)
+	return nil
+}
+
+// prefixHandler handles the second key of a two key command
+func prefixHandler(e *core.E, prefix, k ansi.Key) error {
+	switch prefix {
+	case ansi.Key('m'):
+		return setMark(e, k)
+	case ansi.Key('\''):
+		return gotoMark(e, k)
+	case ansi.Key('q'):
+		return startRecording(e, k)
+	case ansi.Key('@'):
+		return replayMacro(e, k, count)
+	case ansi.Key('Q'):
+		return editMacro(e, k)
+	}
+
+	switch string([]rune{rune(prefix), rune(k)}) {
+	case ">>", "<<":
+		levels := 1
+		if prefix == ansi.Key('<') {
+			levels = -1
+		}
+
+		last := e.Y() + count - 1
+		if count == 0 {
+			last = e.Y()
+		}
+		if last >= e.NumRows() {
+			last = e.NumRows() - 1
+		}
+		e.ShiftRows(e.Y(), last, levels)
+	case "]b":
+		e.NextBuffer()
+	case "[b":
+		e.PrevBuffer()
+	case "]q":
+		return QuickfixNext(e)
+	case "[q":
+		return QuickfixPrev(e)
+	case "gc":
+		from, to := e.Y(), e.Y()+count-1
+		if sel, ok := e.Selection(); ok {
+			start, end := sel.Ordered()
+			from, to = start.Y, end.Y
+			e.ClearSelection()
+		}
+		if to < from {
+			to = from
+		}
+		if to >= e.NumRows() {
+			to = e.NumRows() - 1
+		}
+		return e.ToggleComment(from, to)
+	case "ds":
+		deleteSurround(e)
+	case "cs":
+		changeSurround(e)
+	case "gs":
+		addSurround(e)
+	case "gl":
+		QuickfixOpen(e)
+	case "gr":
+		HistoryPrompt(e, SearchHistory, "grep: ", func(pattern string) error {
+			if len(pattern) == 0 {
+				return nil
+			}
+
+			Grep(e, pattern)
+			return nil
+		})
+	case "gm":
+		Make(e, MakeCommand)
+	case "gj":
+		selectJob(e)
+	case "gB":
+		return Rebuild(e)
+	case "gd":
+		return GotoDefinition(e)
+	case "gh":
+		return Hover(e)
+	case "gR":
+		return FindReferences(e)
+	case "gn":
+		return Rename(e)
+	case "g=":
+		return Format(e)
+	}
+
+	return nil
+}
+
 type Line struct {
 	File string
 	Row  int
+	// Column in bytes, 0 if there was none
+	Col  int
 	Orig string
 }
 
@@ -222,10 +544,18 @@ func CreateList(l string) []Line {
 }
 
 func parseLine(l string) Line {
-	i := strings.Index(l, ":")
+	// The colon of a Windows drive, e.g. "C:\src\main.go:12: ...", isn't
+	// the end of the file name
+	drive := 0
+	if len(l) > 2 && (l[0] >= 'A' && l[0] <= 'Z' || l[0] >= 'a' && l[0] <= 'z') && l[1] == ':' && (l[2] == '\\' || l[2] == '/') {
+		drive = 2
+	}
+
+	i := strings.Index(l[drive:], ":")
 	if i == -1 {
 		return Line{Orig: l}
 	}
+	i += drive
 
 	j := strings.Index(l[i+1:], ":")
 	if j == -1 {
@@ -237,11 +567,21 @@ func parseLine(l string) Line {
 		return Line{Orig: l}
 	}
 
-	return Line{
+	line := Line{
 		File: l[:i],
 		Row:  row,
 		Orig: l,
 	}
+
+	// The column is optional, e.g. "main.go:12:5: undefined: x"
+	rest := l[i+j+2:]
+	if k := strings.Index(rest, ":"); k != -1 {
+		if col, err := strconv.Atoi(rest[:k]); err == nil {
+			line.Col = col
+		}
+	}
+
+	return line
 }
 
 type CompletionFunc func(a string) ([]CmplItem, error)
@@ -296,22 +636,64 @@ func FileCompletion(a string) ([]CmplItem, error) {
 // StaticPrompt is a "normal" prompt designed to only get input from the user.
 // It you want things to happen when you press any key, then use Prompt
 func StaticPrompt(e *core.E, prompt string, end func(string) error, comp ...CompletionFunc) {
-	var input string
+	HistoryPrompt(e, "", prompt, end, comp...)
+}
+
+// Names of the histories of prompts
+const (
+	PromptHistory = "prompt"
+	SearchHistory = "search"
+)
+
+// HistoryPrompt is a StaticPrompt that remembers what was entered in the named
+// history. The up and down keys go through the earlier entries.
+func HistoryPrompt(e *core.E, history, prompt string, end func(string) error, comp ...CompletionFunc) {
+	editPrompt(e, history, prompt, "", end, comp...)
+}
+
+// editPrompt is a HistoryPrompt that starts with the input already typed
+func editPrompt(e *core.E, history, prompt, input string, end func(string) error, comp ...CompletionFunc) {
 	var cachedComp []CmplItem
 	var compIndex int
 
-	e.Prompt(prompt, func(k ansi.Key) string {
+	// Index of the history entry being shown, past the end when it is the
+	// input the user was typing
+	entries := e.History(history)
+	index := len(entries)
+	var typed string
+
+	e.Prompt(prompt, func(k ansi.Key) (string, bool, error) {
 		log.Printf("key is: %s", string(k))
 
 		switch k {
-		case ansi.EnterKey, ansi.CarriageReturnKey:
-			if err := end(input); err != nil {
-				e.Errs <- err
+		case ansi.UpArrowKey, ansi.DownArrowKey:
+			next := index - 1
+			if k == ansi.DownArrowKey {
+				next = index + 1
+			}
+			if next < 0 || next > len(entries) {
+				break
 			}
 
-			return input
+			if index == len(entries) {
+				typed = input
+			}
+			index = next
+
+			if index == len(entries) {
+				input = typed
+			} else {
+				input = entries[index]
+			}
+			cachedComp = nil
+			compIndex = 0
+		case ansi.EnterKey, ansi.CarriageReturnKey:
+			if len(history) != 0 {
+				e.AddHistory(history, input)
+			}
+			return input, true, end(input)
 		case ansi.EscapeKey, ansi.Ctrl('q'):
-			return ""
+			return "", true, nil
 		case ansi.BackspaceKey, ansi.DeleteKey:
 			if len(input) > 0 {
 				input = input[:len(input)-1]
@@ -349,6 +731,10 @@ func StaticPrompt(e *core.E, prompt string, end func(string) error, comp ...Comp
 			}
 		}
 
-		return input
+		return input, false, nil
 	})
+
+	if len(input) != 0 {
+		e.SetStatusLine("%s%s", prompt, input)
+	}
 }
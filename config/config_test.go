@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestParseLine(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		file string
+		row  int
+		col  int
+	}{
+		{"main.go:12:5: undefined: x", "main.go", 12, 5},
+		{"core/li.go:3:this is the text", "core/li.go", 3, 0},
+		{"a.go:7:a: b", "a.go", 7, 0},
+		{"a.go:7:", "a.go", 7, 0},
+		{`C:\src\main.go:12:5: undefined: x`, `C:\src\main.go`, 12, 5},
+		{`d:/src/main.go:4:text`, `d:/src/main.go`, 4, 0},
+		{"C:12:text", "C", 12, 0},
+		{"no location here", "", 0, 0},
+		{"a.go: not a row: x", "", 0, 0},
+		{"a.go:12", "", 0, 0},
+	} {
+		l := parseLine(test.line)
+		if l.File != test.file || l.Row != test.row || l.Col != test.col || l.Orig != test.line {
+			t.Errorf("parseLine(%q) = %+v, expected %q, %d, %d", test.line, l, test.file, test.row, test.col)
+		}
+	}
+}
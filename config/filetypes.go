@@ -51,6 +51,8 @@ var (
 		Mce:              "*/",
 		HighlightStrings: true,
 		HighlightNumbers: true,
+		IndentAfter:      "{(",
+		DedentOn:         "})",
 	}
 
 	Go = core.EditorSyntax{
@@ -77,6 +79,10 @@ var (
 		Mce:              "*/",
 		HighlightStrings: true,
 		HighlightNumbers: true,
+		Formatter:        "gofmt",
+		IndentAfter:      "{([",
+		DedentOn:         "})]",
+		AutoPairs:        "()[]{}\"\"''``",
 	}
 
 	JavaScript = core.EditorSyntax{
@@ -103,6 +109,11 @@ var (
 		Mce:              "*/",
 		HighlightStrings: true,
 		HighlightNumbers: true,
+		Formatter:        `prettier --stdin-filepath "$LI_FILE"`,
+		Indent:           core.Indent{ExpandTab: true, ShiftWidth: 2},
+		IndentAfter:      "{([",
+		DedentOn:         "})]",
+		AutoPairs:        "()[]{}\"\"''``",
 	}
 
 	Python = core.EditorSyntax{
@@ -125,6 +136,10 @@ var (
 		Mce:              `"""`,
 		HighlightStrings: true,
 		HighlightNumbers: true,
+		Formatter:        "black --quiet -",
+		Indent:           core.Indent{ExpandTab: true, ShiftWidth: 4},
+		IndentAfter:      ":([{",
+		DedentOn:         ")]}",
 	}
 
 	Html = core.EditorSyntax{
@@ -143,11 +158,16 @@ var (
 		Mce:              "-->",
 		HighlightStrings: true,
 		HighlightNumbers: true,
+		Indent:           core.Indent{ExpandTab: true, ShiftWidth: 2},
+		MatchTags:        true,
 	}
 
 	JSON = core.EditorSyntax{
 		Filetype:         "json",
 		HighlightStrings: true,
 		HighlightNumbers: true,
+		Indent:           core.Indent{ExpandTab: true, ShiftWidth: 2},
+		IndentAfter:      "{[",
+		DedentOn:         "}]",
 	}
 )
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"codeberg.org/wlcsm/li/core"
+)
+
+// FilterRows pipes the rows from and to inclusive through the shell command and
+// replaces them with its output. The rows are left alone if the command fails,
+// the error has what it wrote to stderr.
+func FilterRows(e *core.E, from, to int, command string) error {
+	var in strings.Builder
+	for y := from; y <= to; y++ {
+		in.WriteString(string(e.Row(y)))
+		in.WriteByte('\n')
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(in.String())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) != 0 {
+			return fmt.Errorf("%s: %s", command, strings.ReplaceAll(msg, "\n", " "))
+		}
+		return fmt.Errorf("%s: %w", command, err)
+	}
+
+	var rows [][]rune
+	if stdout.Len() != 0 {
+		out := strings.TrimSuffix(stdout.String(), "\n")
+		for _, l := range strings.Split(out, "\n") {
+			rows = append(rows, []rune(strings.TrimSuffix(l, "\r")))
+		}
+	}
+
+	e.ReplaceRows(from, to, rows...)
+	return nil
+}
+
+// filterRange matches the optional range at the start of a filter command, a
+// row number or "." for the cursor's row, optionally followed by a comma and
+// the last row which may also be "$" for the end of the buffer. It is
+// separated from the command by spaces or a "!", so that commands such as
+// "./fmt.sh" or "2to3 -w -" aren't taken to start with one.
+var filterRange = regexp.MustCompile(`^\s*(\d+|\.)(?:,(\d+|\.|\$))?(?:\s+|!|$)`)
+
+// filterCommand runs a filter command typed by the user, e.g. "sort" filters
+// the whole buffer and "3,. sort" filters from the third row to the cursor
+func filterCommand(e *core.E, input string) error {
+	from, to, command := parseFilter(input, e.Y(), e.NumRows())
+	if len(command) == 0 {
+		return nil
+	}
+	if from < 0 || to >= e.NumRows() {
+		return fmt.Errorf("rows %d,%d are out of range", from+1, to+1)
+	}
+
+	if err := FilterRows(e, from, to, command); err != nil {
+		return err
+	}
+
+	e.SetStatusLine("filtered %d lines through %s", to-from+1, command)
+	return nil
+}
+
+// parseFilter splits a filter command into the rows it filters and the shell
+// command, given the cursor's row and the number of rows
+func parseFilter(input string, cursor, rows int) (from, to int, command string) {
+	from, to = 0, rows-1
+
+	if m := filterRange.FindStringSubmatch(input); m != nil {
+		input = input[len(m[0]):]
+
+		from = parseRow(m[1], cursor, rows)
+		to = from
+		if len(m[2]) != 0 {
+			to = parseRow(m[2], cursor, rows)
+		}
+		if from > to {
+			from, to = to, from
+		}
+	}
+
+	return from, to, strings.TrimSpace(input)
+}
+
+// parseRow converts a row in a range, where rows start from 1, to an index
+func parseRow(s string, cursor, rows int) int {
+	switch s {
+	case ".":
+		return cursor
+	case "$":
+		return rows - 1
+	}
+
+	n, _ := strconv.Atoi(s)
+	return n - 1
+}
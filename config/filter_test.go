@@ -0,0 +1,32 @@
+package config
+
+import "testing"
+
+func TestParseFilter(t *testing.T) {
+	// The cursor is on the fifth of ten rows
+	for _, test := range []struct {
+		input    string
+		from, to int
+		command  string
+	}{
+		{"sort", 0, 9, "sort"},
+		{"  jq . ", 0, 9, "jq ."},
+		{"3 sort", 2, 2, "sort"},
+		{"3,. sort", 2, 4, "sort"},
+		{"7,3 sort", 2, 6, "sort"},
+		{".,$ sort -r", 4, 9, "sort -r"},
+		{"2,4!sort", 1, 3, "sort"},
+		{". !fmt", 4, 4, "!fmt"},
+		{"./fmt.sh", 0, 9, "./fmt.sh"},
+		{"2to3 -w -", 0, 9, "2to3 -w -"},
+		{"3,.sort", 0, 9, "3,.sort"},
+		{"3", 2, 2, ""},
+		{"", 0, 9, ""},
+	} {
+		from, to, command := parseFilter(test.input, 4, 10)
+		if from != test.from || to != test.to || command != test.command {
+			t.Errorf("parseFilter(%q) = %d, %d, %q, expected %d, %d, %q",
+				test.input, from, to, command, test.from, test.to, test.command)
+		}
+	}
+}
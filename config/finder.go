@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+	"codeberg.org/wlcsm/li/fuzzy"
+)
+
+// Maximum number of results shown by the fuzzy finder
+const finderHeight = 10
+
+type finderMatch struct {
+	path  string
+	score int
+}
+
+// finder is the state of a fuzzy file search
+type finder struct {
+	// all the files found so far
+	files []string
+	// whether the files are still being searched for
+	walking bool
+
+	query   string
+	matches []finderMatch
+	// closed to stop the search for the matches of the query when it
+	// changes, nil when the matches are up to date
+	searching chan struct{}
+
+	// index into matches of the selected file, and of the first one shown
+	selected int
+	offset   int
+
+	// closed when the finder is, to stop the search
+	done   chan struct{}
+	closed bool
+}
+
+// FuzzyFind searches the files in the working directory, ignoring those listed
+// in .gitignore files, and opens the one the user chooses.
+func FuzzyFind(e *core.E) {
+	f := &finder{
+		walking: true,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		err := walkFiles(".", f.done, func(batch []string) {
+			e.Post(func(e *core.E) {
+				f.add(batch)
+				f.show(e)
+			})
+		})
+
+		e.Post(func(e *core.E) {
+			f.walking = false
+			if err != nil {
+				e.SetStatusLine("err: %s", err)
+			}
+			f.show(e)
+		})
+	}()
+
+	f.show(e)
+
+	e.Prompt("Files> ", func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.EnterKey, ansi.CarriageReturnKey:
+			f.close(e)
+
+			if len(f.matches) == 0 {
+				return "", true, nil
+			}
+
+			e.PushJump()
+			return "", true, e.OpenFile(f.matches[f.selected].path)
+		case ansi.EscapeKey, ansi.Ctrl('q'), ansi.Ctrl('c'):
+			f.close(e)
+			return "", true, nil
+		case ansi.BackspaceKey, ansi.DeleteKey:
+			if len(f.query) > 0 {
+				q := []rune(f.query)
+				f.setQuery(e, string(q[:len(q)-1]))
+			}
+		case ansi.UpArrowKey, ansi.Ctrl('p'):
+			f.move(-1)
+		case ansi.DownArrowKey, ansi.Ctrl('n'), ansi.Key('\t'):
+			f.move(1)
+		case ansi.PageUpKey:
+			f.move(-finderHeight)
+		case ansi.PageDownKey:
+			f.move(finderHeight)
+		default:
+			if core.IsPrintable(k) {
+				f.setQuery(e, f.query+string(k))
+			}
+		}
+
+		f.show(e)
+		return f.query, false, nil
+	})
+}
+
+func (f *finder) close(e *core.E) {
+	if f.closed {
+		return
+	}
+
+	f.closed = true
+	close(f.done)
+	e.SetOverlay(nil)
+}
+
+// add adds newly found files to the search
+func (f *finder) add(files []string) {
+	if f.closed {
+		return
+	}
+
+	f.files = append(f.files, files...)
+
+	// They are matched when the search for the query is done
+	if f.searching != nil {
+		return
+	}
+	f.matches = f.merge(f.matches, matchPaths(f.query, files, nil, nil))
+}
+
+// setQuery searches for the matches of the new query in the background, so
+// that typing isn't held up by a lot of files
+func (f *finder) setQuery(e *core.E, q string) {
+	// Anything that matches the new query matches the old one if it was
+	// just extended, so there is no need to look at all the files again
+	paths := f.files
+	if f.searching == nil && len(f.query) != 0 && strings.HasPrefix(q, f.query) {
+		paths = make([]string, len(f.matches))
+		for i, m := range f.matches {
+			paths[i] = m.path
+		}
+	}
+
+	if f.searching != nil {
+		close(f.searching)
+	}
+	stop := make(chan struct{})
+	f.searching = stop
+
+	f.query = q
+	f.selected = 0
+	f.offset = 0
+
+	// Files are only appended, so the first n stay the same while searching
+	n := len(f.files)
+
+	go func() {
+		matches := matchPaths(q, paths, stop, f.done)
+		if matches == nil {
+			return
+		}
+
+		e.Post(func(e *core.E) {
+			if f.searching != stop || f.closed {
+				return
+			}
+
+			f.searching = nil
+			f.matches = f.merge(matches, matchPaths(q, f.files[n:], nil, nil))
+			f.show(e)
+		})
+	}()
+}
+
+// matchPaths returns the paths that match the query, best first. It returns
+// nil if either stop or done is closed before it is done.
+func matchPaths(query string, paths []string, stop, done <-chan struct{}) []finderMatch {
+	res := []finderMatch{}
+	for i, p := range paths {
+		if i%1024 == 0 {
+			select {
+			case <-stop:
+				return nil
+			case <-done:
+				return nil
+			default:
+			}
+		}
+
+		if score, ok := fuzzy.Match(query, p); ok {
+			res = append(res, finderMatch{path: p, score: score})
+		}
+	}
+
+	if len(query) != 0 {
+		sort.SliceStable(res, func(i, j int) bool {
+			return better(res[i], res[j])
+		})
+	}
+	return res
+}
+
+// better reports whether a is a better match than b, shorter paths win ties
+func better(a, b finderMatch) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return len(a.path) < len(b.path)
+}
+
+// merge merges the sorted matches b into a, which is sorted too. Without a
+// query they are kept in the order the files were found.
+func (f *finder) merge(a, b []finderMatch) []finderMatch {
+	if len(f.query) == 0 || len(b) == 0 {
+		return append(a, b...)
+	}
+
+	res := make([]finderMatch, 0, len(a)+len(b))
+	for len(a) != 0 && len(b) != 0 {
+		if better(b[0], a[0]) {
+			res = append(res, b[0])
+			b = b[1:]
+		} else {
+			res = append(res, a[0])
+			a = a[1:]
+		}
+	}
+	res = append(res, a...)
+	return append(res, b...)
+}
+
+func (f *finder) move(n int) {
+	f.selected += n
+	if f.selected >= len(f.matches) {
+		f.selected = len(f.matches) - 1
+	}
+	if f.selected < 0 {
+		f.selected = 0
+	}
+
+	// Scroll so that the selection is visible
+	if f.selected < f.offset {
+		f.offset = f.selected
+	}
+	if f.selected >= f.offset+finderHeight {
+		f.offset = f.selected - finderHeight + 1
+	}
+}
+
+// show displays the results above the prompt
+func (f *finder) show(e *core.E) {
+	if f.closed {
+		return
+	}
+
+	end := f.offset + finderHeight
+	if end > len(f.matches) {
+		end = len(f.matches)
+	}
+
+	o := &core.Overlay{Selected: -1}
+	for i, m := range f.matches[f.offset:end] {
+		if f.offset+i == f.selected {
+			o.Selected = len(o.Lines)
+		}
+		o.Lines = append(o.Lines, "  "+m.path)
+	}
+
+	status := fmt.Sprintf("  %d/%d", len(f.matches), len(f.files))
+	if f.walking || f.searching != nil {
+		status += " (searching...)"
+	}
+	o.Lines = append(o.Lines, status)
+
+	e.SetOverlay(o)
+}
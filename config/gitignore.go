@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ignoreRule is a pattern from a .gitignore file
+type ignoreRule struct {
+	// the pattern split into path components
+	segments []string
+	// the pattern started with '!' so it re-includes files
+	negate bool
+	// the pattern ended with '/' so it only matches directories
+	dirOnly bool
+}
+
+func parseGitignore(data string) []ignoreRule {
+	var rules []ignoreRule
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		var r ignoreRule
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// Patterns without a slash can match at any depth, those with one
+		// are relative to the directory of the .gitignore file
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		line = strings.TrimPrefix(line, "/")
+
+		r.segments = strings.Split(line, "/")
+		rules = append(rules, r)
+	}
+
+	return rules
+}
+
+// matchIgnoreRules checks the path, relative to the directory of the
+// .gitignore that the rules are from, against the rules. The last matching
+// rule decides whether it is ignored.
+func matchIgnoreRules(rules []ignoreRule, rel string, isDir bool) (matched, ignored bool) {
+	name := strings.Split(rel, "/")
+
+	for i := len(rules) - 1; i >= 0; i-- {
+		r := rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		if matchSegments(r.segments, name) {
+			return true, !r.negate
+		}
+	}
+
+	return false, false
+}
+
+// matchSegments matches the path components against the pattern components
+// where "**" matches any number of components
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			pat = pat[1:]
+			if len(pat) == 0 {
+				// "foo/**" matches everything inside foo but not foo
+				return len(name) > 0
+			}
+
+			for i := range name {
+				if matchSegments(pat, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+
+		pat, name = pat[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+var errStopWalk = errors.New("stop walking")
+
+// How many files to collect, or how long to wait, before reporting them
+const (
+	walkBatchSize  = 1024
+	walkBatchDelay = 50 * time.Millisecond
+)
+
+// walkFiles calls found with batches of the files under root, skipping those
+// ignored by .gitignore files. It stops early when done is closed.
+func walkFiles(root string, done <-chan struct{}, found func([]string)) error {
+	// rules from the .gitignore files of the directories walked so far
+	rules := map[string][]ignoreRule{}
+
+	var batch []string
+	lastBatch := time.Now()
+
+	isIgnored := func(p string, isDir bool) bool {
+		// The deepest .gitignore takes precedence
+		for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+			if r, ok := rules[dir]; ok {
+				rel, err := filepath.Rel(dir, p)
+				if err == nil {
+					if matched, ignored := matchIgnoreRules(r, filepath.ToSlash(rel), isDir); matched {
+						return ignored
+					}
+				}
+			}
+
+			if dir == root || dir == "." || dir == string(filepath.Separator) {
+				return false
+			}
+		}
+	}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		select {
+		case <-done:
+			return errStopWalk
+		default:
+		}
+
+		if err != nil {
+			// Skip anything we can't read
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if p != root && (d.Name() == ".git" || isIgnored(p, true)) {
+				return filepath.SkipDir
+			}
+
+			if data, err := os.ReadFile(filepath.Join(p, ".gitignore")); err == nil {
+				rules[p] = parseGitignore(string(data))
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || isIgnored(p, false) {
+			return nil
+		}
+
+		batch = append(batch, p)
+		if len(batch) >= walkBatchSize || time.Since(lastBatch) > walkBatchDelay {
+			found(batch)
+			batch = nil
+			lastBatch = time.Now()
+		}
+
+		return nil
+	})
+
+	if len(batch) != 0 {
+		found(batch)
+	}
+
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
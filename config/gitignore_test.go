@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGitignore(t *testing.T) {
+	for _, test := range []struct {
+		gitignore string
+		path      string
+		isDir     bool
+
+		matched, ignored bool
+	}{
+		{"*.log", "a.log", false, true, true},
+		{"*.log", "sub/dir/a.log", false, true, true},
+		{"*.log", "a.txt", false, false, false},
+		{"# a comment\n\n*.log", "# a comment", false, false, false},
+
+		// The last matching rule decides
+		{"*.log\n!keep.log", "keep.log", false, true, false},
+		{"*.log\n!keep.log", "other.log", false, true, true},
+		{"!keep.log\n*.log", "keep.log", false, true, true},
+
+		// Directory only patterns
+		{"build/", "build", true, true, true},
+		{"build/", "build", false, false, false},
+		{"build/", "sub/build", true, true, true},
+
+		// A slash anchors the pattern to the directory of the .gitignore
+		{"/root.txt", "root.txt", false, true, true},
+		{"/root.txt", "sub/root.txt", false, false, false},
+		{"doc/*.txt", "doc/a.txt", false, true, true},
+		{"doc/*.txt", "doc/sub/a.txt", false, false, false},
+		{"doc/*.txt", "sub/doc/a.txt", false, false, false},
+
+		// ** matches any number of directories
+		{"**/foo", "foo", false, true, true},
+		{"**/foo", "a/b/foo", false, true, true},
+		{"a/**/b", "a/b", false, true, true},
+		{"a/**/b", "a/x/y/b", false, true, true},
+		{"a/**/b", "x/a/b", false, false, false},
+		{"logs/**", "logs/a/b.txt", false, true, true},
+		{"logs/**", "logs", true, false, false},
+
+		// Trailing spaces and carriage returns are stripped
+		{"*.tmp  \r\n", "a.tmp", false, true, true},
+	} {
+		rules := parseGitignore(test.gitignore)
+		matched, ignored := matchIgnoreRules(rules, test.path, test.isDir)
+		if matched != test.matched || ignored != test.ignored {
+			t.Errorf("%q matching %q (dir %v) = %v, %v, expected %v, %v",
+				test.gitignore, test.path, test.isDir, matched, ignored, test.matched, test.ignored)
+		}
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		".gitignore":         "*.log\nbuild/\n",
+		"main.go":            "",
+		"debug.log":          "",
+		"build/out":          "",
+		"sub/.gitignore":     "!keep.log\n/local.txt\n",
+		"sub/keep.log":       "",
+		"sub/drop.log":       "",
+		"sub/local.txt":      "",
+		"sub/deep/local.txt": "",
+		".git/HEAD":          "",
+	}
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var found []string
+	err := walkFiles(root, make(chan struct{}), func(batch []string) {
+		for _, p := range batch {
+			rel, _ := filepath.Rel(root, p)
+			found = append(found, filepath.ToSlash(rel))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(found)
+	expected := []string{".gitignore", "main.go", "sub/.gitignore", "sub/deep/local.txt", "sub/keep.log"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("found %q, expected %q", found, expected)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+
+	"codeberg.org/wlcsm/li/core"
+)
+
+// RunCommand runs the shell command in the background, its output is shown in
+// a new buffer
+func RunCommand(e *core.E, command string) error {
+	if _, err := e.StartJob(command, nil); err != nil {
+		return err
+	}
+
+	e.SetStatusLine("$ %s: running", command)
+	return nil
+}
+
+// cancelJob cancels the command whose output is in the current buffer
+func cancelJob(e *core.E) {
+	j := e.BufferJob(e.Buffer)
+	if j == nil || !j.Running() {
+		e.SetStatusLine("no running command in this buffer")
+		return
+	}
+
+	j.Cancel()
+	e.SetStatusLine("$ %s: cancelling", j.Command)
+}
+
+// selectJob shows the commands that have been run and switches to the buffer
+// of the one the user chooses
+func selectJob(e *core.E) {
+	jobs := e.Jobs()
+	if len(jobs) == 0 {
+		e.SetStatusLine("no commands have been run")
+		return
+	}
+
+	items := make([]string, len(jobs))
+	for i, j := range jobs {
+		items[i] = fmt.Sprintf("%-10s %s", j.Status(), j.Command)
+	}
+
+	pickFromList(e, "commands ", items, len(jobs)-1, func(i int) {
+		for n, b := range e.Buffers() {
+			if b == jobs[i].Buffer() {
+				e.SwitchBuffer(n)
+				return
+			}
+		}
+		e.SetStatusLine("the output of %s was closed", jobs[i].Command)
+	})
+}
@@ -16,21 +16,68 @@ const (
 	PromptMode
 )
 
+var mode = CommandMode
+
+var modeNames = map[EditorMode]string{
+	InsertMode:  "insert",
+	CommandMode: "command",
+	PromptMode:  "prompt",
+}
+
+func (m EditorMode) String() string {
+	return modeNames[m]
+}
+
+// setMode changes the editor mode. Everything typed in a single visit to
+// insert mode is undone together.
+func setMode(e *core.E, m EditorMode) {
+	if mode == m {
+		return
+	}
+
+	if mode == InsertMode {
+		closeCompletion(e)
+		e.EndUndoGroup()
+	}
+
+	mode = m
+	e.SetMode(m.String())
+
+	switch m {
+	case InsertMode:
+		e.StartUndoGroup()
+		e.SetStatusLine("-- INSERT --")
+	case CommandMode:
+		e.SetStatusLine("")
+
+		if len(pendingRestart) != 0 {
+			restart(e, pendingRestart)
+		}
+	}
+}
+
 // ProcessKey processes a key read from stdin.
 // Returns errQuitEditor when user requests to quit.
 func ProcessKey(e *core.E, k ansi.Key) (err error) {
 	defer func() {
-		if e := recover(); e != nil {
-			err = errors.Wrap(e.(error), "panicked")
+		if r := recover(); r != nil {
+			err = errors.Errorf("panicked: %v", r)
 		}
 	}()
 
 	log.Printf("processing key: %s", string(k))
 
-	_, err = basicHandler(e, k)
-	if err != nil {
+	var handled bool
+	switch mode {
+	case InsertMode:
+		handled, err = insertModeHandler(e, k)
+	case CommandMode:
+		handled, err = commandModeHandler(e, k)
+	}
+	if handled || err != nil {
 		return err
 	}
 
-	return nil
+	_, err = basicHandler(e, k)
+	return err
 }
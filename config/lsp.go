@@ -0,0 +1,669 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+	"codeberg.org/wlcsm/li/lsp"
+)
+
+// LanguageServer is how to run the language server for a filetype
+type LanguageServer struct {
+	Command []string
+	// identifies the language of the documents to the server
+	LanguageID string
+}
+
+// LanguageServers are the language servers to use, by file extension
+var LanguageServers = map[string]LanguageServer{
+	"go": {Command: []string{"gopls"}, LanguageID: "go"},
+}
+
+// How long to wait for the language servers to shut down when quitting
+const lspShutdownTimeout = time.Second
+
+// lspServer is a running language server, there is one per file extension
+type lspServer struct {
+	name   string
+	client *lsp.Client
+	// set once the server has been initialized
+	ready bool
+
+	mu sync.Mutex
+	// the latest diagnostics for each document, they are published on the
+	// client's goroutine
+	diagnostics map[string][]lsp.Diagnostic
+	// the client while it is being initialized, and whether it should be
+	// killed as li quit meanwhile
+	starting *lsp.Client
+	killed   bool
+}
+
+// lspDoc is a buffer that is kept in sync with a language server
+type lspDoc struct {
+	server     *lspServer
+	uri        string
+	languageID string
+	version    int
+	// whether the server has been told about the document, which waits
+	// for the server to be initialized
+	opened bool
+}
+
+var (
+	lspServers = map[string]*lspServer{}
+	lspDocs    = map[*core.Buffer]*lspDoc{}
+)
+
+func lspBufferOpen(e *core.E, info core.EventInfo) error {
+	ext := strings.TrimPrefix(filepath.Ext(info.Filename), ".")
+	ls, ok := LanguageServers[ext]
+	if !ok {
+		return nil
+	}
+
+	s, ok := lspServers[ext]
+	if !ok {
+		s = startServer(e, ls)
+		lspServers[ext] = s
+	}
+
+	doc := &lspDoc{server: s, uri: lsp.FileURI(info.Filename), languageID: ls.LanguageID}
+	lspDocs[e.Buffer] = doc
+
+	if s.ready {
+		return doc.open(e.Buffer)
+	}
+	return nil
+}
+
+// startServer runs the language server in the background, the documents
+// opened in the meantime are sent to it once it is ready
+func startServer(e *core.E, ls LanguageServer) *lspServer {
+	s := &lspServer{
+		name:        strings.Join(ls.Command, " "),
+		diagnostics: map[string][]lsp.Diagnostic{},
+	}
+
+	go func() {
+		client, err := lsp.Start(ls.Command, ".")
+		if err == nil {
+			s.mu.Lock()
+			s.starting = client
+			killed := s.killed
+			s.mu.Unlock()
+			if killed {
+				client.Kill()
+				return
+			}
+
+			client.OnDiagnostics = func(p lsp.PublishDiagnosticsParams) {
+				s.mu.Lock()
+				s.diagnostics[p.URI] = p.Diagnostics
+				s.mu.Unlock()
+
+				// Don't block reading from the server while the
+				// editor is busy
+				go e.Post(func(e *core.E) {
+					s.showDiagnostics(e, p.URI)
+				})
+			}
+			err = client.Initialize(".")
+		}
+
+		e.Post(func(e *core.E) {
+			s.mu.Lock()
+			killed := s.killed
+			s.starting = nil
+			s.mu.Unlock()
+			if killed {
+				return
+			}
+
+			if err != nil {
+				e.SetStatusLine("err: %s: %s", s.name, err)
+				return
+			}
+
+			s.client = client
+			s.ready = true
+
+			for b, doc := range lspDocs {
+				if doc.server == s {
+					if err := doc.open(b); err != nil {
+						e.SetStatusLine("err: %s: %s", s.name, err)
+					}
+				}
+			}
+		})
+	}()
+
+	return s
+}
+
+func (doc *lspDoc) open(b *core.Buffer) error {
+	doc.version = 1
+	doc.opened = true
+	return doc.server.client.DidOpen(doc.uri, doc.languageID, doc.version, bufferText(b))
+}
+
+// lspClose tells the server that the buffer was closed
+func lspClose(b *core.Buffer) {
+	doc, ok := lspDocs[b]
+	if !ok {
+		return
+	}
+
+	delete(lspDocs, b)
+	if doc.opened {
+		doc.server.client.DidClose(doc.uri)
+	}
+}
+
+// bufferText is the contents of the buffer as it would be saved
+func bufferText(b *core.Buffer) string {
+	var text strings.Builder
+	for y := 0; y < b.NumRows(); y++ {
+		text.WriteString(string(b.Row(y)))
+		text.WriteByte('\n')
+	}
+	return text.String()
+}
+
+func lspBufferChanged(e *core.E, info core.EventInfo) error {
+	doc, ok := lspDocs[e.Buffer]
+	if !ok || !doc.opened {
+		return nil
+	}
+
+	c := info.Change
+
+	var change lsp.TextDocumentContentChangeEvent
+
+	switch doc.server.client.SyncKind() {
+	case lsp.SyncIncremental:
+		// Whole rows are replaced, along with their newlines
+		var text strings.Builder
+		for _, r := range c.New {
+			text.WriteString(string(r))
+			text.WriteByte('\n')
+		}
+
+		change.Range = &lsp.Range{
+			Start: lsp.Position{Line: c.Y},
+			End:   lsp.Position{Line: c.Y + len(c.Old)},
+		}
+		change.Text = text.String()
+	case lsp.SyncFull:
+		change.Text = bufferText(e.Buffer)
+	default:
+		return nil
+	}
+
+	doc.version++
+	err := doc.server.client.DidChange(doc.uri, doc.version, []lsp.TextDocumentContentChangeEvent{change})
+	if err != nil {
+		return fmt.Errorf("%s: %s", doc.server.name, err)
+	}
+	return nil
+}
+
+func lspAfterSave(e *core.E, info core.EventInfo) error {
+	doc, ok := lspDocs[e.Buffer]
+	if !ok || !doc.opened {
+		return nil
+	}
+
+	if err := doc.server.client.DidSave(doc.uri); err != nil {
+		return fmt.Errorf("%s: %s", doc.server.name, err)
+	}
+	return nil
+}
+
+// lspQuit shuts the language servers down and kills those that are still
+// starting, giving up on those that take too long so that quitting never
+// hangs. They are forgotten, so that they are
+// started again if li keeps running after all, see core.E.Reexec.
+func lspQuit(e *core.E, info core.EventInfo) error {
+	servers := lspServers
+	lspServers = map[string]*lspServer{}
+	lspDocs = map[*core.Buffer]*lspDoc{}
+
+	done := make(chan struct{}, len(servers))
+	for _, s := range servers {
+		go func(s *lspServer, ready bool) {
+			if ready {
+				s.client.Shutdown()
+			} else {
+				s.kill()
+			}
+			done <- struct{}{}
+		}(s, s.ready)
+	}
+
+	timeout := time.After(lspShutdownTimeout)
+	for n := len(servers); n > 0; n-- {
+		select {
+		case <-done:
+		case <-timeout:
+			return errors.New("language servers did not shut down")
+		}
+	}
+	return nil
+}
+
+// kill stops a server that isn't ready yet, the goroutine starting it stops it
+// if it isn't running yet
+func (s *lspServer) kill() {
+	s.mu.Lock()
+	s.killed = true
+	client := s.starting
+	s.mu.Unlock()
+
+	if client != nil {
+		client.Kill()
+	}
+}
+
+// showDiagnostics puts the diagnostics for the document in the sign column of
+// its buffer
+func (s *lspServer) showDiagnostics(e *core.E, uri string) {
+	s.mu.Lock()
+	diags := s.diagnostics[uri]
+	s.mu.Unlock()
+
+	for _, b := range e.Buffers() {
+		doc, ok := lspDocs[b]
+		if !ok || doc.server != s || doc.uri != uri {
+			continue
+		}
+
+		signs := map[int]core.Sign{}
+		severities := map[int]int{}
+		for _, d := range diags {
+			sev := d.Severity
+			if sev < lsp.SeverityError || sev > lsp.SeverityHint {
+				sev = lsp.SeverityError
+			}
+
+			// Show the most severe diagnostic of each row
+			y := d.Range.Start.Line
+			if s, ok := severities[y]; ok && s <= sev {
+				continue
+			}
+			severities[y] = sev
+
+			sign := diagnosticSigns[sev]
+			sign.Message = strings.SplitN(d.Message, "\n", 2)[0]
+			signs[y] = sign
+		}
+
+		b.SetSigns(signs)
+	}
+}
+
+// Signs shown for diagnostics, by severity
+var diagnosticSigns = map[int]core.Sign{
+	lsp.SeverityError:       {Text: "E", Color: 31},
+	lsp.SeverityWarning:     {Text: "W", Color: 33},
+	lsp.SeverityInformation: {Text: "I", Color: 34},
+	lsp.SeverityHint:        {Text: "H", Color: 36},
+}
+
+// lspCursor returns the document of the current buffer and the position of
+// the cursor in it
+func lspCursor(e *core.E) (*lspDoc, lsp.Position, error) {
+	doc, ok := lspDocs[e.Buffer]
+	if !ok {
+		return nil, lsp.Position{}, errors.New("no language server for this buffer")
+	}
+	if !doc.opened {
+		return nil, lsp.Position{}, fmt.Errorf("%s is not ready", doc.server.name)
+	}
+
+	pos := lsp.Position{Line: e.Y(), Character: lsp.ToUTF16(e.Row(e.Y()), e.X())}
+	return doc, pos, nil
+}
+
+// GotoDefinition jumps to where the symbol under the cursor is defined
+func GotoDefinition(e *core.E) error {
+	doc, pos, err := lspCursor(e)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		locs, err := doc.server.client.Definition(doc.uri, pos)
+
+		e.Post(func(e *core.E) {
+			if err != nil {
+				e.SetStatusLine("err: definition: %s", err)
+				return
+			}
+
+			lines := locationLines(e, locs)
+			switch len(lines) {
+			case 0:
+				e.SetStatusLine("no definition found")
+			case 1:
+				if err := jumpTo(e, lines[0].File, lines[0].Row, lines[0].Col); err != nil {
+					e.SetStatusLine("err: %s", err)
+				}
+			default:
+				SetQuickfix("definitions", lines)
+				QuickfixOpen(e)
+			}
+		})
+	}()
+
+	return nil
+}
+
+// FindReferences puts the uses of the symbol under the cursor in the quickfix
+// list
+func FindReferences(e *core.E) error {
+	doc, pos, err := lspCursor(e)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		locs, err := doc.server.client.References(doc.uri, pos)
+
+		e.Post(func(e *core.E) {
+			if err != nil {
+				e.SetStatusLine("err: references: %s", err)
+				return
+			}
+
+			lines := locationLines(e, locs)
+			if len(lines) == 0 {
+				e.SetStatusLine("no references found")
+				return
+			}
+
+			SetQuickfix("references", lines)
+			QuickfixOpen(e)
+		})
+	}()
+
+	return nil
+}
+
+// Hover shows the documentation of the symbol under the cursor
+func Hover(e *core.E) error {
+	doc, pos, err := lspCursor(e)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		text, err := doc.server.client.Hover(doc.uri, pos)
+
+		e.Post(func(e *core.E) {
+			if err != nil {
+				e.SetStatusLine("err: hover: %s", err)
+				return
+			}
+
+			text = strings.TrimSpace(text)
+			if len(text) == 0 {
+				e.SetStatusLine("no information")
+				return
+			}
+
+			showText(e, strings.Split(text, "\n"))
+		})
+	}()
+
+	return nil
+}
+
+// showText shows the lines above the status bar until a key is pressed
+func showText(e *core.E, lines []string) {
+	if max := e.ScreenRows() / 2; len(lines) > max {
+		lines = append(lines[:max-1], "...")
+	}
+
+	o := &core.Overlay{Selected: -1}
+	for _, l := range lines {
+		o.Lines = append(o.Lines, strings.ReplaceAll(l, "\t", "    "))
+	}
+	e.SetOverlay(o)
+
+	e.Prompt("", func(k ansi.Key) (string, bool, error) {
+		e.SetOverlay(nil)
+		return "", true, nil
+	})
+}
+
+// Rename renames the symbol under the cursor everywhere it is used. The
+// changes to each buffer are undone together.
+func Rename(e *core.E) error {
+	doc, pos, err := lspCursor(e)
+	if err != nil {
+		return err
+	}
+
+	StaticPrompt(e, "rename to: ", func(name string) error {
+		if len(name) == 0 {
+			return nil
+		}
+
+		versions := lspVersions()
+		go func() {
+			edit, err := doc.server.client.Rename(doc.uri, pos, name)
+
+			e.Post(func(e *core.E) {
+				if err == nil && editChanged(edit, versions) {
+					err = errors.New("a buffer changed, try again")
+				}
+				if err == nil {
+					err = applyWorkspaceEdit(e, edit)
+				}
+				if err != nil {
+					e.SetStatusLine("err: rename: %s", err)
+				}
+			})
+		}()
+
+		return nil
+	})
+
+	return nil
+}
+
+// Format formats the buffer with the language server
+func Format(e *core.E) error {
+	doc, _, err := lspCursor(e)
+	if err != nil {
+		return err
+	}
+
+	b := e.Buffer
+	version := doc.version
+	opts := lsp.FormattingOptions{TabSize: e.Tabstop()}
+
+	go func() {
+		edits, err := doc.server.client.Formatting(doc.uri, opts)
+
+		e.Post(func(e *core.E) {
+			if err == nil && (doc.version != version || e.Buffer != b) {
+				err = errors.New("the buffer changed, try again")
+			}
+			if err != nil {
+				e.SetStatusLine("err: format: %s", err)
+				return
+			}
+
+			applyEdits(e, edits)
+		})
+	}()
+
+	return nil
+}
+
+// lspVersions returns the versions of the documents open in buffers
+func lspVersions() map[string]int {
+	versions := map[string]int{}
+	for _, doc := range lspDocs {
+		versions[doc.uri] = doc.version
+	}
+	return versions
+}
+
+// editChanged reports whether a document that the edit changes was opened,
+// closed or edited since the versions were taken, so the edit may be out of
+// date
+func editChanged(edit lsp.WorkspaceEdit, versions map[string]int) bool {
+	now := lspVersions()
+	for uri := range edit.Edits() {
+		if now[uri] != versions[uri] {
+			return true
+		}
+	}
+	return false
+}
+
+// applyWorkspaceEdit makes the edits to each file, opening those that aren't
+// already, and then goes back to the current buffer
+func applyWorkspaceEdit(e *core.E, edit lsp.WorkspaceEdit) error {
+	current := e.Buffer
+	defer func() {
+		// The buffer is gone if it was the empty one li starts with
+		e.SwitchBuffer(core.Find(e.Buffers(), func(b *core.Buffer) bool { return b == current }))
+	}()
+
+	for uri, edits := range edit.Edits() {
+		if err := e.OpenFile(lsp.URIPath(uri)); err != nil {
+			return err
+		}
+		applyEdits(e, edits)
+	}
+
+	return nil
+}
+
+// applyEdits makes the edits to the current buffer, keeping the cursor where it
+// was
+func applyEdits(e *core.E, edits []lsp.TextEdit) {
+	x, y := e.X(), e.Y()
+
+	// Apply the last edit first so that the positions of the others stay
+	// the same. Edits at the same position are applied in the reverse of
+	// the order given so that their text ends up in that order.
+	sort.SliceStable(edits, func(i, j int) bool {
+		a, b := edits[i].Range.Start, edits[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+
+	for i := len(edits) - 1; i >= 0; i-- {
+		applyEdit(e, edits[i])
+	}
+
+	e.SetY(y)
+	e.SetX(x)
+}
+
+func applyEdit(e *core.E, edit lsp.TextEdit) {
+	start, end := edit.Range.Start, edit.Range.End
+	text := edit.NewText
+	last := e.NumRows() - 1
+
+	// The document ends with a newline, so the position after the last row
+	// is the start of an empty line that doesn't exist in the buffer
+	if start.Line > last {
+		text = strings.TrimSuffix(text, "\n")
+		if len(text) != 0 {
+			e.InsertRows(last+1, splitRows(text)...)
+		}
+		return
+	}
+
+	x2 := 0
+	if end.Line > last {
+		end.Line = last
+		x2 = len(e.Row(last))
+		text = strings.TrimSuffix(text, "\n")
+	} else {
+		x2 = lsp.FromUTF16(e.Row(end.Line), end.Character)
+	}
+
+	x1 := lsp.FromUTF16(e.Row(start.Line), start.Character)
+	e.ReplaceText(start.Line, x1, end.Line, x2, text)
+}
+
+func splitRows(text string) [][]rune {
+	lines := strings.Split(text, "\n")
+
+	rows := make([][]rune, len(lines))
+	for i, l := range lines {
+		rows[i] = []rune(l)
+	}
+	return rows
+}
+
+// locationLines converts the locations into quickfix lines
+func locationLines(e *core.E, locs []lsp.Location) []Line {
+	files := map[string][]string{}
+	wd, _ := os.Getwd()
+
+	var lines []Line
+	for _, loc := range locs {
+		file := lsp.URIPath(loc.URI)
+		if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+
+		if _, ok := files[file]; !ok {
+			files[file] = fileLines(e, file)
+		}
+
+		text := ""
+		col := 0
+		if y := loc.Range.Start.Line; y < len(files[file]) {
+			text = files[file][y]
+			row := []rune(text)
+			col = len(string(row[:lsp.FromUTF16(row, loc.Range.Start.Character)]))
+		}
+
+		lines = append(lines, Line{
+			File: file,
+			Row:  loc.Range.Start.Line + 1,
+			Col:  col + 1,
+			Orig: fmt.Sprintf("%s:%d:%d: %s", file, loc.Range.Start.Line+1, col+1, strings.TrimSpace(text)),
+		})
+	}
+
+	return lines
+}
+
+// fileLines returns the lines of the file, from its buffer if it is open as it
+// may have unsaved changes
+func fileLines(e *core.E, file string) []string {
+	abs, _ := filepath.Abs(file)
+
+	for _, b := range e.Buffers() {
+		if babs, _ := filepath.Abs(b.Filename()); babs == abs {
+			lines := make([]string, b.NumRows())
+			for y := range lines {
+				lines[y] = string(b.Row(y))
+			}
+			return lines
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"codeberg.org/wlcsm/li/core"
+	"codeberg.org/wlcsm/li/lsp"
+)
+
+func TestEditChanged(t *testing.T) {
+	defer func(docs map[*core.Buffer]*lspDoc) { lspDocs = docs }(lspDocs)
+
+	a := &lspDoc{uri: "file:///a.go", version: 3}
+	b := &lspDoc{uri: "file:///b.go", version: 1}
+	lspDocs = map[*core.Buffer]*lspDoc{{}: a, {}: b}
+	versions := lspVersions()
+
+	edit := func(uris ...string) lsp.WorkspaceEdit {
+		w := lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{}}
+		for _, uri := range uris {
+			w.Changes[uri] = []lsp.TextEdit{{NewText: "x"}}
+		}
+		return w
+	}
+
+	a.version++
+	for _, test := range []struct {
+		uris    []string
+		changed bool
+	}{
+		{[]string{"file:///b.go"}, false},
+		{[]string{"file:///b.go", "file:///a.go"}, true},
+		// Files that aren't open weren't edited in li
+		{[]string{"file:///c.go"}, false},
+	} {
+		if changed := editChanged(edit(test.uris...), versions); changed != test.changed {
+			t.Errorf("edit of %q changed %v, expected %v", test.uris, changed, test.changed)
+		}
+	}
+
+	// A buffer opened since is newer than the edit too
+	lspDocs[&core.Buffer{}] = &lspDoc{uri: "file:///c.go", version: 1}
+	if !editChanged(edit("file:///c.go"), versions) {
+		t.Errorf("edit of a file opened since didn't change")
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"unicode"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+)
+
+// the register of the macro that was last replayed, for "@@"
+var lastMacro string
+
+// macroRegister returns the register named by the key, registers are named by
+// a letter
+func macroRegister(k ansi.Key) (string, error) {
+	if !unicode.IsLetter(rune(k)) {
+		return "", fmt.Errorf("registers are named by a letter, not %s", k)
+	}
+	return string(k), nil
+}
+
+// startRecording records a macro into the register named by the key
+func startRecording(e *core.E, k ansi.Key) error {
+	reg, err := macroRegister(k)
+	if err != nil {
+		return err
+	}
+
+	e.StartRecording(reg)
+	return nil
+}
+
+func stopRecording(e *core.E) {
+	reg := e.Recording()
+	e.StopRecording()
+	e.SetStatusLine("recorded @%s: %s", reg, e.Register(reg))
+}
+
+// replayMacro replays the macro in the register named by the key count times,
+// "@@" replays the last one again
+func replayMacro(e *core.E, k ansi.Key, count int) error {
+	reg := lastMacro
+	if k != ansi.Key('@') {
+		var err error
+		if reg, err = macroRegister(k); err != nil {
+			return err
+		}
+	}
+	if len(reg) == 0 {
+		return fmt.Errorf("no macro has been replayed")
+	}
+
+	keys := ansi.ParseKeys(e.Register(reg))
+	if len(keys) == 0 {
+		return fmt.Errorf("register %s is empty", reg)
+	}
+
+	if count == 0 {
+		count = 1
+	}
+
+	lastMacro = reg
+	if err := e.Replay(keys, count); err != nil {
+		return fmt.Errorf("@%s: %w", reg, err)
+	}
+	return nil
+}
+
+// editMacro lets the user change the macro in the register named by the key
+func editMacro(e *core.E, k ansi.Key) error {
+	reg, err := macroRegister(k)
+	if err != nil {
+		return err
+	}
+
+	editPrompt(e, "", "@"+reg+": ", e.Register(reg), func(keys string) error {
+		e.SetRegister(reg, keys)
+		e.SetStatusLine("changed @%s", reg)
+		return nil
+	})
+	return nil
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"unicode"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+)
+
+// setMark puts the mark named by the key at the cursor, marks are named by a
+// letter
+func setMark(e *core.E, k ansi.Key) error {
+	if !unicode.IsLetter(rune(k)) {
+		return fmt.Errorf("marks are named by a letter, not %q", rune(k))
+	}
+
+	e.SetMark(string(k), e.Cursor())
+	return nil
+}
+
+// gotoMark jumps to the mark named by the key
+func gotoMark(e *core.E, k ansi.Key) error {
+	pos, ok := e.Mark(string(k))
+	if !ok {
+		return fmt.Errorf("mark %q is not set", rune(k))
+	}
+
+	e.PushJump()
+	e.GoTo(pos)
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+)
+
+// Maximum number of items shown by a picker
+const pickerHeight = 10
+
+// pickFromList shows the items above the status bar and calls pick with the
+// index of the one the user chooses. The list starts with selected chosen.
+func pickFromList(e *core.E, title string, items []string, selected int, pick func(i int)) {
+	if len(items) == 0 {
+		return
+	}
+
+	offset := 0
+
+	show := func() {
+		// Scroll so that the selection is visible
+		if selected < offset {
+			offset = selected
+		}
+		if selected >= offset+pickerHeight {
+			offset = selected - pickerHeight + 1
+		}
+
+		end := offset + pickerHeight
+		if end > len(items) {
+			end = len(items)
+		}
+
+		o := &core.Overlay{Selected: selected - offset}
+		for _, item := range items[offset:end] {
+			o.Lines = append(o.Lines, "  "+item)
+		}
+		e.SetOverlay(o)
+	}
+
+	show()
+
+	e.Prompt(title, func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.EnterKey, ansi.CarriageReturnKey:
+			e.SetOverlay(nil)
+			pick(selected)
+			return "", true, nil
+		case ansi.EscapeKey, ansi.Ctrl('q'), ansi.Ctrl('c'):
+			e.SetOverlay(nil)
+			return "", true, nil
+		case ansi.UpArrowKey, ansi.Ctrl('p'), ansi.Key('k'):
+			selected--
+		case ansi.DownArrowKey, ansi.Ctrl('n'), ansi.Key('j'), ansi.Key('\t'):
+			selected++
+		case ansi.PageUpKey:
+			selected -= pickerHeight
+		case ansi.PageDownKey:
+			selected += pickerHeight
+		}
+
+		if selected >= len(items) {
+			selected = len(items) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+
+		show()
+		return "", false, nil
+	})
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"codeberg.org/wlcsm/li/core"
+)
+
+// MakeCommand is run by "gm" to build the project, the errors it reports are
+// put in the quickfix list
+var MakeCommand = "go build ./... && go vet ./..."
+
+// The quickfix list holds locations, such as search results or compiler
+// errors, that can be visited one after another
+var quickfix struct {
+	title string
+	lines []Line
+	// the entry that was last jumped to
+	index int
+}
+
+// SetQuickfix replaces the quickfix list with the lines that have a location
+func SetQuickfix(title string, lines []Line) {
+	quickfix.title = title
+	quickfix.lines = nil
+	quickfix.index = 0
+
+	for _, l := range lines {
+		if len(l.File) != 0 {
+			quickfix.lines = append(quickfix.lines, l)
+		}
+	}
+}
+
+func QuickfixNext(e *core.E) error {
+	if len(quickfix.lines) == 0 {
+		return errors.New("quickfix list is empty")
+	}
+	if quickfix.index+1 >= len(quickfix.lines) {
+		return errors.New("at the end of the quickfix list")
+	}
+
+	quickfix.index++
+	return quickfixJump(e)
+}
+
+func QuickfixPrev(e *core.E) error {
+	if len(quickfix.lines) == 0 {
+		return errors.New("quickfix list is empty")
+	}
+	if quickfix.index == 0 {
+		return errors.New("at the start of the quickfix list")
+	}
+
+	quickfix.index--
+	return quickfixJump(e)
+}
+
+// QuickfixOpen shows the quickfix list and jumps to the entry the user chooses
+func QuickfixOpen(e *core.E) {
+	if len(quickfix.lines) == 0 {
+		e.SetStatusLine("quickfix list is empty")
+		return
+	}
+
+	items := make([]string, len(quickfix.lines))
+	for i, l := range quickfix.lines {
+		items[i] = l.Orig
+	}
+
+	pickFromList(e, quickfix.title+" ", items, quickfix.index, func(i int) {
+		quickfix.index = i
+		if err := quickfixJump(e); err != nil {
+			e.SetStatusLine("err: %s", err)
+		}
+	})
+}
+
+func quickfixJump(e *core.E) error {
+	l := quickfix.lines[quickfix.index]
+	if err := jumpTo(e, l.File, l.Row, l.Col); err != nil {
+		return err
+	}
+
+	e.SetStatusLine("(%d/%d) %s", quickfix.index+1, len(quickfix.lines), l.Orig)
+	return nil
+}
+
+// jumpTo opens the file and moves the cursor to the row and column, which
+// start from 1. The column is in bytes as that is what tools report.
+func jumpTo(e *core.E, file string, row, col int) error {
+	// Don't create files that don't exist like opening them normally would
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+
+	e.PushJump()
+	if err := e.OpenFile(file); err != nil {
+		return err
+	}
+
+	e.SetY(row - 1)
+
+	x := 0
+	if col > 0 {
+		line := string(e.Row(e.Y()))
+		if col-1 < len(line) {
+			line = line[:col-1]
+		}
+		x = len([]rune(line))
+	}
+	e.SetX(x)
+
+	// Show the line in the middle of the screen
+	e.SetRowOffset(e.Y() - e.ScreenRows()/2)
+
+	return nil
+}
+
+// Grep searches the files in the working directory for the regular expression
+// and puts the matches in the quickfix list. ripgrep is used if it is
+// installed.
+func Grep(e *core.E, pattern string) {
+	e.SetStatusLine("searching for %s...", pattern)
+
+	go func() {
+		lines, err := grep(pattern)
+
+		e.Post(func(e *core.E) {
+			if err != nil {
+				e.SetStatusLine("err: %s", err)
+				return
+			}
+			if len(lines) == 0 {
+				e.SetStatusLine("no matches for %s", pattern)
+				return
+			}
+
+			SetQuickfix("grep "+pattern, lines)
+			if err := quickfixJump(e); err != nil {
+				e.SetStatusLine("err: %s", err)
+			}
+		})
+	}()
+}
+
+func grep(pattern string) ([]Line, error) {
+	if _, err := exec.LookPath("rg"); err != nil {
+		return searchFiles(pattern)
+	}
+
+	out, err := exec.Command("rg", "--vimgrep", "--color=never", "--", pattern).Output()
+
+	// ripgrep exits with 1 when nothing matched
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateList(string(out)), nil
+}
+
+// searchFiles is the builtin replacement for ripgrep. Like ripgrep it skips
+// files ignored by .gitignore files and binary files.
+func searchFiles(pattern string) ([]Line, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []Line
+	err = walkFiles(".", nil, func(batch []string) {
+		for _, file := range batch {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+
+			// Binary files have NUL bytes near the start
+			head := data
+			if len(head) > 8000 {
+				head = head[:8000]
+			}
+			if bytes.IndexByte(head, 0) != -1 {
+				continue
+			}
+
+			for i, l := range bytes.Split(data, []byte("\n")) {
+				loc := re.FindIndex(l)
+				if loc == nil {
+					continue
+				}
+
+				text := strings.TrimRight(string(l), "\r")
+				lines = append(lines, Line{
+					File: file,
+					Row:  i + 1,
+					Col:  loc[0] + 1,
+					Orig: fmt.Sprintf("%s:%d:%d:%s", file, i+1, loc[0]+1, text),
+				})
+			}
+		}
+	})
+
+	return lines, err
+}
+
+// Make runs the command, e.g. a build or linter, and puts the errors it
+// reports in the quickfix list
+func Make(e *core.E, command string) {
+	e.SetStatusLine("running %s...", command)
+
+	go func() {
+		out, err := exec.Command("sh", "-c", command).CombinedOutput()
+
+		e.Post(func(e *core.E) {
+			SetQuickfix(command, CreateList(string(out)))
+
+			if len(quickfix.lines) == 0 {
+				if err != nil {
+					e.SetStatusLine("%s: %s", command, err)
+				} else {
+					e.SetStatusLine("%s: ok", command)
+				}
+				return
+			}
+
+			if err := quickfixJump(e); err != nil {
+				e.SetStatusLine("err: %s", err)
+			}
+		})
+	}()
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"codeberg.org/wlcsm/li/core"
+)
+
+// SourceDir is the li source tree that Rebuild builds, by default the one that
+// the running li was built from
+var SourceDir = sourceDir()
+
+func sourceDir() string {
+	// This file is config/rebuild.go in the source tree
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "."
+	}
+	return filepath.Dir(filepath.Dir(file))
+}
+
+// the new build of li when it couldn't restart straight away, because it was
+// built while not in command mode or while a prompt was open or a job was
+// running. It is tried again once back in command mode and when idle.
+var pendingRestart string
+
+// Rebuild builds li in the background and replaces the running li with the new
+// build, keeping the open buffers. The errors of a failed build are put in the
+// quickfix list.
+func Rebuild(e *core.E) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	e.SetStatusLine("building li...")
+
+	go func() {
+		cmd := exec.Command("go", "build", "-o", exe, ".")
+		cmd.Dir = SourceDir
+		out, err := cmd.CombinedOutput()
+
+		e.Post(func(e *core.E) {
+			if err == nil {
+				restart(e, exe)
+				return
+			}
+
+			// The errors are relative to the source tree
+			lines := CreateList(string(out))
+			for i := range lines {
+				if len(lines[i].File) != 0 && !filepath.IsAbs(lines[i].File) {
+					lines[i].File = filepath.Join(SourceDir, lines[i].File)
+				}
+			}
+
+			SetQuickfix("go build", lines)
+			if len(quickfix.lines) == 0 {
+				e.SetStatusLine("err: building li: %s", err)
+				return
+			}
+
+			if err := quickfixJump(e); err != nil {
+				e.SetStatusLine("err: %s", err)
+			}
+		})
+	}()
+
+	return nil
+}
+
+// restart replaces li with the new build at exe
+func restart(e *core.E, exe string) {
+	pendingRestart = exe
+
+	// Don't interrupt the user in the middle of something
+	if mode != CommandMode {
+		e.SetStatusLine("li was rebuilt, it will restart in command mode")
+		return
+	}
+
+	e.SetStatusLine("restarted li")
+	err := e.Reexec(exe)
+	if errors.Is(err, core.ErrBusy) {
+		e.SetStatusLine("li was rebuilt, it will restart when it can: %s", err)
+	} else if err != nil {
+		pendingRestart = ""
+		e.SetStatusLine("err: %s", err)
+	}
+}
+
+// retryRestart restarts li if it was rebuilt but couldn't restart before
+func retryRestart(e *core.E, _ core.EventInfo) error {
+	if len(pendingRestart) == 0 || mode != CommandMode {
+		return nil
+	}
+
+	// That li can't restart yet was already said
+	status := e.StatusLine()
+	e.SetStatusLine("restarted li")
+	err := e.Reexec(pendingRestart)
+	if errors.Is(err, core.ErrBusy) {
+		e.SetStatusLine("%s", status)
+		return nil
+	}
+
+	// Trying again would fail the same way
+	pendingRestart = ""
+	return err
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"codeberg.org/wlcsm/li/core"
+)
+
+// Surround commands, like vim-surround:
+//
+//	ds<object>         delete the brackets, quotes or tags around the cursor
+//	cs<object><with>   change them to others
+//	gs<object><with>   surround a text object, or the selection, with others
+//
+// The objects are those of core.TextObject, and for gs start with i or a for
+// the inside of the brackets, quotes or tags or around them, e.g. "gsiw(" puts
+// the word at the cursor in brackets. Surrounding with t asks for the tag.
+
+// deleteSurround asks for the object to delete the surrounding of
+func deleteSurround(e *core.E) {
+	e.Prompt("delete surrounding: ", func(k ansi.Key) (string, bool, error) {
+		if k == ansi.EscapeKey {
+			return "", true, nil
+		}
+
+		if !e.DeleteSurround(e.Cursor(), rune(k)) {
+			return "", true, fmt.Errorf("no %c around the cursor", rune(k))
+		}
+		return "", true, nil
+	})
+}
+
+// changeSurround asks for the object to change the surrounding of and what to
+// change it to
+func changeSurround(e *core.E) {
+	var obj rune
+	e.Prompt("change surrounding: ", func(k ansi.Key) (string, bool, error) {
+		if k == ansi.EscapeKey {
+			return "", true, nil
+		}
+		if obj == 0 {
+			obj = rune(k)
+			return string(obj) + " to ", false, nil
+		}
+
+		err := surroundWith(e, rune(k), func(open, close string) error {
+			if !e.ChangeSurround(e.Cursor(), obj, open, close) {
+				return fmt.Errorf("no %c around the cursor", obj)
+			}
+			return nil
+		})
+		return "", true, err
+	})
+}
+
+// addSurround asks for the text object to surround, unless there is a
+// selection, and what to surround it with
+func addSurround(e *core.E) {
+	var start, end core.Position
+
+	if sel, ok := e.Selection(); ok {
+		from, to := sel.Ordered()
+		start, end = from, to
+		// The selection includes the rune at its end
+		if end.X < len(e.Row(end.Y)) {
+			end.X++
+		}
+
+		e.Prompt("surround with: ", func(k ansi.Key) (string, bool, error) {
+			if k == ansi.EscapeKey {
+				return "", true, nil
+			}
+
+			e.ClearSelection()
+			err := surroundWith(e, rune(k), func(open, close string) error {
+				e.Surround(start, end, open, close)
+				return nil
+			})
+			return "", true, err
+		})
+		return
+	}
+
+	var keys []rune
+	found := false
+	e.Prompt("surround: ", func(k ansi.Key) (string, bool, error) {
+		if k == ansi.EscapeKey {
+			return "", true, nil
+		}
+
+		if found {
+			err := surroundWith(e, rune(k), func(open, close string) error {
+				e.Surround(start, end, open, close)
+				return nil
+			})
+			return "", true, err
+		}
+
+		keys = append(keys, rune(k))
+		if keys[0] == 'i' || keys[0] == 'a' {
+			if len(keys) == 1 {
+				return string(keys), false, nil
+			}
+
+			var ok bool
+			start, end, ok = e.TextObject(e.Cursor(), keys[1], keys[0] == 'i')
+			if !ok {
+				return "", true, fmt.Errorf("no %c around the cursor", keys[1])
+			}
+		} else {
+			var ok bool
+			start, end, ok = e.TextObject(e.Cursor(), keys[0], false)
+			if !ok {
+				return "", true, fmt.Errorf("no %c at the cursor", keys[0])
+			}
+		}
+
+		found = true
+		return string(keys) + " with ", false, nil
+	})
+}
+
+// surroundWith calls f with the opening and closing text for r, asking for
+// the tag when r is t
+func surroundWith(e *core.E, r rune, f func(open, close string) error) error {
+	if r == 't' {
+		HistoryPrompt(e, PromptHistory, "tag: ", func(tag string) error {
+			tag = strings.TrimSpace(tag)
+			if len(tag) == 0 {
+				return nil
+			}
+
+			// Attributes are only on the opening tag
+			name := strings.Fields(tag)[0]
+			return f("<"+tag+">", "</"+name+">")
+		})
+		return nil
+	}
+
+	open, close, ok := e.SurroundPair(r)
+	if !ok {
+		return fmt.Errorf("can't surround with %c", r)
+	}
+	return f(open, close)
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Buffer is a file loaded into the editor. The editor can have several
+// buffers open but only one of them is displayed at a time.
+type Buffer struct {
+	filename string
+	// scratch buffers aren't files, e.g. the output of a command. They
+	// are never modified so never need saving, and their changes aren't
+	// kept to be undone.
+	scratch bool
+	// name shown for a scratch buffer
+	name string
+
+	// specify which syntax highlight to use.
+	syntax *EditorSyntax
+
+	// file content
+	rows []*Row
+
+	// cursor coordinates
+	cx, cy int // cx is an index into Row.chars
+	rx     int // rx is an index into []rune(Row.render)
+
+	// Row offset is the number of rows above the row on the top of the screen
+	// Offset is calculated in the number of runes
+	rowOffset int
+	colOffset int
+
+	// whether or not the file has been modified
+	modified bool
+
+	// version is incremented on every modification of the rows. It lets
+	// periodic tasks, such as writing the swap file, know if they have
+	// work to do
+	version int
+
+	// undo history, see change.go
+	undo    []undoUnit
+	redo    []undoUnit
+	pending undoUnit
+	// number of unfinished calls to StartUndoGroup
+	undoDepth int
+
+	// swap file of the buffer, empty if we don't own one
+	swapPath    string
+	swapVersion int
+
+	// state of the file when we last read or wrote it
+	diskInfo os.FileInfo
+	// latest state of the file that the user has been told about
+	seenInfo os.FileInfo
+
+	// signs shown next to rows, by row, see sign.go
+	signs map[int]Sign
+	// marks by name, see mark.go
+	marks map[string]Position
+	// text selected with the mouse, see mouse.go
+	selection *Selection
+	// how the rows are indented, or zero for the default, see indent.go
+	indent Indent
+	// width of a tab, or zero for the default, and how the file is
+	// written, see editorconfig.go
+	tabstop    int
+	fileFormat fileFormat
+}
+
+var ErrUnsavedChanges = errors.New("buffer has unsaved changes")
+
+func (b *Buffer) Filename() string {
+	return b.filename
+}
+
+// Name is the name to show for the buffer, its filename unless it is a scratch
+// buffer
+func (b *Buffer) Name() string {
+	if b.scratch {
+		return b.name
+	}
+	return b.filename
+}
+
+func (b *Buffer) Modified() bool {
+	return b.modified
+}
+
+// markModified records that the rows have been changed
+func (b *Buffer) markModified() {
+	b.modified = !b.scratch
+	b.version++
+}
+
+// isEmpty reports whether the buffer is an unnamed buffer that was never
+// edited, like the one li starts with when not given a file
+func (b *Buffer) isEmpty() bool {
+	return len(b.filename) == 0 && !b.scratch && !b.modified && len(b.rows) == 1 && len(b.rows[0].chars) == 0
+}
+
+// Buffers returns all open buffers in the order they were opened
+func (e *E) Buffers() []*Buffer {
+	return e.buffers
+}
+
+// BufferIndex returns the index of the current buffer in Buffers
+func (e *E) BufferIndex() int {
+	return Find(e.buffers, func(b *Buffer) bool { return b == e.Buffer })
+}
+
+// Unsaved returns the buffers with unsaved changes
+func (e *E) Unsaved() []*Buffer {
+	var unsaved []*Buffer
+	for _, b := range e.buffers {
+		if b.modified {
+			unsaved = append(unsaved, b)
+		}
+	}
+	return unsaved
+}
+
+// findBuffer returns the index of the buffer editing filename, or -1 if it
+// isn't open
+func (e *E) findBuffer(filename string) int {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return -1
+	}
+
+	return Find(e.buffers, func(b *Buffer) bool {
+		if len(b.filename) == 0 {
+			return false
+		}
+
+		babs, err := filepath.Abs(b.filename)
+		return err == nil && babs == abs
+	})
+}
+
+// SwitchBuffer makes the i'th buffer the current one
+func (e *E) SwitchBuffer(i int) {
+	if i < 0 || i >= len(e.buffers) || e.buffers[i] == e.Buffer {
+		return
+	}
+
+	e.commitUndo()
+
+	e.alternate = e.Buffer
+	e.Buffer = e.buffers[i]
+}
+
+func (e *E) NextBuffer() {
+	e.SwitchBuffer((e.BufferIndex() + 1) % len(e.buffers))
+}
+
+func (e *E) PrevBuffer() {
+	e.SwitchBuffer((e.BufferIndex() + len(e.buffers) - 1) % len(e.buffers))
+}
+
+// AlternateBuffer switches to the buffer that was edited before the current one
+func (e *E) AlternateBuffer() {
+	if e.alternate == nil {
+		return
+	}
+
+	e.SwitchBuffer(Find(e.buffers, func(b *Buffer) bool { return b == e.alternate }))
+}
+
+// addBuffer adds b to the buffer list and makes it the current buffer
+func (e *E) addBuffer(b *Buffer) {
+	e.buffers = append(e.buffers, b)
+	e.SwitchBuffer(len(e.buffers) - 1)
+}
+
+// CloseBuffer closes the buffer. If it has unsaved changes then
+// ErrUnsavedChanges is returned unless force is set.
+func (e *E) CloseBuffer(b *Buffer, force bool) error {
+	if b.modified && !force {
+		return ErrUnsavedChanges
+	}
+
+	e.removeBuffer(b)
+	return nil
+}
+
+// removeBuffer removes b from the buffer list. There is always at least one
+// buffer, an empty one is created if b is the last.
+func (e *E) removeBuffer(b *Buffer) {
+	i := Find(e.buffers, func(o *Buffer) bool { return o == b })
+	if i == -1 {
+		return
+	}
+
+	b.removeSwap()
+	e.session.recordFile(b)
+	e.forgetJumps(b)
+	e.buffers = append(e.buffers[:i], e.buffers[i+1:]...)
+
+	// There is nowhere for the output to go
+	if j := e.BufferJob(b); j != nil {
+		j.Cancel()
+	}
+
+	if e.alternate == b {
+		e.alternate = nil
+	}
+
+	if len(e.buffers) == 0 {
+		e.buffers = []*Buffer{{rows: []*Row{{}}}}
+	}
+
+	if e.Buffer == b {
+		// Prefer going back to the buffer we were editing before
+		next := e.alternate
+		if next == nil {
+			if i >= len(e.buffers) {
+				i = len(e.buffers) - 1
+			}
+			next = e.buffers[i]
+		}
+
+		e.Buffer = next
+		e.alternate = nil
+	}
+}
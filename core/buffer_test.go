@@ -0,0 +1,19 @@
+package core
+
+import "testing"
+
+func TestCloseBuffer(t *testing.T) {
+	e := newTestEditor(nil, "a")
+	other := &Buffer{rows: []*Row{{chars: []rune("b")}}, modified: true}
+	e.buffers = append(e.buffers, other)
+
+	if err := e.CloseBuffer(other, false); err != ErrUnsavedChanges {
+		t.Errorf("closing a modified buffer gives %v", err)
+	}
+	if err := e.CloseBuffer(other, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.buffers) != 1 || e.buffers[0] != e.Buffer {
+		t.Errorf("closed the current buffer instead of the other one")
+	}
+}
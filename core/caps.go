@@ -0,0 +1,215 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"github.com/pkg/errors"
+)
+
+// Caps is what the terminal supports. It is worked out from TERM and
+// COLORTERM, then from the terminal's replies to queries when li starts.
+type Caps struct {
+	// Name of the terminal, with its version when the terminal says it
+	Name string
+	// Number of colors: 0 for none, 8, 16, 256 or 1<<24 for direct color
+	Colors int
+	// Whether there is an alternate screen, which leaves the shell's screen
+	// as it was when li exits
+	AltScreen bool
+	// Whether the terminal can report these, see the Enable functions in
+	// term.go and mouse.go
+	Mouse             bool
+	BracketedPaste    bool
+	KeyboardProtocols bool
+	// Whether the terminal can draw a frame at once (mode 2026), which stops
+	// the screen flickering while it is drawn
+	SyncOutput bool
+	// Whether the clipboard can be set with OSC 52
+	Clipboard bool
+	// Whether the terminal is sent the queries, terminals that don't know
+	// them may print them
+	Queries bool
+}
+
+// How long to wait for the replies to the queries before drawing the screen.
+// Replies that come later are still used.
+const capsTimeout = 200 * time.Millisecond
+
+// The queries that are sent to the terminal
+const capsQueries = "\x1b[>0q" + // XTVERSION, name and version
+	"\x1b[>c" + // DA2, type of terminal
+	"\x1b[?2026$p" + // DECRQM, whether synchronized output is supported
+	"\x1bP+q636f6c6f7273\x1b\\" + // XTGETTCAP, number of colors
+	"\x1b[c" // DA1, which all terminals reply to so it is last
+
+// Terminals that set the clipboard with OSC 52 and have direct color, by the
+// start of their XTVERSION name
+var modernTerminals = []string{"kitty", "WezTerm", "foot", "iTerm2", "ghostty", "contour", "Alacritty"}
+
+// Names of the terminal types of DA2
+var da2Names = map[int]string{
+	41: "xterm",
+	77: "mintty",
+	83: "screen",
+	84: "tmux",
+}
+
+// detectCaps works out what the terminal supports from its TERM and
+// COLORTERM
+func detectCaps(term, colorterm string) Caps {
+	c := Caps{Name: term}
+
+	switch {
+	case len(term) == 0 || term == "dumb":
+		return c
+	case strings.HasPrefix(term, "vt"):
+		// Serial terminals, such as the VT100, without xterm's extensions
+		return c
+	case term == "linux":
+		c.Colors = 8
+		return c
+	}
+
+	// Other terminals, including screen and tmux, are taken to be like xterm
+	c.Colors = 8
+	c.AltScreen = true
+	c.Mouse = true
+	c.BracketedPaste = true
+	c.KeyboardProtocols = true
+	c.Queries = true
+
+	switch {
+	case strings.Contains(term, "256color"):
+		c.Colors = 256
+	case strings.Contains(term, "16color"):
+		c.Colors = 16
+	}
+	if colorterm == "truecolor" || colorterm == "24bit" {
+		c.Colors = 1 << 24
+	}
+	return c
+}
+
+// update adds what the reply says about the terminal. It returns true for the
+// reply to DA1, which is the last query.
+func (c *Caps) update(r ansi.Reply) bool {
+	switch {
+	// DA1: ESC [ ? <class> ; <attributes> c
+	case r.Kind == '[' && r.Marker == '?' && r.Final == 'c':
+		for i, attr := range r.Params {
+			// 52 is clipboard access
+			if i > 0 && attr == 52 {
+				c.Clipboard = true
+			}
+		}
+		return true
+
+	// DA2: ESC [ > <type> ; <version> ; <keyboard> c
+	case r.Kind == '[' && r.Marker == '>' && r.Final == 'c':
+		// XTVERSION replies first and has a better name
+		if len(r.Params) == 0 {
+			break
+		}
+		if name, ok := da2Names[r.Params[0]]; ok && !strings.ContainsRune(c.Name, '(') {
+			c.Name = name
+		}
+
+	// DECRPM: ESC [ ? <mode> ; <state> $ y
+	case r.Kind == '[' && r.Marker == '?' && r.Intermediate == "$" && r.Final == 'y':
+		if len(r.Params) == 2 && r.Params[0] == 2026 {
+			// 0 is not recognized and 4 permanently reset
+			c.SyncOutput = r.Params[1] >= 1 && r.Params[1] <= 3
+		}
+
+	// XTVERSION: DCS > | <name> ST
+	case r.Kind == 'P' && strings.HasPrefix(r.Data, ">|"):
+		c.Name = r.Data[2:]
+		for _, t := range modernTerminals {
+			if strings.HasPrefix(c.Name, t) {
+				c.Clipboard = true
+				c.Colors = 1 << 24
+			}
+		}
+
+	// XTGETTCAP: DCS 1 + r <name> = <value> ST, in hex
+	case r.Kind == 'P' && strings.HasPrefix(r.Data, "1+r"):
+		name, value, _ := strings.Cut(r.Data[3:], "=")
+		n, _ := hex.DecodeString(name)
+		v, _ := hex.DecodeString(value)
+		if colors, err := strconv.Atoi(string(v)); string(n) == "colors" && err == nil && colors > c.Colors {
+			c.Colors = colors
+		}
+	}
+	return false
+}
+
+// probeTerminal queries the terminal and waits a moment for its replies, which
+// d decodes until then. It returns the other input that arrived meanwhile.
+func (e *E) probeTerminal(d *ansi.Decoder, inputs <-chan input) []input {
+	if !e.caps.Queries {
+		return nil
+	}
+
+	d.ExpectReplies(true)
+	defer d.ExpectReplies(false)
+	os.Stdout.WriteString(capsQueries)
+
+	var other []input
+	timeout := time.NewTimer(capsTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case in := <-inputs:
+			if in.key != ansi.ReplyKey {
+				other = append(other, in)
+			} else if e.caps.update(in.reply) {
+				log.Printf("terminal: %+v", e.caps)
+				return other
+			}
+		case <-timeout.C:
+			log.Printf("terminal didn't reply in time: %+v", e.caps)
+			return other
+		}
+	}
+}
+
+// Caps returns what the terminal supports
+func (e *E) Caps() Caps {
+	return e.caps
+}
+
+// color returns the SGR sequence for the color, or the nearest color the
+// terminal has
+func (e *E) color(c int) []byte {
+	switch {
+	case c == InvertedColor || c == NotInvertedColor:
+	case e.caps.Colors == 0:
+		return nil
+	case e.caps.Colors < 16 && (c >= 90 && c <= 97 || c >= 100 && c <= 107):
+		// Bright colors are the normal ones
+		c -= 60
+	}
+	return getColor(c)
+}
+
+// SetClipboard puts the text in the system clipboard, through the terminal
+func (e *E) SetClipboard(text string) error {
+	if !e.caps.Clipboard {
+		name := e.caps.Name
+		if len(name) == 0 {
+			name = "the terminal"
+		}
+		return errors.Errorf("%s can't set the clipboard", name)
+	}
+
+	os.Stdout.WriteString("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a")
+	return nil
+}
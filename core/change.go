@@ -1,69 +1,156 @@
 package core
 
-import (
-	"log"
-)
-
+// Change replaces the rows starting at Y. The rows in Old are removed and
+// replaced with New, so inserting rows has no Old rows and deleting rows has no
+// New rows.
+//
+// Every modification of the rows is recorded as a Change so that it can be
+// undone. All the changes made while handling a single event (e.g. a key
+// press) are undone together, use StartUndoGroup and EndUndoGroup to make a
+// larger group.
 type Change struct {
-	New map[int][]rune
-	Old map[int][]rune
+	Y   int
+	Old [][]rune
+	New [][]rune
 }
 
-func Insert(y int, r *Row) Change {
-	return Change{
-		New: map[int][]rune{},
-		Old: map[int][]rune{},
-	}
+func (c Change) Undo() Change {
+	return Change{Y: c.Y, Old: c.New, New: c.Old}
 }
 
-func Edit(y int, r []rune) Change {
-	return Change{
-		New: map[int][]rune{y: r},
-		Old: map[int][]rune{},
-	}
+// A group of changes undone together
+type undoUnit struct {
+	changes []Change
+	// cursor position before the first change
+	cx, cy int
 }
 
-func Delete(from, to int) Change {
-	rows := make(map[int][]rune, to-from)
+// replaceRows replaces the n rows starting at y with rows. All modifications of
+// the rows go through here so that they can be undone, except in scratch
+// buffers which would otherwise keep all the output of a command twice.
+func (e *E) replaceRows(y, n int, rows [][]rune) {
+	c := Change{Y: y, Old: make([][]rune, n), New: make([][]rune, len(rows))}
+	for i, row := range e.rows[y : y+n] {
+		c.Old[i] = row.chars
+	}
+
+	newRows := make([]*Row, len(rows))
+	for i, r := range rows {
+		// Copy so that the caller's slice can't alias the row
+		c.New[i] = append([]rune(nil), r...)
+		newRows[i] = &Row{chars: c.New[i]}
+	}
+
+	e.rows = append(e.rows[:y], append(newRows, e.rows[y+n:]...)...)
+
+	for i := y; i < y+len(rows); i++ {
+		e.updateRow(i)
+	}
+	// The multiline comment state of the rows that follow may have changed
+	if end := y + len(rows); end < len(e.rows) {
+		e.updateHighlight(end)
+	}
 
-	for i := from; i <= to; i++ {
-		rows[i] = nil
+	if e.cy >= len(e.rows) {
+		e.SetY(len(e.rows) - 1)
+	}
+
+	if !e.scratch {
+		if len(e.pending.changes) == 0 {
+			e.pending.cx, e.pending.cy = e.cx, e.cy
+		}
+		e.pending.changes = append(e.pending.changes, c)
 	}
 
-	return Change{New: rows, Old: make(map[int][]rune)}
+	e.shiftSigns(y, n, len(rows))
+	e.shiftMarks(y, n, len(rows))
+	e.ClearSelection()
+	e.markModified()
+
+	e.hook(EventInfo{Event: BufferChanged, Change: c})
+}
+
+// StartUndoGroup makes all changes to the current buffer until the matching
+// call to EndUndoGroup get undone together
+func (e *E) StartUndoGroup() {
+	e.undoDepth++
+	e.undoGroups = append(e.undoGroups, e.Buffer)
 }
 
-func (c Change) Apply(e *E) {
-	doFullRender := false
+// EndUndoGroup finishes the group in the buffer it was started in, which may
+// not be the current buffer anymore
+func (e *E) EndUndoGroup() {
+	b := e.Buffer
+	if n := len(e.undoGroups); n != 0 {
+		b = e.undoGroups[n-1]
+		e.undoGroups = e.undoGroups[:n-1]
+	}
+
+	if b.undoDepth > 0 {
+		b.undoDepth--
+	}
+	b.commitUndo()
+}
 
-	for i, row := range c.New {
-		log.Printf("applying change i=%d, row=%+v", i, row)
+// commitUndo finishes the current group of changes so that it can be undone
+func (b *Buffer) commitUndo() {
+	if b.undoDepth > 0 || len(b.pending.changes) == 0 {
+		return
+	}
 
-		// edit needs to store the previous row data
-		if _, ok := c.Old[i]; !ok {
-			c.Old[i] = make([]rune, len(e.Row(i)))
-			copy(c.Old[i], e.Row(i))
+	b.undo = append(b.undo, b.pending)
+	b.redo = nil
+	b.pending = undoUnit{}
+}
 
-			e.SetRow(i, row)
+// Undo reverts the last group of changes. It returns false if there is nothing
+// to undo.
+func (e *E) Undo() bool {
+	e.undoDepth = 0
+	e.commitUndo()
 
-			if row != nil {
-				e.Render(i)
-			} else {
-				doFullRender = true
-			}
-		} else {
-			e.rows = append(append(e.rows[:i], &Row{chars:row}), e.rows[i:]...)
-			doFullRender = true
-		}
+	if len(e.undo) == 0 {
+		return false
 	}
 
-	Filter(&e.rows, func(i int) bool { return e.rows[i] != nil })
+	u := e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
 
-	if doFullRender {
-		e.FullRender()
+	for i := len(u.changes) - 1; i >= 0; i-- {
+		c := u.changes[i].Undo()
+		e.replaceRows(c.Y, len(c.Old), c.New)
 	}
+	// Undoing isn't a change we want to record
+	e.pending = undoUnit{}
+
+	e.redo = append(e.redo, u)
+
+	e.SetY(u.cy)
+	e.SetX(u.cx)
+
+	return true
 }
 
-func (c Change) Undo() Change {
-	return Change{New: c.Old, Old: c.New}
+// Redo applies the last group of changes that was undone. It returns false if
+// there is nothing to redo.
+func (e *E) Redo() bool {
+	e.commitUndo()
+
+	if len(e.redo) == 0 {
+		return false
+	}
+
+	u := e.redo[len(e.redo)-1]
+	e.redo = e.redo[:len(e.redo)-1]
+
+	for _, c := range u.changes {
+		e.replaceRows(c.Y, len(c.Old), c.New)
+	}
+	e.pending = undoUnit{}
+
+	e.undo = append(e.undo, u)
+
+	e.SetY(u.changes[0].Y)
+
+	return true
 }
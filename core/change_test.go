@@ -0,0 +1,62 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	e := newTestEditor(nil, "a", "b")
+	e.InsertRows(1, []rune("c"))
+	e.commitUndo()
+
+	if !e.Undo() {
+		t.Fatal("nothing to undo")
+	}
+	if got, want := e.text(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("undo gives %q, expected %q", got, want)
+	}
+}
+
+// A command's output in a scratch buffer isn't kept again to be undone
+func TestScratchUndo(t *testing.T) {
+	e := newTestEditor(nil, "")
+	e.scratch = true
+
+	for i := 0; i < 100; i++ {
+		e.InsertRows(len(e.rows), []rune("output"))
+		e.commitUndo()
+	}
+
+	if len(e.undo) != 0 || len(e.pending.changes) != 0 {
+		t.Errorf("%d changes kept to be undone", len(e.undo)+len(e.pending.changes))
+	}
+	if len(e.rows) != 101 {
+		t.Errorf("%d rows, expected 101", len(e.rows))
+	}
+}
+
+// An undo group ends in the buffer it started in, after switching buffers
+func TestUndoGroupSwitchBuffer(t *testing.T) {
+	e := newTestEditor(nil, "a")
+	first := e.Buffer
+	e.buffers = append(e.buffers, &Buffer{rows: []*Row{{}}})
+
+	e.StartUndoGroup()
+	e.InsertRows(1, []rune("b"))
+	e.InsertRows(2, []rune("c"))
+	e.SwitchBuffer(1)
+	e.EndUndoGroup()
+
+	if first.undoDepth != 0 || e.undoDepth != 0 {
+		t.Fatalf("undo groups still open in the buffers")
+	}
+
+	e.SwitchBuffer(0)
+	if !e.Undo() {
+		t.Fatal("nothing to undo")
+	}
+	if got, want := e.text(), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("undo gives %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// The charsets of editorconfig that files can be read and written in
+var charsets = map[string]bool{
+	"utf-8":     true,
+	"utf-8-bom": true,
+	"latin1":    true,
+	"utf-16be":  true,
+	"utf-16le":  true,
+}
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// decodeText returns the text of a file that is in the charset. The byte order
+// mark of UTF-8 and UTF-16 isn't part of the text.
+func decodeText(b []byte, charset string) (string, error) {
+	switch charset {
+	case "latin1":
+		// The bytes are the first 256 code points
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes), nil
+
+	case "utf-16be", "utf-16le":
+		if len(b)%2 != 0 {
+			return "", fmt.Errorf("not %s, it has an odd number of bytes", charset)
+		}
+
+		var order binary.ByteOrder = binary.BigEndian
+		if charset == "utf-16le" {
+			order = binary.LittleEndian
+		}
+
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		if len(units) != 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		return string(utf16.Decode(units)), nil
+
+	case "utf-8-bom":
+		b = bytes.TrimPrefix(b, utf8BOM)
+	}
+
+	return string(b), nil
+}
+
+// encodeText returns the text in the charset
+func encodeText(s string, charset string) ([]byte, error) {
+	switch charset {
+	case "latin1":
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xff {
+				return nil, fmt.Errorf("%q can't be written in latin1", r)
+			}
+			b = append(b, byte(r))
+		}
+		return b, nil
+
+	case "utf-16be", "utf-16le":
+		var order binary.ByteOrder = binary.BigEndian
+		if charset == "utf-16le" {
+			order = binary.LittleEndian
+		}
+
+		units := utf16.Encode([]rune(s))
+		b := make([]byte, 2*len(units))
+		for i, u := range units {
+			order.PutUint16(b[2*i:], u)
+		}
+		return b, nil
+
+	case "utf-8-bom":
+		return append(append([]byte(nil), utf8BOM...), s...), nil
+	}
+
+	return []byte(s), nil
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToggleComment comments out the rows from and to inclusive, or uncomments
+// them when they are all comments already. It uses the line comment of the
+// filetype, put after the smallest indentation of the rows so that they line
+// up, otherwise each row is put in a block comment. Empty rows are left as
+// they are. It is undone in one step.
+func (e *E) ToggleComment(from, to int) error {
+	if e.syntax == nil {
+		return errors.New("no comments without a filetype")
+	}
+
+	start, end := e.syntax.Scs, ""
+	if len(start) == 0 {
+		start, end = e.syntax.Mcs, e.syntax.Mce
+	}
+	if len(start) == 0 || len(e.syntax.Scs) == 0 && len(end) == 0 {
+		return errors.New(e.syntax.Filetype + " has no comments")
+	}
+
+	rows := make([][]rune, to-from+1)
+	for i := range rows {
+		rows[i] = e.rows[from+i].chars
+	}
+
+	// Where the text of each row moved, by how many runes
+	at := make([]int, len(rows))
+	moved := make([]int, len(rows))
+
+	if isCommented(rows, start, end) {
+		for i, row := range rows {
+			rows[i], at[i], moved[i] = uncomment(row, start, end)
+		}
+	} else {
+		// The column of the smallest indentation, where the comments
+		// start
+		col := -1
+		for _, row := range rows {
+			if !isBlank(row) && (col == -1 || e.IndentWidth(row) < col) {
+				col = e.IndentWidth(row)
+			}
+		}
+
+		for i, row := range rows {
+			rows[i], at[i], moved[i] = e.comment(row, col, start, end)
+		}
+	}
+
+	x := e.cx
+	e.ReplaceRows(from, to, rows...)
+
+	// Keep the cursor on the same rune, or at the start of the text when the
+	// marker it was on is removed
+	if i := e.cy - from; i >= 0 && i < len(rows) && x >= at[i] {
+		x += moved[i]
+		if x < at[i] {
+			x = at[i]
+		}
+	}
+	e.SetX(x)
+	return nil
+}
+
+// isCommented reports whether all the rows that aren't empty are comments
+func isCommented(rows [][]rune, start, end string) bool {
+	commented := false
+	for _, row := range rows {
+		if isBlank(row) {
+			continue
+		}
+
+		text := strings.TrimSpace(string(row))
+		if !strings.HasPrefix(text, start) || !strings.HasSuffix(text, end) || len(text) < len(start)+len(end) {
+			return false
+		}
+		commented = true
+	}
+	return commented
+}
+
+// comment puts the row in a comment that starts at the column. It returns the
+// new row, where the comment starts and the number of runes the text after it
+// moved by.
+func (e *E) comment(row []rune, col int, start, end string) ([]rune, int, int) {
+	if isBlank(row) {
+		return row, 0, 0
+	}
+
+	// The rune at the column, a tab that goes over it is left before the
+	// comment
+	x, cols := 0, 0
+	for x < len(row) && cols < col {
+		cols = CxToRx(row, e.Tabstop(), x+1)
+		x++
+	}
+
+	marker := start + " "
+	text := string(row[:x]) + marker + string(row[x:])
+	if len(end) != 0 {
+		text += " " + end
+	}
+	return []rune(text), x, utf8.RuneCountInString(marker)
+}
+
+// uncomment removes the comment around the row, and a space on the inside of
+// each marker. It returns the new row, where the comment started and the
+// number of runes the text after it moved by, which is negative.
+func uncomment(row []rune, start, end string) ([]rune, int, int) {
+	if isBlank(row) {
+		return row, 0, 0
+	}
+
+	indent := IndentOf(row)
+	text := string(row[len(indent):])
+
+	text = strings.TrimPrefix(text, start)
+	text = strings.TrimPrefix(text, " ")
+	moved := utf8.RuneCountInString(text) - (len(row) - len(indent))
+	if len(end) != 0 {
+		text = strings.TrimRight(text, " \t")
+		text = strings.TrimSuffix(text, end)
+		text = strings.TrimSuffix(text, " ")
+	}
+	return append(append([]rune(nil), indent...), []rune(text)...), len(indent), moved
+}
+
+func isBlank(row []rune) bool {
+	return len(IndentOf(row)) == len(row)
+}
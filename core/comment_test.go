@@ -0,0 +1,97 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToggleComment(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		syntax *EditorSyntax
+		rows   []string
+		result []string
+	}{
+		{"one row", testSyntax, []string{"a := 1"}, []string{"// a := 1"}},
+		{"smallest indent", testSyntax,
+			[]string{"\tif x {", "\t\ty()", "\t}"},
+			[]string{"\t// if x {", "\t// \ty()", "\t// }"}},
+		{"blank rows", testSyntax,
+			[]string{"\ta", "", "\t", "\t\tb"},
+			[]string{"\t// a", "", "\t", "\t// \tb"}},
+		{"spaces", testSyntax,
+			[]string{"    a", "  b"},
+			[]string{"  //   a", "  // b"}},
+		{"uncomment", testSyntax,
+			[]string{"\t// if x {", "\t// \ty()", "\t// }"},
+			[]string{"\tif x {", "\t\ty()", "\t}"}},
+		{"uncomment without spaces", testSyntax,
+			[]string{"//a", "\t//b"},
+			[]string{"a", "\tb"}},
+		{"some commented", testSyntax,
+			[]string{"// a", "b"},
+			[]string{"// // a", "// b"}},
+		{"blocks", testHTML,
+			[]string{"<p>", "  a", "</p>"},
+			[]string{"<!-- <p> -->", "<!--   a -->", "<!-- </p> -->"}},
+		{"uncomment blocks", testHTML,
+			[]string{"  <!-- <p> -->", "", "  <!--a-->  "},
+			[]string{"  <p>", "", "  a"}},
+	} {
+		e := newTestEditor(test.syntax, test.rows...)
+		if err := e.ToggleComment(0, len(test.rows)-1); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got := e.text(); !reflect.DeepEqual(got, test.result) {
+			t.Errorf("%s: ToggleComment gives %q, expected %q", test.name, got, test.result)
+		}
+	}
+}
+
+func TestToggleCommentRoundTrip(t *testing.T) {
+	for _, rows := range [][]string{
+		{"func f() {", "\treturn", "}"},
+		{"\t\ta", "", "\t  b", "\t\t\tc"},
+		{"  x", "    y"},
+	} {
+		e := newTestEditor(testSyntax, rows...)
+		e.ToggleComment(0, len(rows)-1)
+		e.ToggleComment(0, len(rows)-1)
+		if got := e.text(); !reflect.DeepEqual(got, rows) {
+			t.Errorf("commenting and uncommenting %q gives %q", rows, got)
+		}
+	}
+}
+
+func TestToggleCommentNone(t *testing.T) {
+	if err := newTestEditor(nil, "a").ToggleComment(0, 0); err == nil {
+		t.Errorf("no error without a filetype")
+	}
+	if err := newTestEditor(&EditorSyntax{Filetype: "text"}, "a").ToggleComment(0, 0); err == nil {
+		t.Errorf("no error for a filetype without comments")
+	}
+}
+
+func TestToggleCommentCursor(t *testing.T) {
+	for _, test := range []struct {
+		row    string
+		x, cx  int
+		syntax *EditorSyntax
+	}{
+		{"\tfoo()", 2, 5, testSyntax},
+		{"\tfoo()", 0, 0, testSyntax},
+		{"\t// foo()", 5, 2, testSyntax},
+		// The marker that the cursor is on is removed
+		{"\t// foo()", 2, 1, testSyntax},
+		{"<p>", 1, 6, testHTML},
+		{"<!-- <p> -->", 6, 1, testHTML},
+	} {
+		e := newTestEditor(test.syntax, test.row)
+		e.SetX(test.x)
+
+		e.ToggleComment(0, 0)
+		if e.cx != test.cx {
+			t.Errorf("toggling the comment of %q at %d leaves the cursor at %d, expected %d", test.row, test.x, e.cx, test.cx)
+		}
+	}
+}
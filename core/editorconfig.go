@@ -0,0 +1,137 @@
+package core
+
+import (
+	"log"
+	"strings"
+	"unicode"
+
+	"codeberg.org/wlcsm/li/editorconfig"
+)
+
+// fileFormat is how the file of a buffer is read and written. It is set from
+// the .editorconfig files of the project, the zero value is how li writes
+// files otherwise.
+type fileFormat struct {
+	// Line ending, "\n" when empty. Files are read with either "\n" or
+	// "\r\n" unless it is "\r".
+	EOL string
+	// Encoding of the file, UTF-8 when empty, see charset.go
+	Charset string
+	// Whether the whitespace at the end of rows is removed when saving
+	TrimTrailingWhitespace bool
+	// Whether the last row is written without a line ending
+	NoFinalNewline bool
+}
+
+// The line endings of end_of_line
+var editorConfigEOL = map[string]string{
+	"lf":   "\n",
+	"crlf": "\r\n",
+	"cr":   "\r",
+}
+
+// loadEditorConfig sets the tabstop and file format of the current buffer
+// from the .editorconfig files of its project. It returns the properties so
+// that the indentation can be set once the file is read.
+func (e *E) loadEditorConfig() editorconfig.Properties {
+	props, err := editorconfig.Lookup(e.filename)
+	if err != nil {
+		log.Printf("reading .editorconfig for %s: %s", e.filename, err)
+		return nil
+	}
+
+	if n, ok := props.Int("tab_width"); ok {
+		e.tabstop = n
+	}
+
+	e.fileFormat.EOL = editorConfigEOL[props["end_of_line"]]
+	if charsets[props["charset"]] {
+		e.fileFormat.Charset = props["charset"]
+	}
+	e.fileFormat.TrimTrailingWhitespace, _ = props.Bool("trim_trailing_whitespace")
+	if insert, ok := props.Bool("insert_final_newline"); ok {
+		e.fileFormat.NoFinalNewline = !insert
+	}
+
+	return props
+}
+
+// applyEditorConfigIndent sets the indentation of the current buffer from its
+// .editorconfig, which takes precedence over the indentation detected from
+// the file
+func (e *E) applyEditorConfigIndent(props editorconfig.Properties) {
+	i := e.Indent()
+
+	switch props["indent_style"] {
+	case "tab":
+		i.ExpandTab = false
+	case "space":
+		i.ExpandTab = true
+	}
+
+	if n, ok := props.Int("indent_size"); ok {
+		i.ShiftWidth = n
+	} else if props["indent_size"] == "tab" {
+		i.ShiftWidth = e.Tabstop()
+	}
+
+	if i != e.Indent() {
+		e.indent = i
+	}
+}
+
+// trimTrailingWhitespace removes the whitespace at the end of the rows, for
+// trim_trailing_whitespace. Only the rows that change are replaced so that the
+// cursor stays where it is.
+func (e *E) trimTrailingWhitespace() {
+	for y, row := range e.rows {
+		trimmed := []rune(strings.TrimRightFunc(string(row.chars), unicode.IsSpace))
+		if len(trimmed) == len(row.chars) {
+			continue
+		}
+
+		e.replaceRows(y, 1, [][]rune{trimmed})
+	}
+
+	if e.cx > len(e.rows[e.cy].chars) {
+		e.SetX(len(e.rows[e.cy].chars))
+	}
+}
+
+// splitRows splits the text of a file into rows
+func (e *E) splitRows(text string) [][]rune {
+	sep := "\n"
+	if e.fileFormat.EOL == "\r" {
+		sep = "\r"
+	}
+
+	lines := strings.Split(text, sep)
+	// The line ending of the last line doesn't start another
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	rows := make([][]rune, len(lines))
+	for i, l := range lines {
+		rows[i] = []rune(strings.TrimSuffix(l, "\r"))
+	}
+	return rows
+}
+
+// encodeRows returns the contents of the file of the current buffer
+func (e *E) encodeRows() ([]byte, error) {
+	eol := e.fileFormat.EOL
+	if len(eol) == 0 {
+		eol = "\n"
+	}
+
+	var b strings.Builder
+	for i, row := range e.rows {
+		b.WriteString(string(row.chars))
+		if i != len(e.rows)-1 || !e.fileFormat.NoFinalNewline {
+			b.WriteString(eol)
+		}
+	}
+
+	return encodeText(b.String(), e.fileFormat.Charset)
+}
@@ -1,56 +1,216 @@
 package core
 
 import (
-	"bufio"
-	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
+	"codeberg.org/wlcsm/li/ansi"
 	"github.com/pkg/errors"
 )
 
-// OpenFile opens a file with the given filename.
-// If a file does not exist, it returns os.ErrNotExist.
+// ErrFileChanged is returned when saving would overwrite changes that were
+// made to the file by another program.
+var ErrFileChanged = errors.New("file changed on disk since it was read")
+
+// How often to check if the file was changed by another program
+const fileCheckInterval = time.Second
+
+// OpenFile opens the file in a new buffer and makes it the current buffer. If
+// the file is already open then its buffer becomes the current one instead.
+// If a file does not exist, it is created.
 func (e *E) OpenFile(filename string) error {
-	e.filename = filename
+	if i := e.findBuffer(filename); i != -1 {
+		e.SwitchBuffer(i)
+		return nil
+	}
+
+	modified := false
 
 	f, err := os.Open(filename)
 	if errors.Is(err, os.ErrNotExist) {
 		f, err = os.Create(filename)
-		e.modified = true
-	} else {
-		e.modified = false
-		err = nil
+		modified = true
 	}
-
 	if err != nil {
 		return errors.Wrapf(err, "opening file: %s", filename)
 	}
 	defer f.Close()
 
-	e.rows = e.rows[:0]
+	prev := e.Buffer
+	e.addBuffer(&Buffer{filename: filename})
 
-	s := bufio.NewScanner(f)
-	for i := 0; s.Scan(); i++ {
-		line := s.Bytes()
+	props := e.loadEditorConfig()
 
-		// strip off newline or cariage return
-		bytes.TrimRightFunc(line, func(r rune) bool { return r == '\n' || r == '\r' })
-		e.rows = append(e.rows, &Row{
-			chars: []rune(string(line)),
-		})
+	rows, err := e.readFile(f)
+	if err != nil {
+		e.removeBuffer(e.Buffer)
+		return err
+	}
 
+	e.detectSyntax()
+
+	if i, ok := detectIndent(rows, e.Tabstop()); ok {
+		if i.ShiftWidth == 0 {
+			i.ShiftWidth = e.Indent().ShiftWidth
+		}
+		e.indent = i
+	}
+	e.applyEditorConfigIndent(props)
+
+	e.rows = make([]*Row, len(rows))
+	for i := range rows {
+		e.rows[i] = &Row{chars: rows[i]}
 		e.updateRow(i)
 	}
+	e.modified = modified
+	e.restorePosition()
+
+	// Replace the empty buffer li starts with
+	if prev.isEmpty() {
+		e.removeBuffer(prev)
+	}
+
+	e.hook(EventInfo{Event: BufferOpen, Filename: filename})
+
+	return e.checkSwap()
+}
+
+// readFile reads the lines of f and records the state of the file so that we
+// can detect when other programs change it.
+func (e *E) readFile(f *os.File) ([][]rune, error) {
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", e.filename)
+	}
+
+	text, err := decodeText(b, e.fileFormat.Charset)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", e.filename)
+	}
+
+	rows := e.splitRows(text)
+	if len(rows) == 0 {
+		rows = [][]rune{{}}
+	}
 
-	if err := s.Err(); err != nil {
-		return errors.Wrapf(err, "reading %s", e.filename)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	e.diskInfo = info
+	e.seenInfo = info
+
+	return rows, nil
+}
+
+// Reload reads the file again from disk, discarding any changes. The cursor
+// stays where it is as far as possible and the reload can be undone.
+func (e *E) Reload() error {
+	f, err := os.Open(e.filename)
+	if err != nil {
+		return errors.Wrapf(err, "opening file: %s", e.filename)
 	}
+	defer f.Close()
 
-	if e.modified {
-		e.cx = 0
-		e.cy = 0
-		e.rx = 0
+	rows, err := e.readFile(f)
+	if err != nil {
+		return err
 	}
 
+	e.replaceRows(0, len(e.rows), rows)
+	e.modified = false
+	e.SetY(e.cy)
+
+	return nil
+}
+
+// sameVersion reports whether a and b describe the same version of a file
+func sameVersion(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// changedOnDisk reports whether the file is no longer the version that we read
+// or last wrote
+func (e *E) changedOnDisk() bool {
+	if len(e.filename) == 0 || e.diskInfo == nil {
+		return false
+	}
+
+	info, err := os.Stat(e.filename)
+	if err != nil {
+		// If it was deleted then there is nothing to overwrite
+		return false
+	}
+
+	return !sameVersion(info, e.diskInfo)
+}
+
+// checkFiles looks for changes made to the files of the buffers by other
+// programs. Unmodified buffers are reloaded, otherwise the user is asked what
+// to do, once they are done with any other prompts.
+func (e *E) checkFiles() error {
+	var err error
+	for _, b := range e.buffers {
+		e.inBuffer(b, func() {
+			if checkErr := e.checkFile(); checkErr != nil && err == nil {
+				err = checkErr
+			}
+		})
+	}
+	return err
+}
+
+// checkFile checks the file of the current buffer, see checkFiles
+func (e *E) checkFile() error {
+	if len(e.filename) == 0 || e.diskInfo == nil {
+		return nil
+	}
+
+	info, err := os.Stat(e.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		// It will be created again when the buffer is saved
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only bother the user once for each change
+	if sameVersion(info, e.diskInfo) || sameVersion(info, e.seenInfo) {
+		return nil
+	}
+	e.seenInfo = info
+
+	if !e.modified {
+		if err := e.Reload(); err != nil {
+			return err
+		}
+
+		e.SetStatusLine("reloaded %s, it was changed on disk", e.filename)
+		return nil
+	}
+
+	// The buffer may not be the current one when the user answers
+	b := e.Buffer
+	e.Prompt(fmt.Sprintf("%s changed on disk: [r]eload and lose changes, [k]eep buffer ", e.filename), func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.Key('r'):
+			var err error
+			e.inBuffer(b, func() { err = e.Reload() })
+			if err != nil {
+				return "", true, err
+			}
+			e.SetStatusLine("reloaded %s", b.filename)
+		case ansi.Key('k'), ansi.EscapeKey:
+			e.SetStatusLine("kept %s, it must be force saved to overwrite the file", b.filename)
+		default:
+			return "", false, nil
+		}
+
+		return "", true, nil
+	})
+
 	return nil
 }
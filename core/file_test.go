@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openTestFile opens a file with the text in a test editor
+func openTestFile(t *testing.T, text string) (*E, string) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newTestEditor(nil)
+	e.session = loadSession("")
+	if err := e.OpenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return e, path
+}
+
+// changeFile rewrites the file as another program would
+func changeFile(t *testing.T, path, text string) {
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Don't depend on the resolution of the clock
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadChangedFile(t *testing.T) {
+	e, path := openTestFile(t, "one\ntwo\n")
+	changeFile(t, path, "one\nTWO\nthree\n")
+
+	if err := e.checkFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.text(), []string{"one", "TWO", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded %q, expected %q", got, want)
+	}
+	if e.modified {
+		t.Errorf("buffer is modified after reloading")
+	}
+
+	// The event loop finishes the change
+	e.commitUndo()
+
+	// Only once
+	e.InsertRows(0, []rune("new"))
+	e.commitUndo()
+	if err := e.checkFiles(); err != nil || e.prompt != nil {
+		t.Errorf("the same change was noticed again")
+	}
+
+	e.Undo()
+	if !e.Undo() {
+		t.Fatal("the reload can't be undone")
+	}
+	if got, want := e.text(), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("undoing the reload gives %q, expected %q", got, want)
+	}
+}
+
+// A modified buffer isn't reloaded without asking
+func TestChangedFileModified(t *testing.T) {
+	e, path := openTestFile(t, "one\n")
+	e.InsertRows(1, []rune("two"))
+	changeFile(t, path, "ONE\n")
+
+	if err := e.checkFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if e.prompt == nil {
+		t.Errorf("not asked whether to reload")
+	}
+	if got, want := e.text(), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buffer is %q, expected %q", got, want)
+	}
+}
+
+func TestSaveChangedFile(t *testing.T) {
+	e, path := openTestFile(t, "one\n")
+	e.InsertRows(1, []rune("two"))
+	changeFile(t, path, "ONE\n")
+
+	if err := e.Save(); !errors.Is(err, ErrFileChanged) {
+		t.Errorf("saving over a changed file gives %v, expected ErrFileChanged", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "ONE\n" {
+		t.Errorf("file is %q after saving failed", b)
+	}
+
+	if err := e.ForceSave(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "one\ntwo\n" {
+		t.Errorf("file is %q after forcing the save", b)
+	}
+	// The saved file is the version on disk now
+	if err := e.Save(); err != nil {
+		t.Errorf("saving again gives %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"codeberg.org/wlcsm/li/diff"
+)
+
+// format pipes the buffer through the formatter of its filetype. Only the rows
+// that the formatter changes are replaced, so the cursor stays on the same
+// text and the formatting is undone in one step.
+func (e *E) format() error {
+	if e.syntax == nil || len(e.syntax.Formatter) == 0 {
+		return nil
+	}
+
+	old := make([]string, len(e.rows))
+	var in strings.Builder
+	for i, row := range e.rows {
+		old[i] = string(row.chars)
+		in.WriteString(old[i])
+		in.WriteByte('\n')
+	}
+
+	abs, err := filepath.Abs(e.filename)
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("sh", "-c", e.syntax.Formatter)
+	cmd.Dir = filepath.Dir(abs)
+	cmd.Env = append(os.Environ(), "LI_FILE="+abs)
+	cmd.Stdin = strings.NewReader(in.String())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// The shell exits with 127 when the command doesn't exist, not
+		// having the formatter installed shouldn't stop files being saved
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 127 {
+			log.Printf("formatter not found: %s", e.syntax.Formatter)
+			return nil
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) == 0 {
+			msg = err.Error()
+		}
+		return fmt.Errorf("not saved, %s: %s", e.syntax.Formatter, strings.ReplaceAll(msg, "\n", " "))
+	}
+
+	// A formatter that prints nothing, such as one that rewrites the file in
+	// place, would empty the buffer
+	if stdout.Len() == 0 && len(strings.TrimSpace(in.String())) != 0 {
+		return fmt.Errorf("not saved, %s printed nothing", e.syntax.Formatter)
+	}
+
+	formatted := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	for i, l := range formatted {
+		formatted[i] = strings.TrimSuffix(l, "\r")
+	}
+
+	hunks := diff.Lines(old, formatted)
+
+	// Apply the last hunk first so that the earlier ones stay in place
+	cy := e.cy
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+
+		rows := make([][]rune, h.NewEnd-h.NewStart)
+		for j := range rows {
+			rows[j] = []rune(formatted[h.NewStart+j])
+		}
+		e.replaceRows(h.OldStart, h.OldEnd-h.OldStart, rows)
+
+		// Keep the cursor on the same row, or the last row of the hunk
+		// that replaced it
+		switch {
+		case cy >= h.OldEnd:
+			cy += len(rows) - (h.OldEnd - h.OldStart)
+		case cy >= h.OldStart+len(rows):
+			cy = h.OldStart + len(rows) - 1
+		}
+	}
+
+	if len(hunks) != 0 {
+		cx := e.cx
+		e.SetY(cy)
+		e.SetX(cx)
+	}
+	return nil
+}
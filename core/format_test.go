@@ -0,0 +1,34 @@
+package core
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		formatter string
+		rows      []string
+		expected  []string
+		err       bool
+	}{
+		{formatter: "tr a-z A-Z", rows: []string{"one", "two"}, expected: []string{"ONE", "TWO"}},
+		{formatter: "cat", rows: []string{"one", "", "two"}, expected: []string{"one", "", "two"}},
+		{formatter: "echo bad >&2; exit 1", rows: []string{"one"}, expected: []string{"one"}, err: true},
+		// The buffer isn't emptied by a formatter that prints nothing
+		{formatter: "true", rows: []string{"one"}, expected: []string{"one"}, err: true},
+		{formatter: "true", rows: []string{""}, expected: []string{""}},
+	} {
+		e := newTestEditor(&EditorSyntax{Formatter: test.formatter}, test.rows...)
+		e.filename = filepath.Join(t.TempDir(), "a.txt")
+
+		err := e.format()
+		if (err != nil) != test.err {
+			t.Errorf("formatting %q with %q gives error %v", test.rows, test.formatter, err)
+		}
+		if got := e.text(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("formatting %q with %q gives %q, expected %q", test.rows, test.formatter, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// Event is something that happens in the editor that hooks can react to
+type Event int
+
+const (
+	// BufferOpen is after a file is opened into a new buffer, which is the
+	// current buffer
+	BufferOpen Event = iota
+	// BeforeSave is before the current buffer is written to its file. An
+	// error stops the file from being saved.
+	BeforeSave
+	// AfterSave is after the current buffer was written to its file
+	AfterSave
+	// BufferChanged is after rows of the current buffer were replaced,
+	// including by undo
+	BufferChanged
+	// CursorMoved is after an event that left the cursor somewhere else,
+	// including in another buffer
+	CursorMoved
+	// ModeChanged is after SetMode changed the mode
+	ModeChanged
+	// Resize is after the terminal was resized
+	Resize
+	// Idle is when no key has been pressed for EditorConf.IdleTime. It
+	// happens once until the next key.
+	Idle
+	// Quit is before the editor exits
+	Quit
+)
+
+var eventNames = map[Event]string{
+	BufferOpen:    "BufferOpen",
+	BeforeSave:    "BeforeSave",
+	AfterSave:     "AfterSave",
+	BufferChanged: "BufferChanged",
+	CursorMoved:   "CursorMoved",
+	ModeChanged:   "ModeChanged",
+	Resize:        "Resize",
+	Idle:          "Idle",
+	Quit:          "Quit",
+}
+
+func (ev Event) String() string {
+	if name, ok := eventNames[ev]; ok {
+		return name
+	}
+	return fmt.Sprintf("Event(%d)", int(ev))
+}
+
+// EventInfo describes an event to its hooks. Only the fields for the event are
+// set.
+type EventInfo struct {
+	Event Event
+	// the buffer's file, for BufferOpen, BeforeSave and AfterSave
+	Filename string
+	// the rows that were replaced, for BufferChanged
+	Change Change
+	// the new and previous mode, for ModeChanged
+	Mode     string
+	PrevMode string
+}
+
+// Hook is run when an event happens. Its error is shown on the status line.
+type Hook func(e *E, info EventInfo) error
+
+// Hooks are the hooks for each event, they are run in order
+type Hooks map[Event][]Hook
+
+// AddHook runs h after the other hooks for the event
+func (e *E) AddHook(ev Event, h Hook) {
+	e.hooks[ev] = append(e.hooks[ev], h)
+}
+
+// runHooks runs all the hooks for the event and returns the first error
+func (e *E) runHooks(info EventInfo) error {
+	var first error
+	for _, h := range e.hooks[info.Event] {
+		if err := h(e, info); err != nil && first == nil {
+			first = errors.Wrapf(err, "%s hook", info.Event)
+		}
+	}
+	return first
+}
+
+// hook runs the hooks for the event and shows any error on the status line
+func (e *E) hook(info EventInfo) {
+	if err := e.runHooks(info); err != nil {
+		log.Println(err)
+		e.SetStatusLine("err: " + err.Error())
+	}
+}
+
+// SetMode records the mode of the keymap, e.g. "insert", so that hooks know
+// about it
+func (e *E) SetMode(mode string) {
+	if mode == e.mode {
+		return
+	}
+
+	prev := e.mode
+	e.mode = mode
+	e.hook(EventInfo{Event: ModeChanged, Mode: mode, PrevMode: prev})
+}
+
+// Mode returns the mode given to SetMode
+func (e *E) Mode() string {
+	return e.mode
+}
+
+// cursor is where the cursor is, for noticing when it moves
+type cursor struct {
+	buf    *Buffer
+	cx, cy int
+}
+
+func (e *E) cursor() cursor {
+	return cursor{e.Buffer, e.cx, e.cy}
+}
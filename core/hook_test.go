@@ -0,0 +1,87 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHookOrder(t *testing.T) {
+	e := newTestEditor(nil, "")
+
+	var ran []string
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		e.AddHook(BufferChanged, func(e *E, info EventInfo) error {
+			ran = append(ran, name)
+			if name != "a" {
+				return errors.New(name)
+			}
+			return nil
+		})
+	}
+
+	// The hooks after an error still run, the first error is returned
+	err := e.runHooks(EventInfo{Event: BufferChanged})
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(ran, expected) {
+		t.Errorf("hooks ran in the order %q, expected %q", ran, expected)
+	}
+	if err == nil || err.Error() != "BufferChanged hook: b" {
+		t.Errorf("hooks gave error %v, expected the one from b", err)
+	}
+}
+
+func TestBeforeSaveError(t *testing.T) {
+	e := newTestEditor(nil, "text")
+	e.filename = filepath.Join(t.TempDir(), "a.txt")
+
+	after := false
+	e.AddHook(BeforeSave, func(e *E, info EventInfo) error {
+		if info.Filename != e.filename {
+			t.Errorf("BeforeSave of %q, expected %q", info.Filename, e.filename)
+		}
+		return errors.New("no")
+	})
+	e.AddHook(AfterSave, func(e *E, info EventInfo) error {
+		after = true
+		return nil
+	})
+
+	if err := e.save(); err == nil {
+		t.Errorf("saved despite the BeforeSave hook's error")
+	}
+	if _, err := os.Stat(e.filename); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file was written: %v", err)
+	}
+	if after {
+		t.Errorf("AfterSave hooks ran")
+	}
+}
+
+func TestSetModeHook(t *testing.T) {
+	e := newTestEditor(nil, "")
+
+	var changes []EventInfo
+	e.AddHook(ModeChanged, func(e *E, info EventInfo) error {
+		changes = append(changes, info)
+		return nil
+	})
+
+	e.SetMode("insert")
+	// Not changing the mode isn't an event
+	e.SetMode("insert")
+	e.SetMode("command")
+
+	expected := []EventInfo{
+		{Event: ModeChanged, Mode: "insert"},
+		{Event: ModeChanged, Mode: "command", PrevMode: "insert"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("mode changes %+v, expected %+v", changes, expected)
+	}
+	if e.Mode() != "command" {
+		t.Errorf("mode is %q, expected command", e.Mode())
+	}
+}
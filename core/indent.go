@@ -0,0 +1,222 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Number of rows looked at to detect the indentation of a file
+const maxIndentRows = 1000
+
+// Indent is how rows are indented
+type Indent struct {
+	// Indent with spaces, rather than tabs
+	ExpandTab bool
+	// Number of columns of each level of indentation, the tabstop when zero
+	ShiftWidth int
+}
+
+func (i Indent) String() string {
+	if i.ExpandTab {
+		return fmt.Sprintf("%d spaces", i.ShiftWidth)
+	}
+	return "tabs"
+}
+
+// Indent returns how the current buffer is indented. It is detected from the
+// file when it is opened, or is the indentation of its filetype or the default
+// one.
+func (e *E) Indent() Indent {
+	i := e.indent
+	if i == (Indent{}) {
+		i = e.defaultIndent()
+	}
+	if i.ShiftWidth == 0 {
+		i.ShiftWidth = e.Tabstop()
+	}
+	return i
+}
+
+// SetIndent sets how the current buffer is indented
+func (e *E) SetIndent(i Indent) {
+	e.indent = i
+}
+
+func (e *E) defaultIndent() Indent {
+	if e.syntax != nil && e.syntax.Indent != (Indent{}) {
+		return e.syntax.Indent
+	}
+	return e.cfg.Indent
+}
+
+// detectIndent works out how the rows are indented, from the rows that start
+// with tabs or spaces and by how much the rows indented with spaces change. The
+// ShiftWidth is zero when it can't be told. It returns false if none of the
+// rows are indented.
+func detectIndent(rows [][]rune, tabstop int) (Indent, bool) {
+	if len(rows) > maxIndentRows {
+		rows = rows[:maxIndentRows]
+	}
+
+	tabs, spaces := 0, 0
+	// Number of times each change in the indentation of consecutive rows
+	// indented with spaces was seen
+	changes := map[int]int{}
+	prev := 0
+
+	for _, row := range rows {
+		if len(strings.TrimSpace(string(row))) == 0 {
+			continue
+		}
+
+		if row[0] == '\t' {
+			tabs++
+			continue
+		}
+
+		n := len(IndentOf(row))
+		// A single space is more likely to be alignment, such as the
+		// middle of a block comment, than indentation
+		if n > 1 {
+			spaces++
+		}
+
+		change := n - prev
+		if change < 0 {
+			change = -change
+		}
+		if change > 1 {
+			changes[change]++
+		}
+		prev = n
+	}
+
+	switch {
+	case tabs == 0 && spaces == 0:
+		return Indent{}, false
+	case tabs >= spaces:
+		return Indent{ShiftWidth: tabstop}, true
+	}
+
+	width, seen := 0, 0
+	for w, n := range changes {
+		if n > seen || n == seen && w < width {
+			width, seen = w, n
+		}
+	}
+	return Indent{ExpandTab: true, ShiftWidth: width}, true
+}
+
+// IndentOf returns the whitespace at the start of the row
+func IndentOf(row []rune) []rune {
+	for i, r := range row {
+		if r != ' ' && r != '\t' {
+			return row[:i]
+		}
+	}
+	return row
+}
+
+// IndentWidth returns the number of columns of the whitespace at the start of
+// the row
+func (e *E) IndentWidth(row []rune) int {
+	return CxToRx(row, e.Tabstop(), len(IndentOf(row)))
+}
+
+// MakeIndent returns the whitespace that indents a row by width columns, in
+// the way the current buffer is indented
+func (e *E) MakeIndent(width int) []rune {
+	if width <= 0 {
+		return nil
+	}
+	if e.Indent().ExpandTab {
+		return []rune(strings.Repeat(" ", width))
+	}
+
+	ts := e.Tabstop()
+	return []rune(strings.Repeat("\t", width/ts) + strings.Repeat(" ", width%ts))
+}
+
+// reindent returns the row with its indentation changed to width columns
+func (e *E) reindent(row []rune, width int) []rune {
+	rest := row[len(IndentOf(row)):]
+	return append(e.MakeIndent(width), rest...)
+}
+
+// SetIndentWidth changes the indentation of row y to width columns, keeping the
+// cursor on the same character
+func (e *E) SetIndentWidth(y, width int) {
+	row := e.rows[y].chars
+	newRow := e.reindent(row, width)
+	e.SetRow(y, newRow)
+
+	if y == e.cy {
+		e.SetX(e.cx + len(newRow) - len(row))
+	}
+}
+
+// ShiftRows indents the rows from and to inclusive by the number of levels, or
+// removes levels when it is negative. Empty rows are left empty.
+func (e *E) ShiftRows(from, to, levels int) {
+	sw := e.Indent().ShiftWidth
+
+	rows := make([][]rune, 0, to-from+1)
+	for y := from; y <= to; y++ {
+		row := e.rows[y].chars
+		if len(IndentOf(row)) == len(row) {
+			rows = append(rows, nil)
+			continue
+		}
+
+		width := e.IndentWidth(row) + levels*sw
+		if width < 0 {
+			width = 0
+		}
+		rows = append(rows, e.reindent(row, width))
+	}
+	e.ReplaceRows(from, to, rows...)
+
+	// Like after other commands on whole rows, go to the start of the text
+	if e.cy >= from && e.cy <= to {
+		e.SetX(len(IndentOf(e.rows[e.cy].chars)))
+	}
+}
+
+// Newline splits the row at the cursor, indenting the new row like the old one.
+// The syntax of the buffer can indent it further, see EditorSyntax.IndentAfter.
+func (e *E) Newline() {
+	y, x := e.cy, e.cx
+	row := e.rows[y].chars
+
+	width := e.IndentWidth(row)
+	before := row[:x]
+	after := []rune(strings.TrimLeftFunc(string(row[x:]), unicode.IsSpace))
+
+	// Don't leave the indentation on a row without text
+	if len(IndentOf(before)) == len(before) {
+		before = nil
+	}
+
+	inner := width
+	if e.syntax != nil {
+		last, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(string(before), unicode.IsSpace))
+		if last != utf8.RuneError && strings.ContainsRune(e.syntax.IndentAfter, last) {
+			inner += e.Indent().ShiftWidth
+		}
+	}
+
+	indent := e.MakeIndent(inner)
+	rows := [][]rune{before, append(indent, after...)}
+
+	// Put the closing bracket of an empty block on a row of its own, such as
+	// pressing enter between the braces of "{}"
+	if inner > width && len(after) != 0 && strings.ContainsRune(e.syntax.DedentOn, after[0]) {
+		rows = [][]rune{before, indent, e.reindent(after, width)}
+	}
+
+	e.ReplaceRows(y, y, rows...)
+	e.SetY(y + 1)
+	e.SetX(len(indent))
+}
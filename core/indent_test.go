@@ -0,0 +1,74 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectIndent(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		text   string
+		indent Indent
+		ok     bool
+	}{
+		{"unindented", "a\nb\n\nc", Indent{}, false},
+		{"empty", "", Indent{}, false},
+		{"blank rows", "a\n    \n\t\nb", Indent{}, false},
+		{"tabs", "a {\n\tb {\n\t\tc\n\t}\n}", Indent{ShiftWidth: 4}, true},
+		{"2 spaces", "a:\n  b:\n    c\n  d\ne", Indent{ExpandTab: true, ShiftWidth: 2}, true},
+		{"4 spaces", "a:\n    b:\n        c\n    d\ne", Indent{ExpandTab: true, ShiftWidth: 4}, true},
+		// An 8 space jump back out of two levels isn't the width
+		{"4 spaces with a dedent of 2 levels", "a:\n    b:\n        c\nd\ne:\n    f", Indent{ExpandTab: true, ShiftWidth: 4}, true},
+		// Alignment of a single space isn't indentation
+		{"tabs with a block comment", "/*\n * a\n * b\n */\nf {\n\tg\n}", Indent{ShiftWidth: 4}, true},
+		{"spaces with a block comment", "/*\n * a\n */\nf {\n  g\n  h {\n    i\n  }\n}", Indent{ExpandTab: true, ShiftWidth: 2}, true},
+		{"more tabs than spaces", "a\n\tb\n\tc\n  d", Indent{ShiftWidth: 4}, true},
+		{"more spaces than tabs", "a\n  b\n  c\n\td", Indent{ExpandTab: true, ShiftWidth: 2}, true},
+		// The width can't be told when the only indentation is aligned
+		{"single spaces", "a\n b\n c", Indent{}, false},
+		{"a single row", "a\n      b", Indent{ExpandTab: true, ShiftWidth: 6}, true},
+	} {
+		var rows [][]rune
+		for _, r := range strings.Split(test.text, "\n") {
+			rows = append(rows, []rune(r))
+		}
+
+		indent, ok := detectIndent(rows, 4)
+		if indent != test.indent || ok != test.ok {
+			t.Errorf("%s: detectIndent = %+v, %v, expected %+v, %v", test.name, indent, ok, test.indent, test.ok)
+		}
+	}
+}
+
+func TestNewline(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		row    string
+		x      int
+		indent Indent
+		rows   []string
+		cx     int
+	}{
+		{"end of row", "\tfoo()", 6, Indent{}, []string{"\tfoo()", "\t"}, 1},
+		{"middle of row", "\tfoo bar", 4, Indent{}, []string{"\tfoo", "\tbar"}, 1},
+		{"after an opening bracket", "\tif x {", 7, Indent{}, []string{"\tif x {", "\t\t"}, 2},
+		{"between brackets", "\tf({})", 4, Indent{}, []string{"\tf({", "\t\t", "\t})"}, 2},
+		{"spaces", "  if x {", 8, Indent{ExpandTab: true, ShiftWidth: 2}, []string{"  if x {", "    "}, 4},
+		{"blank row", "    ", 4, Indent{ExpandTab: true, ShiftWidth: 4}, []string{"", "    "}, 4},
+		{"start of row", "\tfoo", 0, Indent{}, []string{"", "\tfoo"}, 1},
+	} {
+		e := newTestEditor(testSyntax, test.row)
+		e.SetIndent(test.indent)
+		e.SetX(test.x)
+
+		e.Newline()
+		if got := e.text(); !reflect.DeepEqual(got, test.rows) {
+			t.Errorf("%s: Newline gives %q, expected %q", test.name, got, test.rows)
+		}
+		if e.cy != 1 || e.cx != test.cx {
+			t.Errorf("%s: cursor at %d,%d, expected 1,%d", test.name, e.cx, e.cy, test.cx)
+		}
+	}
+}
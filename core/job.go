@@ -0,0 +1,254 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How long a cancelled job has to exit before it is killed
+const jobKillDelay = 2 * time.Second
+
+// Maximum amount of output added to a job's buffer at once
+const jobChunkSize = 64 * 1024
+
+// Job is a shell command running in the background. Its output goes to a
+// scratch buffer.
+type Job struct {
+	Command string
+
+	buf    *Buffer
+	cmd    *exec.Cmd
+	onExit func(*E, *Job)
+	start  time.Time
+
+	// number of lines of output so far
+	lines int
+
+	// closed when the command has exited
+	exited chan struct{}
+
+	// only used in the event loop
+	done      bool
+	cancelled bool
+	exitCode  int
+	duration  time.Duration
+}
+
+// StartJob runs the command with "sh -c" in the background. Its standard
+// output and error are added to a new scratch buffer, which becomes the current
+// buffer, as they arrive. onExit is called in the event loop once the command
+// has exited, it may be nil.
+func (e *E) StartJob(command string, onExit func(*E, *Job)) (*Job, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	// Run it in its own process group so that cancelling it also stops any
+	// processes it starts
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	// Only the command should have the pipe open, so that reading it ends
+	// when the command exits
+	w.Close()
+
+	j := &Job{
+		Command: command,
+		buf:     &Buffer{name: "[$ " + command + "]", scratch: true, rows: []*Row{{}}},
+		cmd:     cmd,
+		onExit:  onExit,
+		start:   time.Now(),
+		exited:  make(chan struct{}),
+	}
+
+	e.jobs = append(e.jobs, j)
+	e.addBuffer(j.buf)
+
+	go j.run(e, r)
+	return j, nil
+}
+
+// run streams the output of the command into its buffer until it exits
+func (j *Job) run(e *E, r io.ReadCloser) {
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	for {
+		// Add all the complete lines that are available at once
+		text, err := br.ReadString('\n')
+		for err == nil && br.Buffered() > 0 && len(text) < jobChunkSize {
+			var line string
+			line, err = br.ReadString('\n')
+			text += line
+		}
+
+		if len(text) != 0 {
+			e.Post(func(e *E) {
+				j.appendOutput(e, text)
+			})
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	j.cmd.Wait()
+	close(j.exited)
+
+	e.Post(func(e *E) {
+		j.finish(e)
+	})
+}
+
+func (j *Job) appendOutput(e *E, text string) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	rows := make([][]rune, len(lines))
+	for i, l := range lines {
+		rows[i] = []rune(strings.TrimSuffix(l, "\r"))
+	}
+
+	e.inBuffer(j.buf, func() {
+		// Keep following the output if the cursor is on the last line
+		follow := e.cy == len(e.rows)-1
+
+		if j.lines == 0 {
+			e.replaceRows(0, 1, rows)
+		} else {
+			e.InsertRows(len(e.rows), rows...)
+		}
+		j.lines += len(rows)
+
+		if follow {
+			e.SetY(len(e.rows) - 1)
+		}
+	})
+}
+
+func (j *Job) finish(e *E) {
+	j.done = true
+	j.duration = time.Since(j.start).Round(time.Millisecond)
+	j.exitCode = j.cmd.ProcessState.ExitCode()
+
+	// The status line isn't part of the output
+	lines := j.lines
+	j.appendOutput(e, fmt.Sprintf("[%s after %s]\n", j.Status(), j.duration))
+	j.lines = lines
+
+	e.SetStatusLine("$ %s: %s", j.Command, j.Status())
+
+	if j.onExit != nil {
+		j.onExit(e, j)
+	}
+}
+
+// Cancel stops the command, it is killed if it doesn't exit soon after being
+// asked to
+func (j *Job) Cancel() {
+	if j.done || j.cancelled {
+		return
+	}
+	j.cancelled = true
+
+	pgid := -j.cmd.Process.Pid
+	syscall.Kill(pgid, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-j.exited:
+		case <-time.After(jobKillDelay):
+			syscall.Kill(pgid, syscall.SIGKILL)
+		}
+	}()
+}
+
+// kill stops the command immediately, it is used when the editor exits
+func (j *Job) kill() {
+	if !j.done {
+		syscall.Kill(-j.cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// Running reports whether the command is still running
+func (j *Job) Running() bool {
+	return !j.done
+}
+
+// ExitCode is the exit code of the command once it has finished, it is -1 if
+// the command was killed by a signal
+func (j *Job) ExitCode() int {
+	return j.exitCode
+}
+
+// Status describes the state of the job, e.g. "running" or "exit 1"
+func (j *Job) Status() string {
+	switch {
+	case !j.done:
+		return "running"
+	case j.cancelled:
+		return "cancelled"
+	default:
+		return fmt.Sprintf("exit %d", j.exitCode)
+	}
+}
+
+// Buffer is the buffer with the output of the command
+func (j *Job) Buffer() *Buffer {
+	return j.buf
+}
+
+// Output returns the lines the command has output so far
+func (j *Job) Output() []string {
+	lines := make([]string, j.lines)
+	for i := range lines {
+		lines[i] = string(j.buf.rows[i].chars)
+	}
+	return lines
+}
+
+// Jobs returns all the jobs that have been started, including finished ones
+func (e *E) Jobs() []*Job {
+	return e.jobs
+}
+
+// BufferJob returns the job whose output is in the buffer, or nil
+func (e *E) BufferJob(b *Buffer) *Job {
+	for _, j := range e.jobs {
+		if j.buf == b {
+			return j
+		}
+	}
+	return nil
+}
+
+// inBuffer runs f with b as the current buffer, so that buffers that aren't
+// being shown can be edited
+func (e *E) inBuffer(b *Buffer, f func()) {
+	cur := e.Buffer
+	if cur == b {
+		f()
+		return
+	}
+
+	e.Buffer = b
+	defer func() {
+		b.commitUndo()
+		e.Buffer = cur
+	}()
+
+	f()
+}
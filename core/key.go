@@ -29,11 +29,15 @@ const (
 	ResetColorCode       = "\x1b[39m"
 	ClearLineCode        = "\x1b[K"
 	ClearScreenCode      = "\x1b[2J"
+	// The terminal draws what is between these at once
+	BeginSyncCode = "\x1b[?2026h"
+	EndSyncCode   = "\x1b[?2026l"
 )
 
 const (
-	ClearColor    = 39
-	InvertedColor = 7
+	ClearColor       = 39
+	InvertedColor    = 7
+	NotInvertedColor = 27
 )
 
 var ClearFormatting = []byte("\x1b[m")
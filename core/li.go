@@ -8,10 +8,12 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"codeberg.org/wlcsm/li/ansi"
 	"github.com/mattn/go-runewidth"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 	"golang.org/x/term"
 )
 
@@ -50,8 +52,13 @@ var (
 // * Input processing
 // * File IO
 type E struct {
-	// specify which syntax highlight to use.
-	syntax *EditorSyntax
+	// The buffer being edited, it is one of buffers
+	*Buffer
+
+	// all open buffers
+	buffers []*Buffer
+	// buffer that was edited before the current one
+	alternate *Buffer
 
 	filetypeLookup func(string) *EditorSyntax
 
@@ -60,23 +67,9 @@ type E struct {
 	colorscheme map[SyntaxHL]int
 	Errs    chan error
 
-	filename string
-
 	// status message and time the message was set
 	statusMsg string
 
-	// file content
-	rows []*Row
-
-	// cursor coordinates
-	cx, cy int // cx is an index into Row.chars
-	rx     int // rx is an index into []rune(Row.render)
-
-	// Row offset is the number of rows above the row on the top of the screen
-	// Offset is calculated in the number of runes
-	rowOffset int
-	colOffset int
-
 	// screen size
 	screenRows int
 	screenCols int
@@ -84,17 +77,67 @@ type E struct {
 	// General settings like tabstop
 	cfg DisplayConfig
 
-	// whether or not the file has been modified
-	modified bool
+	// active prompt, receives all keys instead of the keymap
+	prompt *prompt
+	// prompts waiting for the active one to finish
+	queuedPrompts []*prompt
 
-}
+	swapInterval time.Duration
+
+	// set when the editor should exit after handling the current event
+	quit bool
+
+	// functions sent from other goroutines to run in the event loop
+	posted chan func(*E)
+
+	// lines drawn over the bottom of the editor window, e.g. a list of
+	// search results
+	overlay *Overlay
+	// menu drawn next to the cursor
+	popup *Popup
+
+	// commands started with StartJob
+	jobs []*Job
+
+	// the buffers that the unfinished undo groups were started in, see
+	// StartUndoGroup
+	undoGroups []*Buffer
 
-type Callbacks struct {
-	FileOpen func(e *E, filename string) error
+	hooks Hooks
+	// mode of the keymap, see SetMode
+	mode string
+
+	// state of the terminal to restore on exit
+	termios *unix.Termios
+	// what the terminal supports, see caps.go
+	caps Caps
+	// the keys typed in the terminal, see suspend.go
+	input *terminalInput
+
+	// what is remembered between runs, see session.go
+	session *session
+
+	// positions to go back to, see mark.go. jumpIndex is the position
+	// that was last gone back to, or the end of the list.
+	jumps     []jump
+	jumpIndex int
+
+	// macro recording and replay, see macro.go
+	macro macro
+
+	mouse MouseHandler
+	// whether the left button was pressed on the text, and where
+	dragging bool
+	dragFrom Position
+
+	// the bracket under the cursor and its match, see match.go
+	bracketMatch bracketMatch
 }
 
 type DisplayConfig struct {
 	Tabstop int
+	// how files are indented when their filetype doesn't say, see indent.go
+	Indent Indent
 }
 
 type Row struct {
@@ -110,14 +153,42 @@ type Row struct {
 }
 
 type EditorConf struct {
-	Keymap    func(*E, ansi.Key) error
-	Config    DisplayConfig
+	Keymap func(*E, ansi.Key) error
+	Config DisplayConfig
+	// How often the swap file is updated, swap files are disabled when
+	// this is zero
+	SwapInterval time.Duration
+	// Hooks to run on events, more can be added with AddHook
+	Hooks Hooks
+	// How long without a key press until the Idle hooks are run, they are
+	// never run when this is zero
+	IdleTime time.Duration
+	// Mode of the keymap when the editor starts, see SetMode
+	Mode string
+	// Handles the mouse events, HandleMouse when nil
+	Mouse MouseHandler
+	// Where to remember things between runs, such as the cursor position
+	// in each file. Nothing is remembered when this is empty.
+	SessionFile string
+	// Returns the syntax of files with the extension, or nil
+	SyntaxLookup func(ext string) *EditorSyntax
+	// Terminal color of each kind of syntax
+	Colorscheme map[SyntaxHL]int
 }
 
 func NewEditor(conf EditorConf, args []string) (err error) {
+	e := &E{}
+	e.Buffer = &Buffer{rows: []*Row{{}}}
+	e.buffers = []*Buffer{e.Buffer}
+
 	defer func() {
-		if e := recover(); e != nil {
-			err = errors.Wrap(e.(error), "panic")
+		if r := recover(); r != nil {
+			// Save what we can so that it may be recovered next time
+			// the file is opened
+			for _, b := range e.buffers {
+				b.writeSwap()
+			}
+			err = errors.Wrap(panicError(r), "panic")
 		}
 	}()
 
@@ -130,69 +201,266 @@ func NewEditor(conf EditorConf, args []string) (err error) {
 	log.SetOutput(logFile)
 	log.Println("Begin logging")
 
-	SwitchToAlternateScreen(os.Stdout)
-	defer SwitchBackFromAlternateScreen(os.Stdout)
+	handoff, err := readHandoff()
+	if err != nil {
+		return err
+	}
 
 	// Set the terminal to raw mode. This allows us to directly receive the
-	// user's raw input without further processing by the terminal
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	// user's raw input without further processing by the terminal. A
+	// terminal that was handed over is otherwise already set up.
+	if handoff != nil {
+		e.caps = handoff.Caps
+		e.termios, err = makeRaw(int(os.Stdin.Fd()), &handoff.Termios)
+	} else {
+		e.caps = detectCaps(os.Getenv("TERM"), os.Getenv("COLORTERM"))
+		err = e.takeTerminal()
+	}
 	if err != nil {
 		panic(err)
 	}
-	defer term.Restore(int(os.Stdin.Fd()), oldState)
+	defer e.releaseTerminal()
 
-	e := E{}
+	e.input = &terminalInput{fd: int(os.Stdin.Fd())}
 	e.setWindowSize()
 	e.cfg = conf.Config
 	e.keymap = conf.Keymap
+	e.mouse = conf.Mouse
+	if e.mouse == nil {
+		e.mouse = HandleMouse
+	}
+	e.swapInterval = conf.SwapInterval
+	e.mode = conf.Mode
+	e.session = loadSession(conf.SessionFile)
+	e.hooks = Hooks{}
+	for ev, hooks := range conf.Hooks {
+		e.hooks[ev] = append([]Hook{}, hooks...)
+	}
+	e.filetypeLookup = conf.SyntaxLookup
+	e.colorscheme = conf.Colorscheme
 
-	if len(args) > 1 {
-		err := e.OpenFile(args[1])
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			return err
-		}
+	if handoff != nil {
+		e.restore(handoff)
 	} else {
-		e.rows = []*Row{{}}
+		for _, arg := range args[1:] {
+			err := e.OpenFile(arg)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if len(e.buffers) > 1 {
+			e.SwitchBuffer(0)
+		}
 	}
 
-	e.FullRender()
-
-	e.signals = make(chan os.Signal)
+	e.signals = make(chan os.Signal, 1)
 	signal.Notify(e.signals, syscall.SIGWINCH)
 
+	e.Errs = make(chan error)
+	e.posted = make(chan func(*E))
+	inputs := make(chan input)
+
+	d := ansi.NewDecoder(e.input)
 	go func() {
-		d := ansi.NewDecoder(os.Stdin)
 		for {
 			key, err := d.Decode()
 			if err != nil {
 				e.Errs <- err
+				if err != ansi.ErrInvalidEscape {
+					// Reading stdin failed, there won't be more keys
+					return
+				}
+				continue
 			}
 
-			if err := e.keymap(&e, key); err != nil {
-				e.Errs <- err
+			in := input{key: key}
+			switch key {
+			case ansi.PasteKey:
+				in.paste = d.Paste()
+			case ansi.MouseKey:
+				in.mouse = d.Mouse()
+			case ansi.ReplyKey:
+				in.reply = d.Reply()
 			}
+			inputs <- in
 		}
 	}()
 
-	e.Errs = make(chan error)
+	// A terminal that was handed over has already been queried
+	var queued []input
+	if handoff == nil {
+		queued = e.probeTerminal(d, inputs)
+	}
+	e.FullRender()
+
+	var swapTick <-chan time.Time
+	if e.swapInterval > 0 {
+		t := time.NewTicker(e.swapInterval)
+		defer t.Stop()
+		swapTick = t.C
+	}
+
+	fileTick := time.NewTicker(fileCheckInterval)
+	defer fileTick.Stop()
+
+	idle := time.NewTimer(conf.IdleTime)
+	if conf.IdleTime == 0 {
+		idle.Stop()
+	}
+	defer idle.Stop()
+
 	for {
+		var err error
+		moved := e.cursor()
+
+		// The input that arrived while the terminal was queried is
+		// handled first
+		var next <-chan input = inputs
+		if len(queued) != 0 {
+			ready := make(chan input, 1)
+			ready <- queued[0]
+			next = ready
+		}
+
 		select {
-		case err := <-e.Errs:
-			if err == ErrQuitEditor {
-				return nil
+		case in := <-next:
+			if len(queued) != 0 {
+				queued = queued[1:]
+			}
+			err = e.handleInput(in)
+
+			if conf.IdleTime > 0 {
+				if !idle.Stop() {
+					// Drain the timer if it fired while
+					// handling the key
+					select {
+					case <-idle.C:
+					default:
+					}
+				}
+				idle.Reset(conf.IdleTime)
+			}
+		case <-idle.C:
+			err = e.runHooks(EventInfo{Event: Idle})
+		case <-e.signals:
+			err = e.setWindowSize()
+			if err == nil {
+				err = e.runHooks(EventInfo{Event: Resize})
 			}
+		case err = <-e.Errs:
+		case f := <-e.posted:
+			f(e)
+		case <-swapTick:
+			for _, b := range e.buffers {
+				if swapErr := b.writeSwap(); swapErr != nil {
+					err = swapErr
+				}
+			}
+		case <-fileTick.C:
+			err = e.checkFiles()
+		}
+
+		if err == ErrQuitEditor || e.quit {
+			// There is nowhere left to show errors
+			if err := e.runHooks(EventInfo{Event: Quit}); err != nil {
+				log.Println(err)
+			}
+			e.saveSession()
+
+			for _, b := range e.buffers {
+				b.removeSwap()
+			}
+			for _, j := range e.jobs {
+				j.kill()
+			}
+			return nil
+		}
+
+		// Everything done in response to a single event is undone together
+		e.commitUndo()
+
+		if e.cursor() != moved {
+			e.hook(EventInfo{Event: CursorMoved})
+		}
+
+		if err != nil {
 			e.SetStatusLine("err: " + err.Error())
 		}
+
+		e.FullRender()
 	}
 }
 
+// Post runs f in the event loop, the screen is redrawn afterwards. This is how
+// other goroutines can safely use the editor. It must not be called from the
+// event loop itself, e.g. inside a keymap, as it would block forever.
+func (e *E) Post(f func(*E)) {
+	e.posted <- f
+}
+
+// Quit exits the editor once the current event has been handled, regardless of
+// any unsaved changes
+func (e *E) Quit() {
+	e.quit = true
+}
+
+// input is a key read from the terminal, text pasted into it or a mouse event
+type input struct {
+	key ansi.Key
+	// the pasted text when key is ansi.PasteKey
+	paste string
+	// the event when key is ansi.MouseKey
+	mouse ansi.Mouse
+	// the reply when key is ansi.ReplyKey
+	reply ansi.Reply
+}
+
+// handleInput gives the input to what handles it
+func (e *E) handleInput(in input) error {
+	switch in.key {
+	case ansi.PasteKey:
+		return e.paste(in.paste)
+	case ansi.MouseKey:
+		return e.mouse(e, in.mouse)
+	case ansi.ReplyKey:
+		// Replies that came after probeTerminal stopped waiting
+		e.caps.update(in.reply)
+		return nil
+	}
+	return e.dispatch(in.key)
+}
+
+// dispatch sends the key to the active prompt, or the keymap if there is none
+func (e *E) dispatch(k ansi.Key) error {
+	e.record(k)
+
+	if e.prompt != nil {
+		return e.prompt.handle(e, k)
+	}
+
+	return e.keymap(e, k)
+}
+
+// panicError converts a value recovered from a panic into an error
+func panicError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", r)
+}
+
 func (e *E) SetStatusLine(format string, a ...interface{}) {
 	e.statusMsg = fmt.Sprintf(format, a...)
 }
 
+// StatusLine returns the message on the status line
+func (e *E) StatusLine() string {
+	return e.statusMsg
+}
+
 func (e *E) detectSyntax() {
 	e.syntax = nil
-	if len(e.filename) == 0 {
+	if len(e.filename) == 0 || e.filetypeLookup == nil {
 		return
 	}
 
@@ -203,8 +471,9 @@ func (e *E) detectSyntax() {
 	}
 }
 
-func (e *E) Signals() <-chan os.Signal {
-	return e.signals
+// Syntax returns the syntax of the current buffer, or nil if it has none
+func (e *E) Syntax() *EditorSyntax {
+	return e.syntax
 }
 
 func (e *E) setWindowSize() error {
@@ -221,9 +490,9 @@ func (e *E) setWindowSize() error {
 }
 
 func (e *E) drawStatusBar(w io.Writer) {
-	w.Write(getColor(InvertedColor))
+	w.Write(e.color(InvertedColor))
 
-	filename := e.filename
+	filename := e.Name()
 	if len(filename) == 0 {
 		filename = "[No Name]"
 	}
@@ -243,7 +512,13 @@ func (e *E) drawStatusBar(w io.Writer) {
 	if e.syntax != nil {
 		filetype = e.syntax.Filetype
 	}
-	rmsg := fmt.Sprintf("%s | %d/%d", filetype, e.cy+1, len(e.rows))
+	rmsg := fmt.Sprintf("%s | %s | %d/%d", filetype, e.Indent(), e.cy+1, len(e.rows))
+	if len(e.macro.register) != 0 {
+		rmsg = fmt.Sprintf("recording @%s | %s", e.macro.register, rmsg)
+	}
+	if len(e.buffers) > 1 {
+		rmsg = fmt.Sprintf("[%d/%d] %s", e.BufferIndex()+1, len(e.buffers), rmsg)
+	}
 
 	// Add padding between the left and right message
 	l := runewidth.StringWidth(lmsg)
@@ -0,0 +1,43 @@
+package core
+
+// testSyntax is like the Go filetype of config
+var testSyntax = &EditorSyntax{
+	Filetype:         "go",
+	Scs:              "//",
+	Mcs:              "/*",
+	Mce:              "*/",
+	HighlightStrings: true,
+	IndentAfter:      "{([",
+	DedentOn:         "})]",
+}
+
+// newTestEditor returns an editor with a buffer of the rows, without a
+// terminal. The syntax may be nil.
+func newTestEditor(syntax *EditorSyntax, rows ...string) *E {
+	e := &E{
+		cfg:        DisplayConfig{Tabstop: 4},
+		hooks:      Hooks{},
+		screenRows: 24,
+		screenCols: 80,
+	}
+	e.Buffer = &Buffer{syntax: syntax}
+	e.buffers = []*Buffer{e.Buffer}
+
+	if len(rows) == 0 {
+		rows = []string{""}
+	}
+	for y, r := range rows {
+		e.rows = append(e.rows, &Row{chars: []rune(r)})
+		e.updateRow(y)
+	}
+	return e
+}
+
+// text returns the rows of the buffer
+func (e *E) text() []string {
+	rows := make([]string, len(e.rows))
+	for y, r := range e.rows {
+		rows[y] = string(r.chars)
+	}
+	return rows
+}
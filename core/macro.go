@@ -0,0 +1,90 @@
+package core
+
+import (
+	"codeberg.org/wlcsm/li/ansi"
+	"github.com/pkg/errors"
+)
+
+// How deeply macros may replay other macros, which stops a macro that replays
+// itself from going forever
+const maxReplayDepth = 20
+
+// macro is the state of recording and replaying keys
+type macro struct {
+	// register being recorded into, empty when not recording
+	register string
+	keys     []ansi.Key
+
+	// number of replays in progress
+	replaying int
+}
+
+// StartRecording records the keys given to the keymap and prompts, until
+// StopRecording saves them in the register
+func (e *E) StartRecording(register string) {
+	e.macro.register = register
+	e.macro.keys = nil
+}
+
+// StopRecording saves the recorded keys in the register as text, see
+// ansi.FormatKeys. The key being handled, which stopped the recording, isn't
+// included.
+func (e *E) StopRecording() {
+	if len(e.macro.register) == 0 {
+		return
+	}
+
+	keys := e.macro.keys
+	if len(keys) != 0 {
+		keys = keys[:len(keys)-1]
+	}
+
+	e.SetRegister(e.macro.register, ansi.FormatKeys(keys))
+	e.macro.register = ""
+	e.macro.keys = nil
+}
+
+// Recording returns the register being recorded into, or an empty string
+func (e *E) Recording() string {
+	return e.macro.register
+}
+
+// record adds the key to the macro being recorded. Keys replayed from a macro
+// aren't typed by the user, so aren't recorded.
+func (e *E) record(k ansi.Key) {
+	if len(e.macro.register) != 0 && e.macro.replaying == 0 {
+		e.macro.keys = append(e.macro.keys, k)
+	}
+}
+
+// Replay gives the keys to the keymap and prompts count times, as if they were
+// typed. The keys between a pair of ansi.PasteKey are pasted as text instead.
+// The screen isn't drawn until it is done, and it stops at the first error.
+func (e *E) Replay(keys []ansi.Key, count int) error {
+	if e.macro.replaying >= maxReplayDepth {
+		return errors.New("macros replay each other too deeply")
+	}
+
+	e.macro.replaying++
+	defer func() { e.macro.replaying-- }()
+
+	for i := 0; i < count; i++ {
+		for j := 0; j < len(keys); j++ {
+			if keys[j] != ansi.PasteKey {
+				if err := e.dispatch(keys[j]); err != nil {
+					return err
+				}
+				continue
+			}
+
+			var text []rune
+			for j++; j < len(keys) && keys[j] != ansi.PasteKey; j++ {
+				text = append(text, rune(keys[j]))
+			}
+			if err := e.paste(string(text)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
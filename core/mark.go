@@ -0,0 +1,168 @@
+package core
+
+// Maximum number of positions in the jump list
+const maxJumps = 100
+
+// Position is a place in a buffer, X is an index into the row's runes
+type Position struct {
+	Y int `json:"y"`
+	X int `json:"x"`
+}
+
+// Before reports whether p is before q in the buffer
+func (p Position) Before(q Position) bool {
+	return p.Y < q.Y || p.Y == q.Y && p.X < q.X
+}
+
+// jump is a position in the jump list
+type jump struct {
+	buf *Buffer
+	pos Position
+}
+
+// Cursor returns the position of the cursor
+func (b *Buffer) Cursor() Position {
+	return Position{Y: b.cy, X: b.cx}
+}
+
+// SetMark puts the named mark at the position. Marks move with the rows they
+// are on as the buffer is edited and are removed if their row is deleted.
+func (b *Buffer) SetMark(name string, pos Position) {
+	if b.marks == nil {
+		b.marks = map[string]Position{}
+	}
+	b.marks[name] = pos
+}
+
+// Mark returns the position of the named mark
+func (b *Buffer) Mark(name string) (Position, bool) {
+	pos, ok := b.marks[name]
+	return pos, ok
+}
+
+// GoTo moves the cursor to the position, as close as the rows allow
+func (e *E) GoTo(pos Position) {
+	e.SetY(pos.Y)
+	e.SetX(pos.X)
+}
+
+// PushJump records the cursor position in the jump list, call it before moving
+// the cursor far away. It forgets the positions after the one that JumpBack
+// last went to.
+func (e *E) PushJump() {
+	j := jump{buf: e.Buffer, pos: e.Cursor()}
+
+	e.jumps = e.jumps[:e.jumpIndex]
+
+	// Only keep the latest visit to a row
+	for i := len(e.jumps) - 1; i >= 0; i-- {
+		if e.jumps[i].buf == j.buf && e.jumps[i].pos.Y == j.pos.Y {
+			e.jumps = append(e.jumps[:i], e.jumps[i+1:]...)
+		}
+	}
+
+	e.jumps = append(e.jumps, j)
+	if len(e.jumps) > maxJumps {
+		e.jumps = e.jumps[len(e.jumps)-maxJumps:]
+	}
+	e.jumpIndex = len(e.jumps)
+}
+
+// JumpBack goes to the previous position in the jump list. It returns false if
+// there is none.
+func (e *E) JumpBack() bool {
+	if e.jumpIndex == 0 {
+		return false
+	}
+
+	// Remember where we are so that JumpForward can come back
+	if e.jumpIndex == len(e.jumps) {
+		e.PushJump()
+		if e.jumpIndex == 1 {
+			// We were at the only position in the list
+			return false
+		}
+		e.jumpIndex--
+	}
+
+	e.jumpIndex--
+	e.goToJump(e.jumps[e.jumpIndex])
+	return true
+}
+
+// JumpForward goes to the next position in the jump list after JumpBack. It
+// returns false if there is none.
+func (e *E) JumpForward() bool {
+	if e.jumpIndex+1 >= len(e.jumps) {
+		return false
+	}
+
+	e.jumpIndex++
+	e.goToJump(e.jumps[e.jumpIndex])
+	return true
+}
+
+func (e *E) goToJump(j jump) {
+	e.SwitchBuffer(Find(e.buffers, func(b *Buffer) bool { return b == j.buf }))
+	e.GoTo(j.pos)
+}
+
+// forgetJumps removes the buffer's positions from the jump list
+func (e *E) forgetJumps(b *Buffer) {
+	jumps := e.jumps[:0]
+	for i, j := range e.jumps {
+		if j.buf != b {
+			jumps = append(jumps, j)
+		} else if i < e.jumpIndex {
+			e.jumpIndex--
+		}
+	}
+	e.jumps = jumps
+}
+
+// shiftMarks moves the marks and jump list positions of the current buffer
+// after replaceRows changed its rows
+func (e *E) shiftMarks(y, oldN, newN int) {
+	if oldN == newN {
+		return
+	}
+
+	for name, pos := range e.marks {
+		if row, ok := shiftRow(pos.Y, y, oldN, newN); ok {
+			e.marks[name] = Position{Y: row, X: pos.X}
+		} else {
+			delete(e.marks, name)
+		}
+	}
+
+	jumps := e.jumps[:0]
+	for i, j := range e.jumps {
+		if j.buf == e.Buffer {
+			row, ok := shiftRow(j.pos.Y, y, oldN, newN)
+			if !ok {
+				if i < e.jumpIndex {
+					e.jumpIndex--
+				}
+				continue
+			}
+			j.pos.Y = row
+		}
+		jumps = append(jumps, j)
+	}
+	e.jumps = jumps
+}
+
+// shiftRow returns where row is after the oldN rows starting at y were replaced
+// with newN rows. Rows that were replaced stay where they are, unless there is
+// no longer a row there in which case it returns false.
+func shiftRow(row, y, oldN, newN int) (int, bool) {
+	switch {
+	case row < y:
+		return row, true
+	case row >= y+oldN:
+		return row + newN - oldN, true
+	case row < y+newN:
+		return row, true
+	}
+	return 0, false
+}
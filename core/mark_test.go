@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func numberedRows(n int) []string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = fmt.Sprint(i)
+	}
+	return rows
+}
+
+func TestShiftMarks(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		edit func(e *E)
+		// row of the mark on row 5 afterwards, or -1 if it is removed
+		row int
+	}{
+		{"insert above", func(e *E) { e.InsertRows(2, []rune("a"), []rune("b")) }, 7},
+		{"insert on the row", func(e *E) { e.InsertRows(5, []rune("a")) }, 6},
+		{"insert below", func(e *E) { e.InsertRows(6, []rune("a")) }, 5},
+		{"delete above", func(e *E) { e.ReplaceRows(1, 2) }, 3},
+		{"delete the row", func(e *E) { e.ReplaceRows(4, 6) }, -1},
+		{"delete below", func(e *E) { e.ReplaceRows(6, 8) }, 5},
+		{"replace the row", func(e *E) { e.ReplaceRows(5, 5, []rune("a")) }, 5},
+		{"replace around with as many rows", func(e *E) { e.ReplaceRows(4, 6, []rune("a"), []rune("b"), []rune("c")) }, 5},
+		{"replace around with fewer rows", func(e *E) { e.ReplaceRows(4, 6, []rune("a")) }, -1},
+		{"replace around with more rows", func(e *E) { e.ReplaceRows(4, 6, []rune("a"), []rune("b"), []rune("c"), []rune("d")) }, 5},
+	} {
+		e := newTestEditor(nil, numberedRows(10)...)
+		e.SetMark("a", Position{Y: 5, X: 1})
+		e.SetY(5)
+		e.PushJump()
+
+		test.edit(e)
+
+		pos, ok := e.Mark("a")
+		switch {
+		case test.row == -1 && ok:
+			t.Errorf("%s: mark is on row %d, expected it to be removed", test.name, pos.Y)
+		case test.row != -1 && (!ok || pos != Position{Y: test.row, X: 1}):
+			t.Errorf("%s: mark is at %v (%v), expected row %d", test.name, pos, ok, test.row)
+		}
+
+		// The jump list follows the row too
+		switch {
+		case test.row == -1 && (len(e.jumps) != 0 || e.jumpIndex != 0):
+			t.Errorf("%s: jump list is %v at %d, expected it to be empty", test.name, e.jumps, e.jumpIndex)
+		case test.row != -1 && (len(e.jumps) != 1 || e.jumps[0].pos.Y != test.row):
+			t.Errorf("%s: jump list is %v, expected row %d", test.name, e.jumps, test.row)
+		}
+	}
+}
+
+func TestJumpList(t *testing.T) {
+	e := newTestEditor(nil, numberedRows(20)...)
+
+	// Jump from 0 to 5 to 10
+	e.PushJump()
+	e.SetY(5)
+	e.PushJump()
+	e.SetY(10)
+
+	var rows []int
+	step := func(f func() bool) {
+		if f() {
+			rows = append(rows, e.cy)
+		} else {
+			rows = append(rows, -1)
+		}
+	}
+
+	step(e.JumpBack)
+	step(e.JumpBack)
+	step(e.JumpBack)
+	step(e.JumpForward)
+	step(e.JumpForward)
+	step(e.JumpForward)
+	if expected := []int{5, 0, -1, 5, 10, -1}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("jumped to the rows %v, expected %v", rows, expected)
+	}
+
+	// Jumping from an earlier position forgets the later ones
+	rows = nil
+	step(e.JumpBack)
+	step(e.JumpBack)
+	e.PushJump()
+	e.SetY(15)
+	step(e.JumpForward)
+	step(e.JumpBack)
+	step(e.JumpForward)
+	if expected := []int{5, 0, -1, 0, 15}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("jumped to the rows %v, expected %v", rows, expected)
+	}
+	if e.jumpIndex != len(e.jumps)-1 || len(e.jumps) != 2 {
+		t.Errorf("jump list %v at %d, expected 2 positions at 1", e.jumps, e.jumpIndex)
+	}
+}
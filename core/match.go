@@ -0,0 +1,308 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// The brackets that are matched in every buffer, as pairs of the opening and
+// closing bracket. Filetypes can add more, see EditorSyntax.MatchPairs.
+const defaultPairs = "()[]{}"
+
+// bracketMatch is the bracket under the cursor and its match, which are
+// highlighted. It is kept until the buffer, cursor or screen changes so that
+// it isn't looked for on every render.
+type bracketMatch struct {
+	buffer     *Buffer
+	version    int
+	cx, cy     int
+	rowOffset  int
+	screenRows int
+
+	positions []Position
+}
+
+// MatchBracket returns the position of the bracket that matches the one at p,
+// anywhere in the buffer. Brackets in strings and comments are only matched
+// with others in strings and comments. When the filetype matches tags, the
+// tag at p is matched with its opening or closing tag.
+func (e *E) MatchBracket(p Position) (Position, bool) {
+	return e.matchBracket(p, 0, len(e.rows)-1)
+}
+
+// JumpToMatch moves the cursor to the bracket that matches the first one at or
+// after the cursor on its row, like % in vi
+func (e *E) JumpToMatch() bool {
+	row := e.rows[e.cy].chars
+	pairs := e.matchPairs()
+
+	for x := e.cx; x < len(row); x++ {
+		p := Position{Y: e.cy, X: x}
+		if _, ok := e.tagAt(p); !ok && !strings.ContainsRune(pairs, row[x]) {
+			continue
+		}
+
+		match, ok := e.MatchBracket(p)
+		if !ok {
+			return false
+		}
+
+		e.PushJump()
+		e.GoTo(match)
+		return true
+	}
+	return false
+}
+
+// matchPairs returns the pairs of brackets matched in the current buffer.
+// Pairs of the same rune are left out, see EditorSyntax.MatchPairs.
+func (e *E) matchPairs() string {
+	pairs := []rune(defaultPairs)
+	if e.syntax == nil {
+		return string(pairs)
+	}
+
+	extra := []rune(e.syntax.MatchPairs)
+	for i := 0; i+1 < len(extra); i += 2 {
+		if extra[i] != extra[i+1] {
+			pairs = append(pairs, extra[i], extra[i+1])
+		}
+	}
+	return string(pairs)
+}
+
+// matchBracket returns the match of the bracket or tag at p, looking no further
+// than the rows first to last
+func (e *E) matchBracket(p Position, first, last int) (Position, bool) {
+	if first < 0 {
+		first = 0
+	}
+	if last >= len(e.rows) {
+		last = len(e.rows) - 1
+	}
+
+	row := e.rows[p.Y].chars
+	if p.X >= len(row) {
+		return Position{}, false
+	}
+
+	if start, ok := e.tagAt(p); ok {
+		return e.matchTag(start, first, last)
+	}
+
+	pairs := []rune(e.matchPairs())
+	i := -1
+	for j, r := range pairs {
+		if r == row[p.X] {
+			i = j
+			break
+		}
+	}
+	if i == -1 {
+		return Position{}, false
+	}
+
+	// Look forwards from an opening bracket and backwards from a closing
+	// one
+	same, other, dir := pairs[i], pairs[i^1], 1
+	if i%2 == 1 {
+		dir = -1
+	}
+
+	code := isCode(e.charHL(p.Y)[p.X])
+	depth := 1
+
+	return e.scan(p, dir, first, last, func(_ Position, r rune, hl SyntaxHL) bool {
+		if isCode(hl) != code {
+			return false
+		}
+
+		switch r {
+		case same:
+			depth++
+		case other:
+			depth--
+		}
+		return depth == 0
+	})
+}
+
+// scan calls f with the positions of the runes from the one after p in the
+// direction, which is 1 for forwards and -1 for backwards, the runes and their
+// highlight. It stops at the rows first or last, or when f returns true,
+// returning where it stopped.
+func (e *E) scan(p Position, dir, first, last int, f func(q Position, r rune, hl SyntaxHL) bool) (Position, bool) {
+	x := p.X + dir
+	for y := p.Y; y >= first && y <= last; y += dir {
+		row := e.rows[y].chars
+		hl := e.charHL(y)
+
+		if y != p.Y || dir < 0 && x >= len(row) {
+			x = 0
+			if dir < 0 {
+				x = len(row) - 1
+			}
+		}
+
+		for ; x >= 0 && x < len(row); x += dir {
+			q := Position{Y: y, X: x}
+			if f(q, row[x], hl[x]) {
+				return q, true
+			}
+		}
+	}
+	return Position{}, false
+}
+
+// charHL returns the highlight of each rune of the row, rather than of each
+// rune of its render, see updateRow
+func (e *E) charHL(y int) []SyntaxHL {
+	row := e.rows[y]
+	tabstop := e.Tabstop()
+
+	hl := make([]SyntaxHL, len(row.chars))
+	i, cols := 0, 0
+	for x, r := range row.chars {
+		hl[x] = HLNormal
+		if i < len(row.hl) {
+			hl[x] = row.hl[i]
+		}
+
+		n := runewidth.RuneWidth(r)
+		if r == '\t' {
+			n = tabstop - cols%tabstop
+			i += n - 1
+		}
+		i++
+		cols += n
+	}
+	return hl
+}
+
+// isCode reports whether a rune with the highlight isn't in a string or
+// comment
+func isCode(hl SyntaxHL) bool {
+	return hl != HLString && hl != HLComment && hl != HLMlComment
+}
+
+// isComment reports whether a rune with the highlight is in a comment
+func isComment(hl SyntaxHL) bool {
+	return hl == HLComment || hl == HLMlComment
+}
+
+// tagAt returns the start of the tag that p is on, when the filetype matches
+// tags. The cursor can be on the < or / or the name of the tag.
+func (e *E) tagAt(p Position) (Position, bool) {
+	if e.syntax == nil || !e.syntax.MatchTags {
+		return Position{}, false
+	}
+
+	row := e.rows[p.Y].chars
+	x := p.X
+	for ; x >= 0 && x < len(row) && row[x] != '<'; x-- {
+		if row[x] != '/' && !isTagNameRune(row[x]) {
+			return Position{}, false
+		}
+	}
+	if x < 0 || x >= len(row) || isComment(e.charHL(p.Y)[x]) {
+		return Position{}, false
+	}
+
+	if name, _ := tagName(row[x:]); len(name) == 0 {
+		return Position{}, false
+	}
+	return Position{Y: p.Y, X: x}, true
+}
+
+// matchTag returns the start of the tag that matches the one that starts at
+// p, the closing tag of an opening tag and the other way around. Tags that
+// close themselves, like <br/>, aren't counted.
+func (e *E) matchTag(p Position, first, last int) (Position, bool) {
+	row := e.rows[p.Y].chars
+	name, closing := tagName(row[p.X:])
+
+	dir := 1
+	if closing {
+		dir = -1
+	}
+	depth := 1
+
+	return e.scan(p, dir, first, last, func(q Position, r rune, hl SyntaxHL) bool {
+		if r != '<' || isComment(hl) {
+			return false
+		}
+
+		row := e.rows[q.Y].chars[q.X:]
+		n, c := tagName(row)
+		if !strings.EqualFold(n, name) || selfClosing(row) {
+			return false
+		}
+
+		if c == closing {
+			depth++
+		} else {
+			depth--
+		}
+		return depth == 0
+	})
+}
+
+// tagName returns the name of the tag at the start of s, which starts with <,
+// and whether it is a closing tag
+func tagName(s []rune) (string, bool) {
+	s = s[1:]
+	closing := len(s) != 0 && s[0] == '/'
+	if closing {
+		s = s[1:]
+	}
+
+	n := 0
+	for n < len(s) && isTagNameRune(s[n]) {
+		n++
+	}
+	if n == 0 || !unicode.IsLetter(s[0]) {
+		return "", false
+	}
+	return string(s[:n]), closing
+}
+
+func isTagNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == ':' || r == '.' || r == '_'
+}
+
+// selfClosing reports whether the tag at the start of s ends with />. Tags that
+// don't end on the same row are taken to not close themselves.
+func selfClosing(s []rune) bool {
+	end := strings.IndexRune(string(s), '>')
+	return end > 0 && strings.HasSuffix(string(s)[:end], "/")
+}
+
+// cursorMatch returns the bracket under the cursor and its match, if they are
+// both on the screen
+func (e *E) cursorMatch() []Position {
+	m := &e.bracketMatch
+	if m.buffer == e.Buffer && m.version == e.version && m.cx == e.cx && m.cy == e.cy &&
+		m.rowOffset == e.rowOffset && m.screenRows == e.screenRows {
+		return m.positions
+	}
+
+	*m = bracketMatch{
+		buffer:     e.Buffer,
+		version:    e.version,
+		cx:         e.cx,
+		cy:         e.cy,
+		rowOffset:  e.rowOffset,
+		screenRows: e.screenRows,
+	}
+
+	p := e.Cursor()
+	if start, ok := e.tagAt(p); ok {
+		p = start
+	}
+	if match, ok := e.matchBracket(p, e.rowOffset, e.rowOffset+e.screenRows-1); ok {
+		m.positions = []Position{p, match}
+	}
+	return m.positions
+}
@@ -0,0 +1,60 @@
+package core
+
+import "testing"
+
+func TestMatchBracket(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		syntax *EditorSyntax
+		rows   []string
+		p      Position
+		match  Position
+		ok     bool
+	}{
+		{"forwards", nil, []string{"f(a(b), c)"}, Position{X: 1}, Position{X: 9}, true},
+		{"backwards", nil, []string{"f(a(b), c)"}, Position{X: 9}, Position{X: 1}, true},
+		{"not a bracket", nil, []string{"f(a)"}, Position{X: 0}, Position{}, false},
+		{"unmatched", nil, []string{"f(a"}, Position{X: 1}, Position{}, false},
+		{"across rows", testSyntax, []string{"func f() {", "\tif x {", "\t}", "}"}, Position{X: 9}, Position{Y: 3}, true},
+		{"across rows backwards", testSyntax, []string{"func f() {", "\tif x {", "\t}", "}"}, Position{Y: 2, X: 1}, Position{Y: 1, X: 6}, true},
+		// Brackets in strings and comments are skipped
+		{"string", testSyntax, []string{`f(")", b)`}, Position{X: 1}, Position{X: 8}, true},
+		{"comment", testSyntax, []string{"f(a, // )", "b)"}, Position{X: 1}, Position{Y: 1, X: 1}, true},
+		{"multiline comment", testSyntax, []string{"f(a /* ) */, b)"}, Position{X: 1}, Position{X: 14}, true},
+		// But are matched with each other
+		{"in a string", testSyntax, []string{`f("(x)")`}, Position{X: 3}, Position{X: 5}, true},
+		{"in a string unmatched", testSyntax, []string{`f(")")`}, Position{X: 3}, Position{}, false},
+		// The tab is wider than a rune, the highlight of the bracket
+		// mustn't be taken from the string that is drawn over it
+		{"after tabs", testSyntax, []string{"\t\"(\" (a)"}, Position{X: 5}, Position{X: 7}, true},
+		{"string after tabs", testSyntax, []string{"\t\t\"(\" (a)"}, Position{X: 3}, Position{}, false},
+		{"tags", testHTML, []string{"<div>", "<p>a</p>", "</div>"}, Position{}, Position{Y: 2}, true},
+		{"closing tag", testHTML, []string{"<div>", "<p>a</p>", "</div>"}, Position{Y: 2, X: 2}, Position{}, true},
+		{"nested tags", testHTML, []string{"<div><div>a</div><br/></div>"}, Position{}, Position{X: 22}, true},
+		{"inner tag", testHTML, []string{"<div><div>a</div><br/></div>"}, Position{X: 6}, Position{X: 11}, true},
+		{"self closing tag", testHTML, []string{"<p><br/>a</p>"}, Position{X: 3}, Position{}, false},
+		{"tag after self closing", testHTML, []string{"<p><br/>a</p>"}, Position{X: 9}, Position{}, true},
+	} {
+		e := newTestEditor(test.syntax, test.rows...)
+
+		match, ok := e.MatchBracket(test.p)
+		if ok != test.ok || ok && match != test.match {
+			t.Errorf("%s: match of %v is %v (%v), expected %v (%v)", test.name, test.p, match, ok, test.match, test.ok)
+		}
+	}
+}
+
+// Pairs of the same rune can't be matched, which one opens is unknown
+func TestMatchPairsSame(t *testing.T) {
+	e := newTestEditor(&EditorSyntax{MatchPairs: "<>||"}, "a <|b|> c")
+
+	if pairs := e.matchPairs(); pairs != "()[]{}<>" {
+		t.Errorf("matched pairs are %q, expected ()[]{}<>", pairs)
+	}
+	if match, ok := e.MatchBracket(Position{X: 3}); ok {
+		t.Errorf("| matched with %v", match)
+	}
+	if match, ok := e.MatchBracket(Position{X: 2}); !ok || match != (Position{X: 6}) {
+		t.Errorf("< matched with %v (%v), expected {0 6}", match, ok)
+	}
+}
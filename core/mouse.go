@@ -0,0 +1,226 @@
+package core
+
+import (
+	"io"
+	"strings"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"github.com/mattn/go-runewidth"
+)
+
+// Number of rows the mouse wheel scrolls
+const wheelRows = 3
+
+// MouseHandler handles the mouse events, like the keymap handles keys
+type MouseHandler func(e *E, m ansi.Mouse) error
+
+// EnableMouse asks the terminal to report mouse presses, releases and drags in
+// the SGR encoding
+func EnableMouse(w io.Writer) {
+	w.Write([]byte("\033[?1002h\033[?1006h"))
+}
+
+func DisableMouse(w io.Writer) {
+	w.Write([]byte("\033[?1006l\033[?1002l"))
+}
+
+// Selection is the text from Start to End inclusive. Start is where the
+// selection was started, so it may be after End.
+type Selection struct {
+	Start, End Position
+}
+
+// Ordered returns the start and end of the selection in the order they are in
+// the buffer
+func (s Selection) Ordered() (Position, Position) {
+	if s.End.Y < s.Start.Y || s.End.Y == s.Start.Y && s.End.X < s.Start.X {
+		return s.End, s.Start
+	}
+	return s.Start, s.End
+}
+
+// Selection returns the selection of the current buffer, if there is one
+func (b *Buffer) Selection() (Selection, bool) {
+	if b.selection == nil {
+		return Selection{}, false
+	}
+	return *b.selection, true
+}
+
+// SetSelection selects the text, it is shown highlighted. The selection is
+// cleared when the buffer is changed.
+func (b *Buffer) SetSelection(s Selection) {
+	b.selection = &s
+}
+
+func (b *Buffer) ClearSelection() {
+	b.selection = nil
+}
+
+// SelectedText returns the text of the selection, or an empty string if there
+// is none
+func (b *Buffer) SelectedText() string {
+	if b.selection == nil {
+		return ""
+	}
+
+	from, to := b.selection.Ordered()
+	lines := make([]string, 0, to.Y-from.Y+1)
+	for y := from.Y; y <= to.Y && y < len(b.rows); y++ {
+		row := b.rows[y].chars
+
+		start, end := 0, len(row)
+		if y == from.Y && from.X < len(row) {
+			start = from.X
+		} else if y == from.Y {
+			start = len(row)
+		}
+		if y == to.Y && to.X < len(row) {
+			end = to.X + 1
+		}
+		if end < start {
+			end = start
+		}
+		lines = append(lines, string(row[start:end]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// selectedRange returns the part of the rendered row y that is selected, from
+// start up to but not including end. It is empty when none of it is.
+func (b *Buffer) selectedRange(y, tabstop int) (start, end int) {
+	if b.selection == nil {
+		return 0, 0
+	}
+
+	from, to := b.selection.Ordered()
+	if y < from.Y || y > to.Y {
+		return 0, 0
+	}
+
+	row := b.rows[y].chars
+	end = renderIndex(row, tabstop, len(row))
+	if y == from.Y {
+		start = renderIndex(row, tabstop, from.X)
+	}
+	if y == to.Y && to.X < len(row) {
+		end = renderIndex(row, tabstop, to.X+1)
+	}
+	return start, end
+}
+
+// renderIndex returns the index in the rendered row of the rune at cx, see
+// updateRow
+func renderIndex(row []rune, tabstop, cx int) int {
+	if cx > len(row) {
+		cx = len(row)
+	}
+
+	i, cols := 0, 0
+	for _, r := range row[:cx] {
+		if r != '\t' {
+			i++
+			cols += runewidth.RuneWidth(r)
+			continue
+		}
+
+		n := tabstop - cols%tabstop
+		i += n
+		cols += n
+	}
+	return i
+}
+
+// HandleMouse is the default MouseHandler. Clicking moves the cursor, dragging
+// selects the text and the wheel scrolls.
+func HandleMouse(e *E, m ansi.Mouse) error {
+	switch m.Button {
+	case ansi.WheelUp:
+		e.scrollRows(-wheelRows)
+		return nil
+	case ansi.WheelDown:
+		e.scrollRows(wheelRows)
+		return nil
+	case ansi.MouseLeft:
+	default:
+		return nil
+	}
+
+	pos, ok := e.screenPosition(m.X, m.Y)
+
+	switch m.Action {
+	case ansi.MousePress:
+		e.dragging = ok
+		if !ok {
+			return nil
+		}
+
+		e.ClearSelection()
+		e.dragFrom = pos
+		e.GoTo(pos)
+	case ansi.MouseMotion:
+		if !e.dragging {
+			return nil
+		}
+
+		// Keep selecting when the mouse is dragged off the text
+		if !ok {
+			pos = e.nearestPosition(m.X, m.Y)
+		}
+		e.SetSelection(Selection{Start: e.dragFrom, End: pos})
+		e.GoTo(pos)
+	case ansi.MouseRelease:
+		e.dragging = false
+	}
+	return nil
+}
+
+// screenPosition returns the position in the buffer shown at the cell of the
+// screen. It returns false if the cell isn't showing the buffer's text.
+func (e *E) screenPosition(x, y int) (Position, bool) {
+	rows := e.screenRows
+	if e.overlay != nil {
+		rows -= len(e.overlay.Lines)
+	}
+	if y < 0 || y >= rows || x < e.gutterWidth() || x >= e.screenCols {
+		return Position{}, false
+	}
+	return e.nearestPosition(x, y), true
+}
+
+// nearestPosition returns the position in the buffer nearest to the cell of
+// the screen
+func (e *E) nearestPosition(x, y int) Position {
+	if y < 0 {
+		y = 0
+	}
+	row := y + e.rowOffset
+	if row >= len(e.rows) {
+		row = len(e.rows) - 1
+	}
+
+	rx := x - e.gutterWidth()
+	if rx < 0 {
+		rx = 0
+	}
+	rx += e.colOffset
+
+	return Position{Y: row, X: RxToCx(e.rows[row].chars, e.Tabstop(), rx)}
+}
+
+// scrollRows scrolls the screen by n rows, moving the cursor along if it would
+// be scrolled off the screen
+func (e *E) scrollRows(n int) {
+	offset := e.rowOffset + n
+	if offset >= len(e.rows) {
+		offset = len(e.rows) - 1
+	}
+	e.SetRowOffset(offset)
+
+	switch {
+	case e.cy < e.rowOffset:
+		e.SetY(e.rowOffset)
+	case e.cy >= e.rowOffset+e.screenRows:
+		e.SetY(e.rowOffset + e.screenRows - 1)
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"testing"
+
+	"codeberg.org/wlcsm/li/ansi"
+)
+
+func TestScreenPosition(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		rowOffset int
+		signs     bool
+		overlay   int
+		x, y      int
+		pos       Position
+		ok        bool
+	}{
+		{name: "first row", x: 1, y: 0, pos: Position{Y: 0, X: 1}, ok: true},
+		{name: "scrolled", rowOffset: 1, x: 1, y: 0, pos: Position{Y: 1, X: 0}, ok: true},
+		// The tab is drawn as 4 cells
+		{name: "on a tab", x: 2, y: 1, pos: Position{Y: 1, X: 0}, ok: true},
+		{name: "after a tab", x: 4, y: 1, pos: Position{Y: 1, X: 1}, ok: true},
+		{name: "after the end of the row", x: 20, y: 1, pos: Position{Y: 1, X: 2}, ok: true},
+		// Wide runes are drawn as 2 cells
+		{name: "wide rune", x: 3, y: 2, pos: Position{Y: 2, X: 1}, ok: true},
+		{name: "after a wide rune", x: 4, y: 2, pos: Position{Y: 2, X: 2}, ok: true},
+		{name: "wide rune scrolled", rowOffset: 2, x: 2, y: 0, pos: Position{Y: 2, X: 1}, ok: true},
+		{name: "after the last row", x: 0, y: 10, pos: Position{Y: 3, X: 0}, ok: true},
+		{name: "status bar", x: 0, y: 24, ok: false},
+		{name: "past the screen", x: 80, y: 0, ok: false},
+		// The sign column isn't text
+		{name: "sign column", signs: true, x: 1, y: 0, ok: false},
+		{name: "after the sign column", signs: true, x: 3, y: 0, pos: Position{Y: 0, X: 1}, ok: true},
+		{name: "overlay", overlay: 2, x: 0, y: 22, ok: false},
+		{name: "above the overlay", overlay: 2, x: 0, y: 21, pos: Position{Y: 3, X: 0}, ok: true},
+	} {
+		e := newTestEditor(nil, "abc", "\tx", "日本語", "end")
+		e.rowOffset = test.rowOffset
+		if test.signs {
+			e.SetSigns(map[int]Sign{0: {}})
+		}
+		if test.overlay != 0 {
+			e.SetOverlay(&Overlay{Lines: make([]string, test.overlay)})
+		}
+
+		pos, ok := e.screenPosition(test.x, test.y)
+		if ok != test.ok || ok && pos != test.pos {
+			t.Errorf("%s: %d,%d is %v (%v), expected %v (%v)", test.name, test.x, test.y, pos, ok, test.pos, test.ok)
+		}
+	}
+}
+
+func TestMouseDrag(t *testing.T) {
+	e := newTestEditor(nil, "one", "two", "three")
+
+	mouse := func(action ansi.MouseAction, x, y int) {
+		if err := HandleMouse(e, ansi.Mouse{Button: ansi.MouseLeft, Action: action, X: x, Y: y}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mouse(ansi.MousePress, 1, 0)
+	if e.cy != 0 || e.cx != 1 {
+		t.Errorf("click moved the cursor to %d,%d, expected 0,1", e.cy, e.cx)
+	}
+	if _, ok := e.Selection(); ok {
+		t.Errorf("click selected text")
+	}
+
+	mouse(ansi.MouseMotion, 2, 1)
+	if text := e.SelectedText(); text != "ne\ntwo" {
+		t.Errorf("dragging selected %q, expected \"ne\\ntwo\"", text)
+	}
+
+	// Dragging off the text keeps selecting to the nearest position
+	mouse(ansi.MouseMotion, 1, 10)
+	if text := e.SelectedText(); text != "ne\ntwo\nth" {
+		t.Errorf("dragging off the text selected %q, expected \"ne\\ntwo\\nth\"", text)
+	}
+	if e.cy != 2 || e.cx != 1 {
+		t.Errorf("dragging moved the cursor to %d,%d, expected 2,1", e.cy, e.cx)
+	}
+
+	mouse(ansi.MouseRelease, 1, 10)
+	mouse(ansi.MouseMotion, 0, 0)
+	if s, _ := e.Selection(); s != (Selection{Start: Position{X: 1}, End: Position{Y: 2, X: 1}}) {
+		t.Errorf("selection changed to %+v after the button was released", s)
+	}
+
+	// Dragging backwards
+	mouse(ansi.MousePress, 2, 2)
+	mouse(ansi.MouseMotion, 1, 1)
+	if text := e.SelectedText(); text != "wo\nthr" {
+		t.Errorf("dragging backwards selected %q, expected \"wo\\nthr\"", text)
+	}
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The pairs that are inserted together when the filetype doesn't say, see
+// EditorSyntax.AutoPairs
+const defaultAutoPairs = `()[]{}""''`
+
+// autoPairs returns the pairs of the current buffer
+func (e *E) autoPairs() []rune {
+	if e.syntax == nil || len(e.syntax.AutoPairs) == 0 {
+		return []rune(defaultAutoPairs)
+	}
+
+	pairs := []rune(e.syntax.AutoPairs)
+	return pairs[:len(pairs)&^1]
+}
+
+// InsertPaired types r at the cursor like insert mode does, pairing brackets
+// and quotes. The closing one of a pair is inserted after an opening one, and
+// typing a closing one that is already under the cursor moves over it. Pairs
+// aren't inserted in strings or comments, before text or, for quotes, after
+// it. It returns false if r isn't part of a pair, for the caller to insert it.
+func (e *E) InsertPaired(r rune) bool {
+	pairs := e.autoPairs()
+	row := e.rows[e.cy].chars
+	x := e.cx
+
+	i := -1
+	for j, p := range pairs {
+		if p == r {
+			i = j
+			break
+		}
+	}
+	if i == -1 {
+		return false
+	}
+
+	// Move over the closing one
+	if i%2 == 1 || pairs[i] == pairs[i+1] {
+		if x < len(row) && row[x] == r {
+			e.SetX(x + 1)
+			return true
+		}
+	}
+	if i%2 == 1 {
+		return false
+	}
+
+	if e.inStringOrComment(e.cy, x) {
+		return false
+	}
+	if x < len(row) && !unicode.IsSpace(row[x]) && !strings.ContainsRune(closers(pairs), row[x]) {
+		return false
+	}
+	// The quote of "don't" or the prime of x' aren't opening quotes
+	if pairs[i] == pairs[i+1] && x > 0 && isWordRune(row[x-1]) {
+		return false
+	}
+
+	e.InsertChars(e.cy, x, pairs[i], pairs[i+1])
+	e.SetX(x + 1)
+	return true
+}
+
+// DeletePair deletes the pair that the cursor is between, when nothing is
+// between them, like backspace after InsertPaired. It returns false if the
+// cursor isn't between a pair.
+func (e *E) DeletePair() bool {
+	pairs := e.autoPairs()
+	row := e.rows[e.cy].chars
+	x := e.cx
+
+	if x == 0 || x >= len(row) {
+		return false
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if row[x-1] == pairs[i] && row[x] == pairs[i+1] {
+			e.DeleteChars(e.cy, x-1, x+1)
+			e.SetX(x - 1)
+			return true
+		}
+	}
+	return false
+}
+
+// closers returns the closing runes of the pairs
+func closers(pairs []rune) string {
+	var b strings.Builder
+	for i := 1; i < len(pairs); i += 2 {
+		b.WriteRune(pairs[i])
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// inStringOrComment reports whether text typed at x in row y would be in a
+// string or comment, from the highlight of the rune before it
+func (e *E) inStringOrComment(y, x int) bool {
+	if x == 0 {
+		return y > 0 && e.rows[y-1].hasUnclosedComment
+	}
+
+	row := e.rows[y].chars
+	hl := e.charHL(y)
+
+	switch hl[x-1] {
+	case HLComment:
+		return true
+	case HLMlComment:
+		// After the end of the comment is outside it
+		return e.syntax == nil || !strings.HasSuffix(string(row[:x]), e.syntax.Mce)
+	case HLString:
+		// The string ends at its closing quote, which is the same as the
+		// quote that starts it
+		start := x - 1
+		for start > 0 && hl[start-1] == HLString {
+			start--
+		}
+
+		end := x - 1
+		escaped := end > 0 && row[end-1] == '\\' && hl[end-1] == HLString
+		return end == start || row[end] != row[start] || escaped
+	}
+	return false
+}
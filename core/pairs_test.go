@@ -0,0 +1,115 @@
+package core
+
+import "testing"
+
+func TestInsertPaired(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		row  string
+		x    int
+		r    rune
+
+		handled bool
+		result  string
+		cx      int
+	}{
+		{"bracket", "f", 1, '(', true, "f()", 2},
+		{"quote", "x := ", 5, '"', true, `x := ""`, 6},
+		{"before a closer", "f()", 2, '[', true, "f([])", 3},
+		{"before a space", "f x", 1, '{', true, "f{} x", 2},
+		{"not a pair", "f", 1, 'x', false, "f", 1},
+
+		// The closing one already there is moved over
+		{"over a bracket", "f()", 2, ')', true, "f()", 3},
+		{"over a quote", `x := "ab"`, 8, '"', true, `x := "ab"`, 9},
+		{"closer that isn't there", "f(a", 3, ')', false, "f(a", 3},
+
+		{"before text", "foo", 0, '(', false, "foo", 0},
+		{"apostrophe", "don", 3, '\'', false, "don", 3},
+		{"in a string", `x := "a `, 8, '(', false, `x := "a `, 8},
+		{"in a comment", "x // a ", 7, '(', false, "x // a ", 7},
+		{"after a string", `x := "a" + `, 11, '"', true, `x := "a" + ""`, 12},
+
+		{"backtick", "x := ", 5, '`', false, "x := ", 5},
+	} {
+		e := newTestEditor(testSyntax, test.row)
+		e.SetX(test.x)
+
+		handled := e.InsertPaired(test.r)
+		if handled != test.handled || string(e.Row(0)) != test.result || e.cx != test.cx {
+			t.Errorf("%s: InsertPaired(%q) on %q = %v with %q and cursor at %d, expected %v with %q and %d",
+				test.name, test.r, test.row, handled, string(e.Row(0)), e.cx, test.handled, test.result, test.cx)
+		}
+	}
+}
+
+func TestAutoPairs(t *testing.T) {
+	syntax := *testSyntax
+	syntax.AutoPairs = "``("
+
+	e := newTestEditor(&syntax, "")
+	if !e.InsertPaired('`') || string(e.Row(0)) != "``" {
+		t.Errorf("backticks aren't paired, the row is %q", string(e.Row(0)))
+	}
+
+	// The last rune has no pair
+	if e.InsertPaired('(') {
+		t.Errorf("( without a pair is paired")
+	}
+}
+
+func TestDeletePair(t *testing.T) {
+	for _, test := range []struct {
+		row string
+		x   int
+
+		deleted bool
+		result  string
+	}{
+		{"f()", 2, true, "f"},
+		{`x := ""`, 6, true, "x := "},
+		{"[]", 1, true, ""},
+		{"(a)", 1, false, "(a)"},
+		{"(a)", 2, false, "(a)"},
+		{"(]", 1, false, "(]"},
+		{"(", 1, false, "("},
+		{"()", 0, false, "()"},
+	} {
+		e := newTestEditor(testSyntax, test.row)
+		e.SetX(test.x)
+
+		deleted := e.DeletePair()
+		if deleted != test.deleted || string(e.Row(0)) != test.result {
+			t.Errorf("DeletePair on %q at %d = %v with %q, expected %v with %q",
+				test.row, test.x, deleted, string(e.Row(0)), test.deleted, test.result)
+		}
+		if deleted && e.cx != test.x-1 {
+			t.Errorf("DeletePair on %q at %d leaves the cursor at %d", test.row, test.x, e.cx)
+		}
+	}
+}
+
+func TestInStringOrComment(t *testing.T) {
+	for _, test := range []struct {
+		rows []string
+		y, x int
+		in   bool
+	}{
+		{[]string{`a := "b" + c`}, 0, 5, false},
+		{[]string{`a := "b" + c`}, 0, 6, true},
+		{[]string{`a := "b" + c`}, 0, 7, true},
+		{[]string{`a := "b" + c`}, 0, 8, false},
+		{[]string{`a := "b\"`}, 0, 9, true},
+		{[]string{"a // b"}, 0, 1, false},
+		{[]string{"a // b"}, 0, 6, true},
+		{[]string{"/* a", "b"}, 1, 0, true},
+		{[]string{"/* a */ b"}, 0, 4, true},
+		{[]string{"/* a */ b"}, 0, 7, false},
+		{[]string{"a", "b"}, 1, 0, false},
+	} {
+		e := newTestEditor(testSyntax, test.rows...)
+		if in := e.inStringOrComment(test.y, test.x); in != test.in {
+			t.Errorf("inStringOrComment in %q at %d,%d = %v, expected %v", test.rows, test.x, test.y, in, test.in)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"strings"
+
+	"codeberg.org/wlcsm/li/ansi"
+)
+
+// paste inserts text pasted into the terminal at the cursor, as a single change
+// that isn't seen by the keymap. Text pasted into a prompt is typed into it
+// instead, without the newlines. A macro being recorded records the text
+// between a pair of ansi.PasteKey, see Replay.
+func (e *E) paste(text string) error {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if e.prompt != nil {
+		for _, r := range text {
+			if r == '\n' {
+				continue
+			}
+			if err := e.dispatch(ansi.Key(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(text) == 0 {
+		return nil
+	}
+
+	e.record(ansi.PasteKey)
+	for _, r := range text {
+		e.record(ansi.Key(r))
+	}
+	e.record(ansi.PasteKey)
+
+	y, x := e.cy, e.cx
+	e.ReplaceText(y, x, y, x, text)
+
+	// Leave the cursor after the text
+	lines := strings.Split(text, "\n")
+	last := len([]rune(lines[len(lines)-1]))
+	if len(lines) == 1 {
+		last += x
+	}
+	e.SetY(y + len(lines) - 1)
+	e.SetX(last)
+	return nil
+}
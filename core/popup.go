@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Background color of the popup lines that aren't selected
+const popupColor = 100
+
+// Popup is a menu drawn next to the cursor, e.g. to show completions
+type Popup struct {
+	Lines []string
+	// Index of the line to highlight, or -1 for none
+	Selected int
+	// The popup is lined up with this character of the cursor's row
+	X int
+}
+
+// SetPopup shows the popup below the cursor, or above it when there isn't room.
+// Give nil to remove it.
+func (e *E) SetPopup(p *Popup) {
+	e.popup = p
+}
+
+func (e *E) drawPopup(w io.Writer) {
+	p := e.popup
+	if p == nil || len(p.Lines) == 0 {
+		return
+	}
+
+	width := 0
+	for _, l := range p.Lines {
+		if n := runewidth.StringWidth(l); n > width {
+			width = n
+		}
+	}
+	// Leave a space on either side of the text
+	width += 2
+	if width > e.screenCols {
+		width = e.screenCols
+	}
+
+	lines := p.Lines
+	y := e.cy - e.rowOffset + 1
+	if y+len(lines) > e.screenRows {
+		if e.cy-e.rowOffset >= len(lines) {
+			y = e.cy - e.rowOffset - len(lines)
+		} else {
+			lines = lines[:e.screenRows-y]
+		}
+	}
+
+	x := CxToRx(e.rows[e.cy].chars, e.Tabstop(), p.X) - e.colOffset + e.gutterWidth()
+	if x+width > e.screenCols {
+		x = e.screenCols - width
+	}
+	if x < 0 {
+		x = 0
+	}
+
+	for i, l := range lines {
+		fmt.Fprintf(w, "\x1b[%d;%dH", y+i+1, x+1)
+
+		if i == p.Selected {
+			w.Write(e.color(InvertedColor))
+		} else {
+			w.Write(e.color(popupColor))
+		}
+
+		l = runewidth.Truncate(l, width-2, "")
+		w.Write([]byte(" " + runewidth.FillRight(l, width-2) + " "))
+		w.Write(ClearFormatting)
+	}
+}
@@ -2,24 +2,54 @@ package core
 
 import "codeberg.org/wlcsm/li/ansi"
 
-// Prompt shows the given prompt in the status bar and get user input
-func (e *E) Prompt(prompt string, keymap func(k ansi.Key) string) {
+type prompt struct {
+	text   string
+	keymap func(k ansi.Key) (string, bool, error)
+	// last message displayed by the prompt
+	shown string
+}
+
+// Prompt shows the given prompt in the status bar and sends all user input to
+// keymap until it reports that it is done. The string returned from keymap is
+// displayed after the prompt. An error returned from keymap is handled like
+// one from the keymap of the editor, and stops a macro being replayed.
+//
+// If a prompt is already active then this one is shown after it is done.
+func (e *E) Prompt(text string, keymap func(k ansi.Key) (string, bool, error)) {
 	if keymap == nil {
 		panic("can't give a nil function to prompt")
 	}
 
-	e.SetStatusLine(prompt)
-
-	panic("not implemented")
-	//	e.SetBackupKeymap()
-	//	e.SetKeymap(func(e *E, k Key) error {
-	//		if k == EnterKey {
-	//			e.RestoreBackup()
-	//			return nil
-	//		}
-	//
-	//		s := keymap(k)
-	//		e.SetStatusLine(prompt + s)
-	//		return nil
-	//	})
+	p := &prompt{text: text, keymap: keymap, shown: text}
+	if e.prompt != nil {
+		e.queuedPrompts = append(e.queuedPrompts, p)
+		return
+	}
+
+	e.prompt = p
+	e.SetStatusLine("%s", text)
+}
+
+func (p *prompt) handle(e *E, k ansi.Key) error {
+	s, done, err := p.keymap(k)
+	if !done {
+		p.shown = p.text + s
+		e.SetStatusLine("%s", p.shown)
+		return err
+	}
+
+	// Clear the prompt unless something else has been displayed
+	if e.statusMsg == p.shown {
+		e.SetStatusLine("")
+	}
+
+	e.prompt = nil
+	if len(e.queuedPrompts) != 0 {
+		next := e.queuedPrompts[0]
+		e.queuedPrompts = e.queuedPrompts[1:]
+
+		e.prompt = next
+		e.SetStatusLine("%s", next.text)
+	}
+	return err
 }
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"encoding/gob"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Reexec writes the state of the editor to a temporary file, named by this
+// environment variable, which the new process reads back on startup
+const handoffEnv = "LI_HANDOFF"
+
+// handoff is the state of the editor that is passed to the new process
+type handoff struct {
+	Buffers   []bufferState
+	Current   int
+	Alternate int
+
+	Mode      string
+	StatusMsg string
+
+	// state of the terminal before li put it in raw mode
+	Termios unix.Termios
+	Caps    Caps
+}
+
+type bufferState struct {
+	Filename string
+	Scratch  bool
+	Name     string
+
+	Rows [][]rune
+
+	Cx, Cy, Rx           int
+	RowOffset, ColOffset int
+
+	Modified bool
+	Undo     []undoState
+	Redo     []undoState
+
+	SwapPath string
+	// whether the swap file is up to date
+	Swapped bool
+
+	// state of the file when it was last read or written
+	Disk *fileState
+
+	Marks  map[string]Position
+	Indent Indent
+
+	Tabstop    int
+	FileFormat fileFormat
+}
+
+type undoState struct {
+	Changes []Change
+	Cx, Cy  int
+}
+
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// staleFile stands in for a file that was changed while li was replaced. It
+// never describes the same file as the one os.Stat returns, so the change is
+// noticed like any other.
+type staleFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f staleFile) Name() string       { return f.name }
+func (f staleFile) Size() int64        { return f.size }
+func (f staleFile) Mode() os.FileMode  { return 0 }
+func (f staleFile) ModTime() time.Time { return f.modTime }
+func (f staleFile) IsDir() bool        { return false }
+func (f staleFile) Sys() interface{}   { return nil }
+
+// ErrBusy is the cause of the errors from Reexec when li can't restart yet,
+// because a prompt is open or a job is running. It can be tried again later.
+var ErrBusy = errors.New("li is busy")
+
+// Reexec replaces the running li with the program at path, which is normally
+// a new build of li. The buffers, including unsaved changes and their undo
+// history, are handed over. The Quit hooks are run first as the new process
+// starts afresh, running the BufferOpen hooks for the open files.
+func (e *E) Reexec(path string) error {
+	if e.prompt != nil {
+		return errors.Wrap(ErrBusy, "can't restart li while a prompt is open")
+	}
+	for _, j := range e.jobs {
+		if j.Running() {
+			return errors.Wrapf(ErrBusy, "can't restart li while %s is running", j.Command)
+		}
+	}
+
+	// Exec can still fail, but most reasons are caught before anything is
+	// shut down
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "restarting li")
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return errors.Errorf("can't restart li: %s is not executable", path)
+	}
+
+	f, err := os.CreateTemp("", "li-handoff-")
+	if err != nil {
+		return errors.Wrap(err, "saving state")
+	}
+	defer os.Remove(f.Name())
+
+	err = gob.NewEncoder(f).Encode(e.handoff())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "saving state")
+	}
+
+	if err := e.runHooks(EventInfo{Event: Quit}); err != nil {
+		log.Println(err)
+	}
+	// The new process reads it back
+	e.saveSession()
+
+	env := append(os.Environ(), handoffEnv+"="+f.Name())
+	err = syscall.Exec(path, append([]string{path}, os.Args[1:]...), env)
+
+	// Exec only returns if it failed, li keeps running so what the Quit
+	// hooks shut down is started again
+	for _, b := range e.buffers {
+		if len(b.filename) != 0 {
+			e.inBuffer(b, func() {
+				e.hook(EventInfo{Event: BufferOpen, Filename: b.filename})
+			})
+		}
+	}
+	return errors.Wrapf(err, "running %s", path)
+}
+
+func (e *E) handoff() *handoff {
+	h := &handoff{
+		Current:   e.BufferIndex(),
+		Alternate: Find(e.buffers, func(b *Buffer) bool { return b == e.alternate }),
+		Mode:      e.mode,
+		StatusMsg: e.statusMsg,
+		Termios:   *e.termios,
+		Caps:      e.caps,
+	}
+
+	for _, b := range e.buffers {
+		// Undo groups that are still open are finished
+		b.undoDepth = 0
+		b.commitUndo()
+
+		s := bufferState{
+			Filename:   b.filename,
+			Scratch:    b.scratch,
+			Name:       b.name,
+			Rows:       make([][]rune, len(b.rows)),
+			Cx:         b.cx,
+			Cy:         b.cy,
+			Rx:         b.rx,
+			RowOffset:  b.rowOffset,
+			ColOffset:  b.colOffset,
+			Modified:   b.modified,
+			Undo:       saveUndo(b.undo),
+			Redo:       saveUndo(b.redo),
+			SwapPath:   b.swapPath,
+			Swapped:    b.swapVersion == b.version,
+			Marks:      b.marks,
+			Indent:     b.indent,
+			Tabstop:    b.tabstop,
+			FileFormat: b.fileFormat,
+		}
+		for i, row := range b.rows {
+			s.Rows[i] = row.chars
+		}
+		if b.diskInfo != nil {
+			s.Disk = &fileState{Size: b.diskInfo.Size(), ModTime: b.diskInfo.ModTime()}
+		}
+
+		h.Buffers = append(h.Buffers, s)
+	}
+
+	return h
+}
+
+func saveUndo(units []undoUnit) []undoState {
+	res := make([]undoState, len(units))
+	for i, u := range units {
+		res[i] = undoState{Changes: u.changes, Cx: u.cx, Cy: u.cy}
+	}
+	return res
+}
+
+func loadUndo(states []undoState) []undoUnit {
+	res := make([]undoUnit, len(states))
+	for i, s := range states {
+		res[i] = undoUnit{changes: s.Changes, cx: s.Cx, cy: s.Cy}
+	}
+	return res
+}
+
+// readHandoff reads the state handed over by Reexec, it returns nil if li
+// wasn't started by Reexec
+func readHandoff() (*handoff, error) {
+	path := os.Getenv(handoffEnv)
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	// Programs started by li shouldn't see it
+	os.Unsetenv(handoffEnv)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading state from previous li")
+	}
+	defer f.Close()
+	defer os.Remove(path)
+
+	var h handoff
+	if err := gob.NewDecoder(f).Decode(&h); err != nil {
+		return nil, errors.Wrap(err, "reading state from previous li")
+	}
+	return &h, nil
+}
+
+// restore recreates the buffers that were handed over
+func (e *E) restore(h *handoff) {
+	e.buffers = nil
+
+	for _, s := range h.Buffers {
+		b := &Buffer{
+			filename:   s.Filename,
+			scratch:    s.Scratch,
+			name:       s.Name,
+			rows:       make([]*Row, len(s.Rows)),
+			cx:         s.Cx,
+			cy:         s.Cy,
+			rx:         s.Rx,
+			rowOffset:  s.RowOffset,
+			colOffset:  s.ColOffset,
+			modified:   s.Modified,
+			undo:       loadUndo(s.Undo),
+			redo:       loadUndo(s.Redo),
+			swapPath:   s.SwapPath,
+			marks:      s.Marks,
+			indent:     s.Indent,
+			tabstop:    s.Tabstop,
+			fileFormat: s.FileFormat,
+		}
+		for i, chars := range s.Rows {
+			b.rows[i] = &Row{chars: chars}
+		}
+		if len(b.rows) == 0 {
+			b.rows = []*Row{{}}
+		}
+		if !s.Swapped {
+			b.version = 1
+		}
+
+		if s.Disk != nil {
+			info, err := os.Stat(b.filename)
+			if err == nil && info.Size() == s.Disk.Size && info.ModTime().Equal(s.Disk.ModTime) {
+				b.diskInfo = info
+			} else {
+				b.diskInfo = staleFile{name: filepath.Base(b.filename), size: s.Disk.Size, modTime: s.Disk.ModTime}
+			}
+			b.seenInfo = b.diskInfo
+		}
+
+		e.buffers = append(e.buffers, b)
+	}
+
+	e.mode = h.Mode
+	e.statusMsg = h.StatusMsg
+
+	for _, b := range e.buffers {
+		e.Buffer = b
+
+		e.detectSyntax()
+		for y := range e.rows {
+			e.updateRow(y)
+		}
+
+		if len(b.filename) != 0 {
+			e.hook(EventInfo{Event: BufferOpen, Filename: b.filename})
+		}
+	}
+
+	e.Buffer = e.buffers[h.Current]
+	if h.Alternate != -1 {
+		e.alternate = e.buffers[h.Alternate]
+	}
+}
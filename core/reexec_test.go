@@ -0,0 +1,89 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func TestHandoff(t *testing.T) {
+	e := newTestEditor(nil, "one", "two")
+	e.termios = &unix.Termios{}
+	e.mode = "insert"
+	e.InsertRows(2, []rune("three"))
+	e.commitUndo()
+	e.SetY(1)
+	e.SetX(2)
+	e.SetMark("a", Position{Y: 2, X: 1})
+
+	scratch := &Buffer{scratch: true, name: "output", rows: []*Row{{chars: []rune("out")}}}
+	e.buffers = append(e.buffers, scratch)
+	e.alternate = scratch
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e.handoff()); err != nil {
+		t.Fatal(err)
+	}
+	var h handoff
+	if err := gob.NewDecoder(&buf).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestEditor(nil)
+	r.restore(&h)
+
+	if len(r.buffers) != 2 || r.BufferIndex() != 0 || r.alternate != r.buffers[1] {
+		t.Fatalf("%d buffers with %d current, expected 2 with 0", len(r.buffers), r.BufferIndex())
+	}
+	if got, want := r.text(), []string{"one", "two", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handed over %q, expected %q", got, want)
+	}
+	if r.cy != 1 || r.cx != 2 || !r.modified || r.mode != "insert" {
+		t.Errorf("cursor at %d,%d modified %v in %q mode, expected 1,2 modified in insert mode", r.cy, r.cx, r.modified, r.mode)
+	}
+	if pos, ok := r.Mark("a"); !ok || pos != (Position{Y: 2, X: 1}) {
+		t.Errorf("mark a at %v, expected {2 1}", pos)
+	}
+
+	// The undo history is handed over too
+	if !r.Undo() {
+		t.Fatal("nothing to undo")
+	}
+	if got, want := r.text(), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("undo gives %q, expected %q", got, want)
+	}
+
+	s := r.buffers[1]
+	if !s.scratch || s.name != "output" || len(s.rows) != 1 || string(s.rows[0].chars) != "out" {
+		t.Errorf("scratch buffer not handed over")
+	}
+}
+
+// Nothing is shut down if li can't be replaced
+func TestReexecNotExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "li")
+	if err := os.WriteFile(path, []byte("not a program"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newTestEditor(nil, "")
+	e.termios = &unix.Termios{}
+	quit := false
+	e.AddHook(Quit, func(e *E, info EventInfo) error {
+		quit = true
+		return nil
+	})
+
+	if err := e.Reexec(path); err == nil || errors.Is(err, ErrBusy) {
+		t.Errorf("restarting with a file that isn't executable gives %v", err)
+	}
+	if quit {
+		t.Errorf("Quit hooks were run")
+	}
+}
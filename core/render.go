@@ -4,21 +4,64 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/mattn/go-runewidth"
 )
 
+// Overlay is a list of lines drawn over the bottom of the editor window, for
+// showing things such as search results
+type Overlay struct {
+	Lines []string
+	// Index of the line to highlight, or -1 for none
+	Selected int
+}
+
+// SetOverlay shows the overlay above the status bar. Give nil to remove it.
+func (e *E) SetOverlay(o *Overlay) {
+	e.overlay = o
+}
+
 func (e *E) drawRows(w io.Writer) {
+	overlayStart := e.screenRows
+	if e.overlay != nil {
+		overlayStart -= len(e.overlay.Lines)
+	}
+
 	for y := 0; y < e.screenRows; y++ {
-		e.drawRow(w, y)
+		if y >= overlayStart {
+			e.drawOverlayLine(w, y-overlayStart)
+		} else {
+			e.drawRow(w, y)
+		}
 
 		w.Write([]byte(ClearLineCode))
 		w.Write([]byte("\r\n"))
 	}
 }
 
+func (e *E) drawOverlayLine(w io.Writer, i int) {
+	line := e.overlay.Lines[i]
+	if runewidth.StringWidth(line) > e.screenCols {
+		line = runewidth.Truncate(line, e.screenCols, "...")
+	}
+
+	if i == e.overlay.Selected {
+		w.Write(e.color(InvertedColor))
+		w.Write([]byte(line))
+		// Highlight the whole width of the screen
+		for n := runewidth.StringWidth(line); n < e.screenCols; n++ {
+			w.Write([]byte{' '})
+		}
+		w.Write(ClearFormatting)
+		return
+	}
+
+	w.Write([]byte(line))
+}
+
 func (e *E) drawRow(w io.Writer, y int) {
 	filerow := y + e.rowOffset
 	if filerow >= len(e.rows) {
@@ -31,6 +74,10 @@ func (e *E) drawRow(w io.Writer, y int) {
 		hl   []SyntaxHL
 	)
 
+	if e.gutterWidth() > 0 {
+		e.drawSign(w, filerow)
+	}
+
 	// Use the offset to remove the first part of the render string
 	row := e.rows[filerow]
 	if runewidth.StringWidth(row.render) > e.colOffset {
@@ -39,14 +86,34 @@ func (e *E) drawRow(w io.Writer, y int) {
 	}
 
 	// Use the number of columns to truncate the end
-	if runewidth.StringWidth(line) > e.screenCols {
-		line = runewidth.Truncate(line, e.screenCols, "")
+	if runewidth.StringWidth(line) > e.textCols() {
+		line = runewidth.Truncate(line, e.textCols(), "")
 		hl = hl[:utf8.RuneCountInString(line)]
 	}
 
+	selStart, selEnd := e.selectedRange(filerow, e.Tabstop())
+	selected := false
+
+	// The bracket under the cursor and its match are highlighted
+	var matched []int
+	for _, p := range e.cursorMatch() {
+		if p.Y == filerow {
+			matched = append(matched, renderIndex(row.chars, e.Tabstop(), p.X))
+		}
+	}
+
 	currentColor := -1
 	i := 0
 	for _, r := range line {
+		if s := i+e.colOffset >= selStart && i+e.colOffset < selEnd; s != selected {
+			selected = s
+			if selected {
+				w.Write(e.color(InvertedColor))
+			} else {
+				w.Write(e.color(NotInvertedColor))
+			}
+		}
+
 		if unicode.IsControl(r) {
 			// deal with non-printable characters (e.g. Ctrl-A)
 			sym := '?'
@@ -54,18 +121,28 @@ func (e *E) drawRow(w io.Writer, y int) {
 				sym = '@' + r
 			}
 
-			w.Write(getColor(InvertedColor))
+			w.Write(e.color(InvertedColor))
 			w.Write([]byte(string(sym)))
 			w.Write(ClearFormatting)
 
 			// restore the current color
 			if currentColor != -1 {
-				w.Write(getColor(currentColor))
+				w.Write(e.color(currentColor))
+			}
+			if selected {
+				w.Write(e.color(InvertedColor))
 			}
 		} else {
-			if color := e.syntaxToColor(hl[i]); color != currentColor {
+			h := hl[i]
+			for _, m := range matched {
+				if m == i+e.colOffset {
+					h = HLMatch
+				}
+			}
+
+			if color := e.syntaxToColor(h); color != currentColor {
 				currentColor = color
-				w.Write(getColor(color))
+				w.Write(e.color(color))
 			}
 
 			w.Write([]byte(string(r)))
@@ -73,7 +150,31 @@ func (e *E) drawRow(w io.Writer, y int) {
 		i++
 	}
 
-	w.Write(getColor(ClearColor))
+	if selected {
+		w.Write(e.color(NotInvertedColor))
+	}
+	w.Write(e.color(ClearColor))
+}
+
+// drawSign draws the sign column for the row
+func (e *E) drawSign(w io.Writer, filerow int) {
+	sign, ok := e.signs[filerow]
+	if !ok {
+		w.Write([]byte(strings.Repeat(" ", signColumnWidth)))
+		return
+	}
+
+	text := runewidth.Truncate(sign.Text, signColumnWidth, "")
+	text = runewidth.FillRight(text, signColumnWidth)
+
+	w.Write(e.color(sign.Color))
+	w.Write([]byte(text))
+	w.Write(e.color(ClearColor))
+}
+
+// textCols is the number of columns available for the text of the rows
+func (e *E) textCols() int {
+	return e.screenCols - e.gutterWidth()
 }
 
 func (e *E) syntaxToColor(hl SyntaxHL) int {
@@ -103,37 +204,43 @@ func (e *E) Render(line int) {
 
 func (e *E) positionCursor(x, y int) {
 	d := x
-	if d > e.rows[y].visibleLength(e.cfg.Tabstop) {
-		d = e.rows[y].visibleLength(e.cfg.Tabstop)
+	if d > e.rows[y].visibleLength(e.Tabstop()) {
+		d = e.rows[y].visibleLength(e.Tabstop())
 	}
 
 	// Ensure the rx is not inside a tabstop
-	d = e.rows[y].roundToNearestRealChar(d, e.cfg.Tabstop)
+	d = e.rows[y].roundToNearestRealChar(d, e.Tabstop())
 
 	// position the cursor
-	os.Stdout.WriteString(fmt.Sprintf("\x1b[%d;%dH", (y-e.rowOffset)+1, (d-e.colOffset)+1))
+	os.Stdout.WriteString(fmt.Sprintf("\x1b[%d;%dH", (y-e.rowOffset)+1, (d-e.colOffset)+e.gutterWidth()+1))
 }
 
 func (e *E) FullRender() {
 	e.scroll()
 
+	if e.caps.SyncOutput {
+		os.Stdout.WriteString(BeginSyncCode)
+		defer os.Stdout.WriteString(EndSyncCode)
+	}
+
 	os.Stdout.Write(HideCursor)
 	os.Stdout.Write(CursorToTopLeft)
 
 	e.drawRows(os.Stdout)
 	e.drawStatusBar(os.Stdout)
 	e.drawMessageBar(os.Stdout)
+	e.drawPopup(os.Stdout)
 
 	d := e.rx
-	if d > e.rows[e.cy].visibleLength(e.cfg.Tabstop) {
-		d = e.rows[e.cy].visibleLength(e.cfg.Tabstop)
+	if d > e.rows[e.cy].visibleLength(e.Tabstop()) {
+		d = e.rows[e.cy].visibleLength(e.Tabstop())
 	}
 
 	// Ensure the rx is not inside a tabstop
-	d = e.rows[e.cy].roundToNearestRealChar(d, e.cfg.Tabstop)
+	d = e.rows[e.cy].roundToNearestRealChar(d, e.Tabstop())
 
 	// position the cursor
-	os.Stdout.WriteString(fmt.Sprintf("\x1b[%d;%dH", (e.cy-e.rowOffset)+1, (d-e.colOffset)+1))
+	os.Stdout.WriteString(fmt.Sprintf("\x1b[%d;%dH", (e.cy-e.rowOffset)+1, (d-e.colOffset)+e.gutterWidth()+1))
 
 	// show the cursor
 	os.Stdout.Write(ShowCursor)
@@ -148,6 +255,9 @@ var ClearFromCusorToEndOfLine = []byte("\x1b[K")
 
 func (e *E) drawMessageBar(w io.Writer) {
 	msg := e.statusMsg
+	if len(msg) == 0 {
+		msg = e.signs[e.cy].Message
+	}
 	if runewidth.StringWidth(msg) > e.screenCols {
 		msg = runewidth.Truncate(msg, e.screenCols, "...")
 	}
@@ -220,8 +330,8 @@ func (e *E) scroll() {
 		e.colOffset = d
 	}
 	// scroll right if the cursor is right of the visible window.
-	if d >= e.colOffset+e.screenCols {
-		e.colOffset = d - e.screenCols + 1
+	if d >= e.colOffset+e.textCols() {
+		e.colOffset = d - e.textCols() + 1
 	}
 }
 
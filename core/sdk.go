@@ -2,27 +2,96 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 )
 
-func (e *E) Row(y int) []rune {
-	return e.rows[y].chars
+func (b *Buffer) Row(y int) []rune {
+	return b.rows[y].chars
 }
 
 func (e *E) SetRow(y int, r []rune) {
-	e.rows[y].chars = r
-	e.updateRow(y)
-	e.Render(y)
+	e.replaceRows(y, 1, [][]rune{r})
 }
 
 func (e *E) AppendChar(y int, c rune) {
-	e.rows[y].chars = append(e.rows[y].chars, c)
-	e.updateRow(y)
-	e.Render(y)
+	e.InsertChars(y, len(e.rows[y].chars), c)
 }
 
-func (e *E) NumRows() int {
-	return len(e.rows)
+// InsertChars inserts the characters into row y before the character at x
+func (e *E) InsertChars(y, x int, chars ...rune) {
+	row := e.rows[y].chars
+
+	r := make([]rune, 0, len(row)+len(chars))
+	r = append(r, row[:x]...)
+	r = append(r, chars...)
+	r = append(r, row[x:]...)
+
+	e.SetRow(y, r)
+}
+
+// DeleteChars deletes the characters in row y from x1 up to but not including
+// x2
+func (e *E) DeleteChars(y, x1, x2 int) {
+	row := e.rows[y].chars
+
+	r := make([]rune, 0, len(row)-(x2-x1))
+	r = append(r, row[:x1]...)
+	r = append(r, row[x2:]...)
+
+	e.SetRow(y, r)
+}
+
+// ReplaceText replaces the text from x1 in row y1 up to but not including x2 in
+// row y2. The text may contain newlines to insert several rows.
+func (e *E) ReplaceText(y1, x1, y2, x2 int, text string) {
+	lines := strings.Split(text, "\n")
+
+	rows := make([][]rune, len(lines))
+	for i, l := range lines {
+		rows[i] = []rune(l)
+	}
+
+	last := len(rows) - 1
+	rows[0] = append(append([]rune(nil), e.rows[y1].chars[:x1]...), rows[0]...)
+	rows[last] = append(rows[last], e.rows[y2].chars[x2:]...)
+
+	e.replaceRows(y1, y2-y1+1, rows)
+}
+
+// InsertRows inserts the rows before row y
+func (e *E) InsertRows(y int, rows ...[]rune) {
+	e.replaceRows(y, 0, rows)
+}
+
+// DeleteRows deletes the rows from and to inclusive. The buffer always has at
+// least one row, so deleting all of them leaves a single empty row.
+func (e *E) DeleteRows(from, to int) {
+	e.ReplaceRows(from, to)
+}
+
+// ReplaceRows replaces the rows from and to inclusive with rows. Like
+// DeleteRows, replacing all the rows with none leaves a single empty row.
+func (e *E) ReplaceRows(from, to int, rows ...[]rune) {
+	if len(rows) == 0 && from == 0 && to == len(e.rows)-1 {
+		rows = [][]rune{{}}
+	}
+
+	e.replaceRows(from, to-from+1, rows)
+}
+
+func (b *Buffer) NumRows() int {
+	return len(b.rows)
+}
+
+// Tabstop returns the width of a tab in the current buffer, which can be set
+// for the file by its .editorconfig
+func (e *E) Tabstop() int {
+	if e.tabstop != 0 {
+		return e.tabstop
+	}
+	return e.cfg.Tabstop
 }
 
 func (e *E) ScreenBottom() int {
@@ -33,32 +102,70 @@ func (e *E) ScreenTop() int {
 	return e.rowOffset + 1
 }
 
-func (e *E) Filename() string {
-	return e.filename
+func (e *E) Save() error {
+	if len(e.filename) == 0 {
+		return errors.New("file has no name")
+	}
+	if e.changedOnDisk() {
+		return ErrFileChanged
+	}
+	return e.save()
 }
 
-func (e *E) Save() error {
+// ForceSave saves the file even if it was changed by another program since we
+// read it
+func (e *E) ForceSave() error {
 	if len(e.filename) == 0 {
 		return errors.New("file has no name")
 	}
-	return e.SaveTo(e.filename)
+	return e.save()
+}
+
+// save writes the buffer to its file, running the hooks and formatter around it
+func (e *E) save() error {
+	if err := e.runHooks(EventInfo{Event: BeforeSave, Filename: e.filename}); err != nil {
+		return fmt.Errorf("not saved, %s", err)
+	}
+	if e.fileFormat.TrimTrailingWhitespace {
+		e.trimTrailingWhitespace()
+	}
+	if err := e.format(); err != nil {
+		return err
+	}
+	if err := e.SaveTo(e.filename); err != nil {
+		return err
+	}
+
+	return e.runHooks(EventInfo{Event: AfterSave, Filename: e.filename})
 }
 
 func (e *E) SaveTo(filename string) error {
-	f, err := os.OpenFile(e.filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	// Encode the file first so that it isn't truncated if it can't be
+	data, err := e.encodeRows()
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", filename, err)
+	}
+
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	for _, row := range e.rows {
-		if _, err := f.Write([]byte(string(append(row.chars,rune('\n'))))); err != nil {
-			return err
-		}
-		if _, err := f.Write([]byte{'\n'}); err != nil {
-			return err
-		}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	if filename != e.filename {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
 	}
+	e.diskInfo = info
+	e.seenInfo = info
 
 	e.modified = false
 	return nil
@@ -74,7 +181,7 @@ func (e *E) SetY(y int) {
 		e.cy = y
 	}
 
-	e.cx = RxToCx(e.rows[e.cy].chars, e.cfg.Tabstop, e.rx)
+	e.cx = RxToCx(e.rows[e.cy].chars, e.Tabstop(), e.rx)
 }
 
 func (e *E) SetX(x int) {
@@ -87,7 +194,7 @@ func (e *E) SetX(x int) {
 		e.cx = x
 	}
 
-	e.rx = CxToRx(e.rows[e.cy].chars, e.cfg.Tabstop, x)
+	e.rx = CxToRx(e.rows[e.cy].chars, e.Tabstop(), x)
 }
 
 func (e *E) SetRowOffset(y int) {
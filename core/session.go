@@ -0,0 +1,308 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The session store remembers things between runs of li, such as where the
+// cursor was in each file and the prompt histories. It is a JSON file that is
+// shared by all li processes, each merges its changes into it when it exits.
+const (
+	// number of files remembered, the least recently used are forgotten
+	// first
+	maxSessionFiles = 1000
+	// number of entries kept in each history
+	maxHistory = 100
+)
+
+// DefaultSessionFile is where the session store is kept, in $XDG_STATE_HOME/li
+func DefaultSessionFile() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if len(dir) == 0 {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "li", "session.json")
+}
+
+// fileSession is what is remembered about a file
+type fileSession struct {
+	X         int                 `json:"x"`
+	Y         int                 `json:"y"`
+	RowOffset int                 `json:"rowOffset"`
+	Marks     map[string]Position `json:"marks,omitempty"`
+	Used      time.Time           `json:"used"`
+}
+
+type sessionData struct {
+	// by absolute path
+	Files     map[string]*fileSession `json:"files,omitempty"`
+	History   map[string][]string     `json:"history,omitempty"`
+	Registers map[string]string       `json:"registers,omitempty"`
+}
+
+type session struct {
+	// empty when the store is disabled
+	path string
+	data sessionData
+
+	// what has changed since the store was last read, other li processes
+	// may have changed the rest
+	files     map[string]bool
+	added     map[string][]string
+	registers map[string]bool
+}
+
+func newSessionData() sessionData {
+	return sessionData{
+		Files:     map[string]*fileSession{},
+		History:   map[string][]string{},
+		Registers: map[string]string{},
+	}
+}
+
+// readSession reads the store at path, a missing store is empty
+func readSession(path string) (sessionData, error) {
+	data := newSessionData()
+	if len(path) == 0 {
+		return data, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return data, errors.Wrap(err, "reading session")
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		return newSessionData(), errors.Wrapf(err, "reading session %s", path)
+	}
+
+	// Maps that were empty are left out of the file
+	if data.Files == nil {
+		data.Files = map[string]*fileSession{}
+	}
+	if data.History == nil {
+		data.History = map[string][]string{}
+	}
+	if data.Registers == nil {
+		data.Registers = map[string]string{}
+	}
+	return data, nil
+}
+
+func loadSession(path string) *session {
+	data, err := readSession(path)
+	if err != nil {
+		// Starting with an empty session is better than not starting
+		log.Println(err)
+	}
+
+	s := &session{path: path, data: data}
+	s.reset()
+	return s
+}
+
+func (s *session) reset() {
+	s.files = map[string]bool{}
+	s.added = map[string][]string{}
+	s.registers = map[string]bool{}
+}
+
+// save merges the changes into the store on disk
+func (s *session) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	data, err := readSession(s.path)
+	if err != nil {
+		// Don't replace what we can't read
+		return err
+	}
+
+	for path := range s.files {
+		data.Files[path] = s.data.Files[path]
+	}
+	for name, entries := range s.added {
+		data.History[name] = addHistory(data.History[name], entries...)
+	}
+	for name := range s.registers {
+		data.Registers[name] = s.data.Registers[name]
+	}
+
+	pruneFiles(data.Files)
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "writing session")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return errors.Wrap(err, "writing session")
+	}
+
+	// Write to a temporary file first so that the store is never left half
+	// written, even when several li processes exit at once
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".session-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "writing session")
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "writing session")
+	}
+
+	s.data = data
+	s.reset()
+	return nil
+}
+
+// pruneFiles forgets the files that no longer exist and the least recently used
+// files when there are too many
+func pruneFiles(files map[string]*fileSession) {
+	for path := range files {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(files, path)
+		}
+	}
+
+	if len(files) <= maxSessionFiles {
+		return
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return files[paths[i]].Used.After(files[paths[j]].Used)
+	})
+
+	for _, path := range paths[maxSessionFiles:] {
+		delete(files, path)
+	}
+}
+
+// addHistory adds the entries to the end of the history, removing any earlier
+// copies of them
+func addHistory(history []string, entries ...string) []string {
+	for _, entry := range entries {
+		res := make([]string, 0, len(history)+1)
+		for _, h := range history {
+			if h != entry {
+				res = append(res, h)
+			}
+		}
+		history = append(res, entry)
+	}
+
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return history
+}
+
+// recordFile remembers where the cursor is in the buffer's file
+func (s *session) recordFile(b *Buffer) {
+	if len(b.filename) == 0 || b.scratch {
+		return
+	}
+
+	abs, err := filepath.Abs(b.filename)
+	if err != nil {
+		return
+	}
+
+	f := &fileSession{X: b.cx, Y: b.cy, RowOffset: b.rowOffset, Used: time.Now()}
+	if len(b.marks) != 0 {
+		f.Marks = make(map[string]Position, len(b.marks))
+		for name, pos := range b.marks {
+			f.Marks[name] = pos
+		}
+	}
+
+	s.data.Files[abs] = f
+	s.files[abs] = true
+}
+
+// restorePosition moves the cursor to where it was when the file was last
+// edited and restores its marks
+func (e *E) restorePosition() {
+	abs, err := filepath.Abs(e.filename)
+	if err != nil {
+		return
+	}
+
+	f, ok := e.session.data.Files[abs]
+	if !ok {
+		return
+	}
+
+	e.SetY(f.Y)
+	e.SetX(f.X)
+	e.SetRowOffset(f.RowOffset)
+
+	// The file may have been changed by another program since
+	for name, pos := range f.Marks {
+		if pos.Y < len(e.rows) {
+			e.SetMark(name, pos)
+		}
+	}
+}
+
+// saveSession records the open files and writes the session store
+func (e *E) saveSession() {
+	for _, b := range e.buffers {
+		e.session.recordFile(b)
+	}
+
+	if err := e.session.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// History returns the entries of the named history, such as the history of a
+// prompt, oldest first
+func (e *E) History(name string) []string {
+	return e.session.data.History[name]
+}
+
+// AddHistory adds the entry to the end of the named history, removing any
+// earlier copy of it
+func (e *E) AddHistory(name, entry string) {
+	if len(entry) == 0 {
+		return
+	}
+
+	e.session.data.History[name] = addHistory(e.session.data.History[name], entry)
+	e.session.added[name] = append(e.session.added[name], entry)
+}
+
+// Register returns the contents of the named register
+func (e *E) Register(name string) string {
+	return e.session.data.Registers[name]
+}
+
+// SetRegister sets the contents of the named register, they are remembered
+// between runs of li
+func (e *E) SetRegister(name, contents string) {
+	e.session.data.Registers[name] = contents
+	e.session.registers[name] = true
+}
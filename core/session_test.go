@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddHistory(t *testing.T) {
+	h := addHistory(nil, "a", "b", "c")
+	// An entry added again moves to the end
+	h = addHistory(h, "a")
+	if expected := []string{"b", "c", "a"}; !reflect.DeepEqual(h, expected) {
+		t.Errorf("history is %q, expected %q", h, expected)
+	}
+
+	for i := 0; i < maxHistory+10; i++ {
+		h = addHistory(h, fmt.Sprint(i))
+	}
+	if len(h) != maxHistory || h[0] != "10" || h[len(h)-1] != fmt.Sprint(maxHistory+9) {
+		t.Errorf("history of %d from %q to %q, expected the last %d", len(h), h[0], h[len(h)-1], maxHistory)
+	}
+}
+
+func TestPruneFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	files := map[string]*fileSession{
+		filepath.Join(dir, "gone"): {Used: now},
+	}
+	for i := 0; i < maxSessionFiles+2; i++ {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files[path] = &fileSession{Used: now.Add(time.Duration(i) * time.Second)}
+	}
+
+	pruneFiles(files)
+
+	// Missing files and then the least recently used are forgotten
+	if len(files) != maxSessionFiles {
+		t.Errorf("%d files remembered, expected %d", len(files), maxSessionFiles)
+	}
+	for _, name := range []string{"gone", "0", "1"} {
+		if _, ok := files[filepath.Join(dir, name)]; ok {
+			t.Errorf("%s is still remembered", name)
+		}
+	}
+	if _, ok := files[filepath.Join(dir, "2")]; !ok {
+		t.Errorf("2 was forgotten")
+	}
+}
+
+// Two li processes that share the store each keep what they changed
+func TestSaveSessionMerge(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	editors := make([]*E, 2)
+	for i, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("one\ntwo\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		e := newTestEditor(nil, "one", "two")
+		e.filename = path
+		e.session = loadSession(DefaultSessionFile())
+		e.SetY(1)
+		e.AddHistory("search", name)
+		e.SetRegister(name, "text of "+name)
+		editors[i] = e
+	}
+	editors[0].AddHistory("search", "both")
+	editors[1].AddHistory("search", "both")
+
+	for _, e := range editors {
+		e.saveSession()
+	}
+
+	data, err := readSession(DefaultSessionFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if f, ok := data.Files[filepath.Join(dir, name)]; !ok || f.Y != 1 {
+			t.Errorf("position in %s not remembered", name)
+		}
+		if data.Registers[name] != "text of "+name {
+			t.Errorf("register %s is %q", name, data.Registers[name])
+		}
+	}
+	if expected := []string{"a.txt", "b.txt", "both"}; !reflect.DeepEqual(data.History["search"], expected) {
+		t.Errorf("history is %q, expected %q", data.History["search"], expected)
+	}
+}
+
+// The file may be shorter than when its position was remembered
+func TestRestorePosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+
+	e := newTestEditor(nil, "abc", "de", "f")
+	e.filename = path
+	e.session = loadSession("")
+	e.session.data.Files[path] = &fileSession{
+		X: 5, Y: 10, RowOffset: 8,
+		Marks: map[string]Position{"a": {Y: 8}, "b": {Y: 1, X: 2}},
+	}
+
+	e.restorePosition()
+
+	if e.cy != 2 || e.cx != 1 {
+		t.Errorf("cursor at %d,%d, expected 2,1", e.cy, e.cx)
+	}
+	if _, ok := e.Mark("a"); ok {
+		t.Errorf("mark a after the end of the file was restored")
+	}
+	if pos, ok := e.Mark("b"); !ok || pos != (Position{Y: 1, X: 2}) {
+		t.Errorf("mark b at %v, expected {1 2}", pos)
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+// Width of the sign column, which is only shown when the buffer has signs
+const signColumnWidth = 2
+
+// Sign marks a row in the sign column to the left of the text, e.g. to show
+// that the compiler reported an error for it
+type Sign struct {
+	// Shown in the sign column, at most two columns wide
+	Text string
+	// Terminal color of the text
+	Color int
+	// Shown in the message bar when the cursor is on the row and there is
+	// no other message
+	Message string
+}
+
+// SetSigns replaces the signs of the buffer, they are given by row
+func (b *Buffer) SetSigns(signs map[int]Sign) {
+	b.signs = signs
+}
+
+// shiftSigns moves the signs below the rows that replaceRows changed so that
+// they stay next to the same text. Signs of the replaced rows are kept unless
+// the rows were deleted.
+func (b *Buffer) shiftSigns(y, oldN, newN int) {
+	if len(b.signs) == 0 || oldN == newN {
+		return
+	}
+
+	signs := make(map[int]Sign, len(b.signs))
+	for row, s := range b.signs {
+		if row, ok := shiftRow(row, y, oldN, newN); ok {
+			signs[row] = s
+		}
+	}
+	b.signs = signs
+}
+
+// gutterWidth is the number of columns to the left of the text
+func (b *Buffer) gutterWidth() int {
+	if len(b.signs) == 0 {
+		return 0
+	}
+	return signColumnWidth
+}
@@ -0,0 +1,262 @@
+package core
+
+import "strings"
+
+// span is the text from Start up to but not including End
+type span struct {
+	Start, End Position
+}
+
+// The quotes that text objects and surround know. They are found on the row
+// of the position, as a string rarely goes over several.
+const quotes = "\"'`"
+
+// TextObject returns the text around p that a command acts on, from start up
+// to but not including end. The objects are:
+//
+//	w                    the word at p, around it includes the spaces after it
+//	( ) b [ ] { } B < >  the brackets around p, or those of EditorSyntax.MatchPairs
+//	" ' `                the quotes around p on its row
+//	t                    the HTML or XML tags around p
+//
+// The text inside the brackets, quotes or tags is inner, otherwise they are
+// included.
+func (e *E) TextObject(p Position, obj rune, inner bool) (start, end Position, ok bool) {
+	if obj == 'w' {
+		return e.wordObject(p, inner)
+	}
+
+	open, close, ok := e.delimiters(p, obj)
+	if !ok {
+		return Position{}, Position{}, false
+	}
+	if inner {
+		return open.End, close.Start, true
+	}
+	return open.Start, close.End, true
+}
+
+// Surround puts open before start and close before end, so around the text
+// from start up to but not including end
+func (e *E) Surround(start, end Position, open, close string) {
+	e.ReplaceText(end.Y, end.X, end.Y, end.X, close)
+	e.ReplaceText(start.Y, start.X, start.Y, start.X, open)
+	e.GoTo(start)
+}
+
+// ChangeSurround replaces the brackets, quotes or tags of the text object obj
+// around p, see TextObject, with open and close. It returns false if there is
+// no such object around p.
+func (e *E) ChangeSurround(p Position, obj rune, open, close string) bool {
+	o, c, ok := e.delimiters(p, obj)
+	if !ok {
+		return false
+	}
+
+	// The closing one first so that the opening one stays where it is
+	e.ReplaceText(c.Start.Y, c.Start.X, c.End.Y, c.End.X, close)
+	e.ReplaceText(o.Start.Y, o.Start.X, o.End.Y, o.End.X, open)
+	e.GoTo(o.Start)
+	return true
+}
+
+// DeleteSurround deletes the brackets, quotes or tags of the text object obj
+// around p, see TextObject. It returns false if there is no such object around
+// p.
+func (e *E) DeleteSurround(p Position, obj rune) bool {
+	return e.ChangeSurround(p, obj, "", "")
+}
+
+// SurroundPair returns the opening and closing text for surrounding with r,
+// which is either of a pair of brackets or a quote
+func (e *E) SurroundPair(r rune) (open, close string, ok bool) {
+	if strings.ContainsRune(quotes, r) {
+		return string(r), string(r), true
+	}
+
+	pairs := []rune(e.matchPairs() + "<>")
+	for i, p := range pairs {
+		if p == r {
+			return string(pairs[i&^1]), string(pairs[i|1]), true
+		}
+	}
+	return "", "", false
+}
+
+// delimiters returns the opening and closing brackets, quotes or tags of the
+// text object around p
+func (e *E) delimiters(p Position, obj rune) (open, close span, ok bool) {
+	if obj == 't' {
+		return e.tagDelimiters(p)
+	}
+	if strings.ContainsRune(quotes, obj) {
+		return e.quoteDelimiters(p, obj)
+	}
+	switch obj {
+	case 'b':
+		obj = '('
+	case 'B':
+		obj = '{'
+	}
+
+	pairs := []rune(e.matchPairs() + "<>")
+	i := -1
+	for j, r := range pairs {
+		if r == obj {
+			i = j &^ 1
+			break
+		}
+	}
+	if i == -1 {
+		return span{}, span{}, false
+	}
+	opening, closing := pairs[i], pairs[i+1]
+
+	start, ok := e.enclosing(p, opening, closing)
+	if !ok {
+		return span{}, span{}, false
+	}
+
+	end, ok := e.matchPair(start, opening, closing)
+	if !ok {
+		return span{}, span{}, false
+	}
+
+	return span{start, Position{Y: start.Y, X: start.X + 1}}, span{end, Position{Y: end.Y, X: end.X + 1}}, true
+}
+
+// enclosing returns the opening bracket of the pair that p is in, or on
+func (e *E) enclosing(p Position, opening, closing rune) (Position, bool) {
+	row := e.rows[p.Y].chars
+	if p.X < len(row) && row[p.X] == opening {
+		return p, true
+	}
+
+	// The closing bracket at p isn't counted as scan starts before it
+	code := p.X >= len(row) || isCode(e.charHL(p.Y)[p.X])
+	depth := 0
+
+	return e.scan(p, -1, 0, len(e.rows)-1, func(_ Position, r rune, hl SyntaxHL) bool {
+		if isCode(hl) != code {
+			return false
+		}
+
+		switch r {
+		case closing:
+			depth++
+		case opening:
+			if depth == 0 {
+				return true
+			}
+			depth--
+		}
+		return false
+	})
+}
+
+// matchPair returns the closing bracket that matches the opening one at p,
+// which needn't be one that MatchBracket knows
+func (e *E) matchPair(p Position, opening, closing rune) (Position, bool) {
+	code := isCode(e.charHL(p.Y)[p.X])
+	depth := 1
+
+	return e.scan(p, 1, 0, len(e.rows)-1, func(_ Position, r rune, hl SyntaxHL) bool {
+		if isCode(hl) != code {
+			return false
+		}
+
+		switch r {
+		case opening:
+			depth++
+		case closing:
+			depth--
+		}
+		return depth == 0
+	})
+}
+
+// quoteDelimiters returns the quotes around p on its row
+func (e *E) quoteDelimiters(p Position, quote rune) (open, close span, ok bool) {
+	row := e.rows[p.Y].chars
+
+	// The quotes pair up from the start of the row
+	var found []int
+	for x, r := range row {
+		if r == quote && (x == 0 || row[x-1] != '\\') {
+			found = append(found, x)
+		}
+	}
+
+	for i := 0; i+1 < len(found); i += 2 {
+		start, end := found[i], found[i+1]
+		if p.X >= start && p.X <= end {
+			return span{Position{Y: p.Y, X: start}, Position{Y: p.Y, X: start + 1}},
+				span{Position{Y: p.Y, X: end}, Position{Y: p.Y, X: end + 1}}, true
+		}
+	}
+	return span{}, span{}, false
+}
+
+// tagDelimiters returns the opening and closing tags around p
+func (e *E) tagDelimiters(p Position) (open, close span, ok bool) {
+	// Include p, which can be on the opening tag
+	from := Position{Y: p.Y, X: p.X + 1}
+
+	_, found := e.scan(from, -1, 0, len(e.rows)-1, func(q Position, r rune, hl SyntaxHL) bool {
+		if r != '<' || isComment(hl) {
+			return false
+		}
+
+		row := e.rows[q.Y].chars[q.X:]
+		if name, closing := tagName(row); len(name) == 0 || closing || selfClosing(row) {
+			return false
+		}
+
+		m, ok := e.matchTag(q, 0, len(e.rows)-1)
+		if !ok {
+			return false
+		}
+
+		// The closing tag must end after p
+		close, ok = e.tagSpan(m)
+		if !ok || !p.Before(close.End) {
+			return false
+		}
+		open, ok = e.tagSpan(q)
+		return ok
+	})
+	return open, close, found
+}
+
+// tagSpan returns the tag that starts at p, which ends on the same row
+func (e *E) tagSpan(p Position) (span, bool) {
+	row := e.rows[p.Y].chars
+	for x := p.X; x < len(row); x++ {
+		if row[x] == '>' {
+			return span{p, Position{Y: p.Y, X: x + 1}}, true
+		}
+	}
+	return span{}, false
+}
+
+// wordObject returns the word at p
+func (e *E) wordObject(p Position, inner bool) (start, end Position, ok bool) {
+	row := e.rows[p.Y].chars
+	if p.X >= len(row) || !isWordRune(row[p.X]) {
+		return Position{}, Position{}, false
+	}
+
+	s, t := p.X, p.X
+	for s > 0 && isWordRune(row[s-1]) {
+		s--
+	}
+	for t < len(row) && isWordRune(row[t]) {
+		t++
+	}
+	if !inner {
+		for t < len(row) && (row[t] == ' ' || row[t] == '\t') {
+			t++
+		}
+	}
+	return Position{Y: p.Y, X: s}, Position{Y: p.Y, X: t}, true
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testHTML = &EditorSyntax{
+	Filetype:         "html",
+	Mcs:              "<!--",
+	Mce:              "-->",
+	HighlightStrings: true,
+	MatchTags:        true,
+}
+
+func TestTextObject(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		syntax *EditorSyntax
+		rows   []string
+		p      Position
+		obj    rune
+		inner  bool
+
+		start, end Position
+		ok         bool
+	}{
+		{"word", nil, []string{"foo bar"}, Position{X: 1}, 'w', true, Position{X: 0}, Position{X: 3}, true},
+		{"word and spaces", nil, []string{"foo  bar"}, Position{X: 1}, 'w', false, Position{X: 0}, Position{X: 5}, true},
+		{"not a word", nil, []string{"a + b"}, Position{X: 2}, 'w', true, Position{}, Position{}, false},
+
+		{"inside brackets", nil, []string{"f(a, (b), c)"}, Position{X: 2}, '(', true, Position{X: 2}, Position{X: 11}, true},
+		{"around brackets", nil, []string{"f(a, (b), c)"}, Position{X: 2}, ')', false, Position{X: 1}, Position{X: 12}, true},
+		{"nested brackets", nil, []string{"f(a, (b), c)"}, Position{X: 6}, 'b', true, Position{X: 6}, Position{X: 7}, true},
+		{"on the opening bracket", nil, []string{"f(a, (b), c)"}, Position{X: 5}, '(', true, Position{X: 6}, Position{X: 7}, true},
+		{"on the closing bracket", nil, []string{"f(a, (b), c)"}, Position{X: 7}, '(', true, Position{X: 6}, Position{X: 7}, true},
+		{"after nested brackets", nil, []string{"f(a, (b), c)"}, Position{X: 10}, '(', true, Position{X: 2}, Position{X: 11}, true},
+		{"over rows", nil, []string{"f{", "\tx", "}"}, Position{Y: 1, X: 1}, 'B', true, Position{X: 2}, Position{Y: 2}, true},
+		{"brackets in strings", testSyntax, []string{`f(")", x)`}, Position{X: 7}, '(', true, Position{X: 2}, Position{X: 8}, true},
+		{"no brackets", nil, []string{"abc"}, Position{X: 1}, '(', true, Position{}, Position{}, false},
+		{"unknown object", nil, []string{"(a)"}, Position{X: 1}, 'z', true, Position{}, Position{}, false},
+
+		{"inside quotes", nil, []string{`a "b c" "d"`}, Position{X: 5}, '"', true, Position{X: 3}, Position{X: 6}, true},
+		{"around quotes", nil, []string{`a "b c" "d"`}, Position{X: 9}, '"', false, Position{X: 8}, Position{X: 11}, true},
+		{"on a quote", nil, []string{`a "b c" "d"`}, Position{X: 6}, '"', true, Position{X: 3}, Position{X: 6}, true},
+		{"between quotes", nil, []string{`a "b c" "d"`}, Position{X: 7}, '"', true, Position{}, Position{}, false},
+		{"escaped quote", nil, []string{`"a\"b"`}, Position{X: 2}, '"', true, Position{X: 1}, Position{X: 5}, true},
+
+		{"inside tags", testHTML, []string{"<div><p>hi</p></div>"}, Position{X: 8}, 't', true, Position{X: 8}, Position{X: 10}, true},
+		{"around tags", testHTML, []string{"<div><p>hi</p></div>"}, Position{X: 8}, 't', false, Position{X: 5}, Position{X: 14}, true},
+		{"outer tags", testHTML, []string{"<div><p>hi</p></div>"}, Position{X: 15}, 't', true, Position{X: 5}, Position{X: 14}, true},
+		{"self closing tag", testHTML, []string{"<p>a<br/>b</p>"}, Position{X: 9}, 't', true, Position{X: 3}, Position{X: 10}, true},
+		{"tags over rows", testHTML, []string{"<ul>", "  <li>a</li>", "</ul>"}, Position{Y: 1}, 't', true, Position{X: 4}, Position{Y: 2}, true},
+		{"no tags", testHTML, []string{"abc"}, Position{X: 1}, 't', true, Position{}, Position{}, false},
+	} {
+		e := newTestEditor(test.syntax, test.rows...)
+
+		start, end, ok := e.TextObject(test.p, test.obj, test.inner)
+		if ok != test.ok || ok && (start != test.start || end != test.end) {
+			t.Errorf("%s: TextObject(%v, %q, %v) = %v, %v, %v, expected %v, %v, %v", test.name,
+				test.p, test.obj, test.inner, start, end, ok, test.start, test.end, test.ok)
+		}
+	}
+}
+
+func TestSurround(t *testing.T) {
+	e := newTestEditor(nil, "f(a, [b])")
+
+	if !e.ChangeSurround(Position{X: 6}, '[', "{", "}") {
+		t.Fatal("ChangeSurround found no brackets")
+	}
+	if !e.DeleteSurround(Position{X: 2}, '(') {
+		t.Fatal("DeleteSurround found no brackets")
+	}
+	e.Surround(Position{X: 1}, Position{X: 2}, "<", ">")
+
+	if got, want := e.text(), []string{"f<a>, {b}"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("surrounding gives %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalInput reads the keys from the terminal. The terminal is set up so
+// that reads return after a tenth of a second without input, which lets it stop
+// reading while li is suspended or another program is using the terminal.
+type terminalInput struct {
+	fd int
+	// held while li doesn't have the terminal
+	mu sync.Mutex
+}
+
+func (t *terminalInput) Read(b []byte) (int, error) {
+	for {
+		t.mu.Lock()
+		n, err := syscall.Read(t.fd, b)
+		t.mu.Unlock()
+
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			// Reads also return nothing, straight away, once the
+			// terminal hangs up
+			if t.hungUp() {
+				return 0, io.EOF
+			}
+			continue
+		}
+		return n, nil
+	}
+}
+
+// hungUp reports whether the other end of the terminal was closed
+func (t *terminalInput) hungUp() bool {
+	fds := []unix.PollFd{{Fd: int32(t.fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, 0)
+	return err == nil && n == 1 && fds[0].Revents&(unix.POLLHUP|unix.POLLERR|unix.POLLNVAL) != 0
+}
+
+// takeTerminal sets up the terminal for li, see releaseTerminal
+func (e *E) takeTerminal() error {
+	var err error
+	e.termios, err = makeRaw(int(os.Stdin.Fd()), e.termios)
+	if err != nil {
+		return err
+	}
+
+	if e.caps.AltScreen {
+		SwitchToAlternateScreen(os.Stdout)
+	}
+	if e.caps.KeyboardProtocols {
+		EnableKeyboardProtocols(os.Stdout)
+	}
+	if e.caps.BracketedPaste {
+		EnableBracketedPaste(os.Stdout)
+	}
+	if e.caps.Mouse {
+		EnableMouse(os.Stdout)
+	}
+	return nil
+}
+
+// releaseTerminal puts the terminal back the way it was before li started
+func (e *E) releaseTerminal() {
+	if e.caps.Mouse {
+		DisableMouse(os.Stdout)
+	}
+	if e.caps.BracketedPaste {
+		DisableBracketedPaste(os.Stdout)
+	}
+	if e.caps.KeyboardProtocols {
+		DisableKeyboardProtocols(os.Stdout)
+	}
+	if e.caps.AltScreen {
+		SwitchBackFromAlternateScreen(os.Stdout)
+	} else {
+		// Don't leave li's screen behind
+		ClearScreen()
+		RepositionCursor()
+	}
+	restoreTerminal(int(os.Stdin.Fd()), e.termios)
+}
+
+// pauseTerminal gives the terminal to another program, until resumeTerminal
+// takes it back
+func (e *E) pauseTerminal() {
+	e.input.mu.Lock()
+	e.releaseTerminal()
+}
+
+func (e *E) resumeTerminal() error {
+	defer e.input.mu.Unlock()
+
+	if err := e.takeTerminal(); err != nil {
+		return err
+	}
+
+	// The terminal may have been resized in the meantime
+	if err := e.setWindowSize(); err != nil {
+		return err
+	}
+	e.FullRender()
+	return nil
+}
+
+// Suspend stops li so that the shell that started it can be used, like Ctrl-Z
+// does for other programs. It returns when li is resumed, with the terminal set
+// up again.
+func (e *E) Suspend() error {
+	cont := make(chan os.Signal, 1)
+	signal.Notify(cont, syscall.SIGCONT)
+	defer signal.Stop(cont)
+
+	e.pauseTerminal()
+
+	// Stop the whole process group, as the terminal would have
+	if err := syscall.Kill(0, syscall.SIGTSTP); err != nil {
+		e.resumeTerminal()
+		return err
+	}
+	<-cont
+
+	return e.resumeTerminal()
+}
+
+// RunInteractive runs the command with the terminal, for programs that interact
+// with the user such as a pager or an editor. The standard streams that aren't
+// set are the terminal's. It returns when the command exits, with the terminal
+// set up for li again.
+func (e *E) RunInteractive(cmd *exec.Cmd) error {
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	// Ctrl-C and Ctrl-\ are for the command, they are sent to li as well as
+	// it shares the terminal
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
+
+	e.pauseTerminal()
+	err := cmd.Run()
+	if resumeErr := e.resumeTerminal(); err == nil {
+		err = resumeErr
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestTerminalInputHangup(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	w.Write([]byte("a"))
+	w.Close()
+
+	in := &terminalInput{fd: int(r.Fd())}
+	b := make([]byte, 8)
+	if n, err := in.Read(b); n != 1 || err != nil || b[0] != 'a' {
+		t.Errorf("read %q, %v, expected \"a\"", b[:n], err)
+	}
+
+	// Without spinning on reads that return nothing
+	if n, err := in.Read(b); n != 0 || err != io.EOF {
+		t.Errorf("read %q, %v after hangup, expected EOF", b[:n], err)
+	}
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"codeberg.org/wlcsm/li/ansi"
+	"github.com/pkg/errors"
+)
+
+// Swap files contain a copy of the buffer so that unsaved work can be
+// recovered if li crashes or the terminal is lost. They are written next to
+// the file as ".<name>.li.swp" and have the following format:
+//
+//	li swap
+//	pid <pid of the owning li process>
+//	host <hostname of the owning li process>
+//	file <absolute path of the file>
+//	--
+//	<buffer contents>
+const (
+	swapMagic     = "li swap"
+	swapSeparator = "--"
+)
+
+type swapInfo struct {
+	pid  int
+	host string
+}
+
+// SwapPath returns the path of the swap file for the given file
+func SwapPath(filename string) string {
+	dir, base := filepath.Split(filename)
+	return filepath.Join(dir, "."+base+".li.swp")
+}
+
+// running reports whether the process that owns the swap file is still alive.
+// This can only be checked when it is on the same host as us.
+func (s swapInfo) running() bool {
+	if host, _ := os.Hostname(); host != s.host {
+		return false
+	}
+
+	err := syscall.Kill(s.pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func readSwap(path string) (swapInfo, [][]rune, error) {
+	var info swapInfo
+
+	f, err := os.Open(path)
+	if err != nil {
+		return info, nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	// Rows can be much longer than the default limit of a token
+	s.Buffer(nil, math.MaxInt)
+	if !s.Scan() || s.Text() != swapMagic {
+		return info, nil, fmt.Errorf("%s is not a swap file", path)
+	}
+
+	for s.Scan() && s.Text() != swapSeparator {
+		key, val, _ := strings.Cut(s.Text(), " ")
+		switch key {
+		case "pid":
+			info.pid, _ = strconv.Atoi(val)
+		case "host":
+			info.host = val
+		}
+	}
+
+	var rows [][]rune
+	for s.Scan() {
+		rows = append(rows, []rune(s.Text()))
+	}
+
+	if err := s.Err(); err != nil {
+		return info, nil, errors.Wrapf(err, "reading swap file %s", path)
+	}
+
+	return info, rows, nil
+}
+
+// writeSwap updates the swap file if the buffer changed since it was last
+// written.
+func (b *Buffer) writeSwap() error {
+	if len(b.swapPath) == 0 || b.swapVersion == b.version {
+		return nil
+	}
+
+	abs, err := filepath.Abs(b.filename)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+
+	// Write to a temporary file first so that a crash while writing can't
+	// leave us with a truncated swap file
+	tmp := b.swapPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "writing swap file")
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "%s\npid %d\nhost %s\nfile %s\n%s\n", swapMagic, os.Getpid(), host, abs, swapSeparator)
+	for _, row := range b.rows {
+		w.WriteString(string(row.chars))
+		w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing swap file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "writing swap file")
+	}
+	if err := os.Rename(tmp, b.swapPath); err != nil {
+		return errors.Wrap(err, "writing swap file")
+	}
+
+	b.swapVersion = b.version
+	return nil
+}
+
+// claimSwap makes us the owner of the swap file for the buffer's file
+func (b *Buffer) claimSwap(path string) error {
+	b.swapPath = path
+	// Force a write so that other instances know the file is being edited
+	b.swapVersion = -1
+	return b.writeSwap()
+}
+
+// removeSwap deletes the swap file we own, if any
+func (b *Buffer) removeSwap() {
+	if len(b.swapPath) == 0 {
+		return
+	}
+
+	if err := os.Remove(b.swapPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("removing swap file: %v", err)
+	}
+	b.swapPath = ""
+}
+
+// checkSwap is called when a file is opened. If a swap file already exists
+// the user is asked whether to recover it, otherwise we create our own.
+func (e *E) checkSwap() error {
+	if e.swapInterval <= 0 {
+		return nil
+	}
+
+	path := SwapPath(e.filename)
+
+	info, rows, err := readSwap(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return e.Buffer.claimSwap(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	b := e.Buffer
+
+	msg := fmt.Sprintf("found swap file %s", path)
+	if info.running() {
+		msg += fmt.Sprintf(" (in use by li, pid %d!)", info.pid)
+	}
+
+	e.Prompt(msg+": [r]ecover, [d]elete, [i]gnore ", func(k ansi.Key) (string, bool, error) {
+		switch k {
+		case ansi.Key('r'):
+			if len(rows) == 0 {
+				rows = [][]rune{{}}
+			}
+
+			// Several files may have been opened at once
+			e.SwitchBuffer(Find(e.buffers, func(o *Buffer) bool { return o == b }))
+			e.replaceRows(0, len(e.rows), rows)
+
+			if err := b.claimSwap(path); err != nil {
+				e.SetStatusLine("recovered %s, err: %s", e.filename, err)
+			} else {
+				e.SetStatusLine("recovered %s", e.filename)
+			}
+		case ansi.Key('d'):
+			if err := os.Remove(path); err != nil {
+				return "", true, err
+			}
+
+			if err := b.claimSwap(path); err != nil {
+				return "", true, err
+			}
+		case ansi.Key('i'), ansi.EscapeKey:
+			// Leave the swap file to its owner, this session won't have one
+			e.SetStatusLine("ignoring swap file, changes to %s are not being backed up", b.filename)
+		default:
+			return "", false, nil
+		}
+
+		return "", true, nil
+	})
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSwap(t *testing.T) {
+	// Longer than a bufio.Scanner token by default
+	long := strings.Repeat("x", 1<<20)
+
+	path := filepath.Join(t.TempDir(), ".a.txt.li.swp")
+	swap := fmt.Sprintf("%s\npid 42\nhost here\nfile /a.txt\n%s\none\n%s\n\nlast\n", swapMagic, swapSeparator, long)
+	if err := os.WriteFile(path, []byte(swap), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, rows, err := readSwap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.pid != 42 || info.host != "here" {
+		t.Errorf("swap file is from %d on %q, expected 42 on here", info.pid, info.host)
+	}
+
+	var text []string
+	for _, row := range rows {
+		text = append(text, string(row))
+	}
+	expected := []string{"one", long, "", "last"}
+	if !reflect.DeepEqual(text, expected) {
+		t.Errorf("swap file has %d rows, expected %d", len(text), len(expected))
+	}
+}
+
+func TestReadSwapNotSwap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := readSwap(path); err == nil {
+		t.Errorf("no error reading a file that isn't a swap file")
+	}
+}
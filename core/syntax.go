@@ -37,6 +37,35 @@ type EditorSyntax struct {
 
 	HighlightStrings bool
 	HighlightNumbers bool
+
+	// Formatter is a shell command that formats the file, reading it from
+	// stdin and writing the result to stdout. It is run on every save, in
+	// the file's directory with $LI_FILE set to its name.
+	Formatter string
+
+	// Indent is how files of the filetype are indented, unless a file is
+	// indented in another way. The default indentation is used when it is
+	// zero.
+	Indent Indent
+	// Rows that end with one of IndentAfter are followed by a row that is
+	// indented further. DedentOn are the closing brackets, that move back to
+	// the outer indentation.
+	IndentAfter string
+	DedentOn    string
+
+	// MatchPairs are pairs of brackets, an opening then a closing one, that
+	// are matched by JumpToMatch and highlighted under the cursor as well as
+	// ()[]{}. Pairs of the same rune, like quotes, are ignored as which one
+	// opens can't be told. MatchTags matches the opening and closing tags of
+	// HTML and XML.
+	MatchPairs string
+	MatchTags  bool
+
+	// AutoPairs are the pairs of brackets and quotes, an opening then a
+	// closing one, that are inserted together, see InsertPaired. They are
+	// ()[]{}"" and '' when it is empty. A last rune without a pair is
+	// ignored.
+	AutoPairs string
 }
 
 func (e *E) updateRow(y int) {
@@ -55,7 +84,7 @@ func (e *E) updateRow(y int) {
 		cols++
 
 		// append spaces until we get to a tab stop
-		for cols%e.cfg.Tabstop != 0 {
+		for cols%e.Tabstop() != 0 {
 			b.WriteRune(' ')
 			cols++
 		}
@@ -1,6 +1,11 @@
 package core
 
-import "io"
+import (
+	"io"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
 
 func SwitchToAlternateScreen(w io.Writer) {
 	w.Write([]byte("\033[?1049h"))
@@ -9,3 +14,61 @@ func SwitchToAlternateScreen(w io.Writer) {
 func SwitchBackFromAlternateScreen(w io.Writer) {
 	w.Write([]byte("\033[?1049l"))
 }
+
+// EnableKeyboardProtocols asks the terminal to send keys that it otherwise
+// sends the same way as others, such as Ctrl+Shift+a and Ctrl+a, as distinct
+// escape sequences. It enables the kitty keyboard protocol and xterm's
+// modifyOtherKeys, terminals ignore those they don't support.
+func EnableKeyboardProtocols(w io.Writer) {
+	w.Write([]byte("\033[>1u\033[>4;2m"))
+}
+
+func DisableKeyboardProtocols(w io.Writer) {
+	w.Write([]byte("\033[<u\033[>4m"))
+}
+
+// EnableBracketedPaste asks the terminal to mark the start and end of pasted
+// text, so that it isn't taken as typed keys
+func EnableBracketedPaste(w io.Writer) {
+	w.Write([]byte("\033[?2004h"))
+}
+
+func DisableBracketedPaste(w io.Writer) {
+	w.Write([]byte("\033[?2004l"))
+}
+
+// makeRaw puts the terminal in raw mode. It returns the state to restore when
+// li exits, which is orig when li was handed a terminal that is already in raw
+// mode.
+func makeRaw(fd int, orig *unix.Termios) (*unix.Termios, error) {
+	if orig == nil {
+		t, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+		if err != nil {
+			return nil, err
+		}
+		orig = t
+	}
+
+	if _, err := term.MakeRaw(fd); err != nil {
+		return nil, err
+	}
+
+	// Reads return after a tenth of a second without input, so that li can
+	// stop reading while another program uses the terminal, see
+	// terminalInput
+	t, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	t.Cc[unix.VMIN] = 0
+	t.Cc[unix.VTIME] = 1
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, t); err != nil {
+		return nil, err
+	}
+
+	return orig, nil
+}
+
+func restoreTerminal(fd int, t *unix.Termios) error {
+	return unix.IoctlSetTermios(fd, ioctlWriteTermios, t)
+}
@@ -0,0 +1,172 @@
+// Package diff finds the differences between two lists of lines, using Myers'
+// algorithm from "An O(ND) Difference Algorithm and Its Variations".
+package diff
+
+// Hunk replaces the lines a[OldStart:OldEnd] of the old text with the lines
+// b[NewStart:NewEnd] of the new text
+type Hunk struct {
+	OldStart, OldEnd int
+	NewStart, NewEnd int
+}
+
+// Lines returns the smallest set of hunks that turn a into b, in order
+func Lines(a, b []string) []Hunk {
+	// Lines in common at either end are common to most real edits and
+	// cheap to skip
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+
+	// Turn the lines that are the same into hunks for the lines between
+	// them. The end of both is the same so that a last hunk is added.
+	matches := append(match(a, b), [2]int{len(a), len(b)})
+
+	var hunks []Hunk
+	x, y := 0, 0
+	for _, m := range matches {
+		if m[0] > x || m[1] > y {
+			hunks = append(hunks, Hunk{
+				OldStart: prefix + x,
+				OldEnd:   prefix + m[0],
+				NewStart: prefix + y,
+				NewEnd:   prefix + m[1],
+			})
+		}
+		x, y = m[0]+1, m[1]+1
+	}
+
+	return hunks
+}
+
+// match returns the pairs of indexes of lines in a and b that are kept by a
+// shortest edit script, in order. It splits the edit script at its middle
+// snake, as in section 4b of the paper, so that it needs space linear in the
+// number of lines rather than in the square of the number of edits.
+func match(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil
+	}
+
+	off := (n+m+1)/2 + 1
+	d := &differ{
+		a:  a,
+		b:  b,
+		vf: make([]int, 2*off+1),
+		vb: make([]int, 2*off+1),
+	}
+	d.compare(0, n, 0, m)
+	return d.matches
+}
+
+// differ holds the lines being compared and the furthest reaching paths of
+// middleSnake, which are reused by every call
+type differ struct {
+	a, b    []string
+	vf, vb  []int
+	matches [][2]int
+}
+
+// compare adds the matches between a[a0:a1] and b[b0:b1]
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.matches = append(d.matches, [2]int{a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-1-suffix] == d.b[b1-1-suffix] {
+		suffix++
+	}
+	a1 -= suffix
+	b1 -= suffix
+
+	// Both differ at either end, so the edit script has at least two edits
+	// and both halves of it have fewer
+	if a0 < a1 && b0 < b1 {
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, a0+x, b0, b0+y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.matches = append(d.matches, [2]int{a0 + x, b0 + y})
+		}
+		d.compare(a0+u, a1, b0+v, b1)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.matches = append(d.matches, [2]int{a1 + i, b1 + i})
+	}
+}
+
+// middleSnake returns the snake from (x, y) to (u, v) in the middle of a
+// shortest edit script of a[a0:a1] and b[b0:b1], relative to a0 and b0. It
+// follows the furthest reaching paths from both the start and the end until
+// they overlap.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+
+	// vf[off+k] is the furthest x reached from the start on diagonal k,
+	// where y = x - k. vb[off+k] is the same from the end, counting x and y
+	// back from n and m.
+	off := (n+m+1)/2 + 1
+	vf, vb := d.vf, d.vb
+	vf[off+1], vb[off+1] = 0, 0
+
+	for e := 0; e <= (n+m+1)/2; e++ {
+		for k := -e; k <= e; k += 2 {
+			var x int
+			if k == -e || (k != e && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+
+			sx, sy := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+
+			// The path from the end on the same diagonal is on
+			// diagonal delta - k counting back
+			if c := delta - k; odd && c >= -(e-1) && c <= e-1 && x+vb[off+c] >= n {
+				return sx, sy, x, y
+			}
+		}
+
+		for k := -e; k <= e; k += 2 {
+			var x int
+			if k == -e || (k != e && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+
+			sx, sy := x, y
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+
+			if c := delta - k; !odd && c >= -e && c <= e && x+vf[off+c] >= n {
+				return n - x, m - y, n - sx, m - sy
+			}
+		}
+	}
+
+	// The paths always overlap by the time they have half the edits each
+	panic("diff: no middle snake")
+}
@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// apply applies the hunks to a, taking the new lines from b
+func apply(a, b []string, hunks []Hunk) []string {
+	res := append([]string(nil), a...)
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		tail := append([]string(nil), res[h.OldEnd:]...)
+		res = append(append(res[:h.OldStart], b[h.NewStart:h.NewEnd]...), tail...)
+	}
+	return res
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		hunks []Hunk
+	}{
+		{"", "", nil},
+		{"a b c", "a b c", nil},
+		{"", "a b", []Hunk{{0, 0, 0, 2}}},
+		{"a b", "", []Hunk{{0, 2, 0, 0}}},
+		{"a b c", "a x c", []Hunk{{1, 2, 1, 2}}},
+		{"a b c d", "a c d e", []Hunk{{1, 2, 1, 1}, {4, 4, 3, 4}}},
+		// The example from Myers' paper
+		{"a b c a b b a", "c b a b a c", nil},
+	}
+
+	for _, test := range tests {
+		a, b := strings.Fields(test.a), strings.Fields(test.b)
+		hunks := Lines(a, b)
+
+		if got := apply(a, b, hunks); !reflect.DeepEqual(got, b) && !(len(got) == 0 && len(b) == 0) {
+			t.Errorf("Lines(%q, %q) gives %q", test.a, test.b, got)
+		}
+		if test.hunks != nil && !reflect.DeepEqual(hunks, test.hunks) {
+			t.Errorf("Lines(%q, %q) = %v, want %v", test.a, test.b, hunks, test.hunks)
+		}
+	}
+
+	// The edit script in the paper has 5 edits
+	a, b := strings.Fields("a b c a b b a"), strings.Fields("c b a b a c")
+	if n := edits(Lines(a, b)); n != 5 {
+		t.Errorf("paper example takes %d edits, want 5", n)
+	}
+}
+
+func TestLinesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	lines := func() []string {
+		l := make([]string, r.Intn(30))
+		for i := range l {
+			l[i] = string(rune('a' + r.Intn(4)))
+		}
+		return l
+	}
+
+	for i := 0; i < 1000; i++ {
+		a, b := lines(), lines()
+		got := apply(a, b, Lines(a, b))
+		if len(got) != 0 || len(b) != 0 {
+			if !reflect.DeepEqual(got, b) {
+				t.Fatalf("Lines(%q, %q) gives %q", a, b, got)
+			}
+		}
+
+		if got, want := edits(Lines(a, b)), len(a)+len(b)-2*lcs(a, b); got != want {
+			t.Fatalf("Lines(%q, %q) takes %d edits, want %d", a, b, got, want)
+		}
+	}
+}
+
+// A formatter that reindents every line of a file changes all of them
+func TestLinesLarge(t *testing.T) {
+	const n = 5000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("\tline %d", i)
+		b[i] = fmt.Sprintf("    line %d", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	hunks := Lines(a, b)
+	runtime.ReadMemStats(&after)
+
+	if want := []Hunk{{0, n, 0, n}}; !reflect.DeepEqual(hunks, want) {
+		t.Errorf("Lines gives %v, want %v", hunks, want)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("Lines allocates %d bytes for %d edits", alloc, 2*n)
+	}
+}
+
+// edits returns the number of lines the hunks delete and insert
+func edits(hunks []Hunk) int {
+	n := 0
+	for _, h := range hunks {
+		n += h.OldEnd - h.OldStart + h.NewEnd - h.NewStart
+	}
+	return n
+}
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				l[i][j] = l[i+1][j+1] + 1
+			case l[i+1][j] > l[i][j+1]:
+				l[i][j] = l[i+1][j]
+			default:
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	return l[0][0]
+}
@@ -0,0 +1,219 @@
+// Package editorconfig reads the settings for a file from the .editorconfig
+// files of its project, see https://editorconfig.org and its specification at
+// https://spec.editorconfig.org
+package editorconfig
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Filename is the name of the files that the settings are read from
+const Filename = ".editorconfig"
+
+// Properties are the settings for a file. The names are in lower case, as are
+// the values of the properties in the specification.
+type Properties map[string]string
+
+// The properties in the specification, their values aren't case sensitive
+var knownProperties = map[string]bool{
+	"indent_style":             true,
+	"indent_size":              true,
+	"tab_width":                true,
+	"end_of_line":              true,
+	"charset":                  true,
+	"trim_trailing_whitespace": true,
+	"insert_final_newline":     true,
+	"root":                     true,
+}
+
+// File is a parsed .editorconfig file
+type File struct {
+	// Whether the files in the directories above aren't read
+	Root     bool
+	Sections []Section
+}
+
+// Section is the properties for the files that match its glob
+type Section struct {
+	Glob       string
+	Properties Properties
+}
+
+// Parse reads an .editorconfig file. Lines that can't be parsed are ignored,
+// like other implementations do.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	var section *Section
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case len(line) == 0 || line[0] == '#' || line[0] == ';':
+			continue
+
+		case line[0] == '[':
+			// The glob can contain brackets itself
+			end := strings.LastIndexByte(line, ']')
+			if end == -1 {
+				continue
+			}
+
+			f.Sections = append(f.Sections, Section{Glob: line[1:end], Properties: Properties{}})
+			section = &f.Sections[len(f.Sections)-1]
+
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+
+			key = strings.ToLower(strings.TrimSpace(key))
+			value = strings.TrimSpace(value)
+			if knownProperties[key] {
+				value = strings.ToLower(value)
+			}
+
+			// Properties before the first section are for the file
+			// itself, only root is defined
+			if section == nil {
+				if key == "root" {
+					f.Root = value == "true"
+				}
+				continue
+			}
+			section.Properties[key] = value
+		}
+	}
+
+	return f, s.Err()
+}
+
+// Properties returns the properties of the file at path, which is relative to
+// the directory of the .editorconfig file and separated by slashes
+func (f *File) Properties(path string) Properties {
+	props := Properties{}
+	for _, s := range f.Sections {
+		if Match(s.Glob, path) {
+			for k, v := range s.Properties {
+				props[k] = v
+			}
+		}
+	}
+	return props
+}
+
+// Lookup returns the properties of the file, from the .editorconfig files in
+// its directory and those above it up to the one that is the root. Closer
+// files take precedence.
+func Lookup(filename string) (Properties, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files that apply, closest first
+	var files []*File
+	var dirs []string
+
+	dir := filepath.Dir(abs)
+	for {
+		f, err := parseFile(filepath.Join(dir, Filename))
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			files = append(files, f)
+			dirs = append(dirs, dir)
+			if f.Root {
+				break
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	props := Properties{}
+	for i := len(files) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], abs)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range files[i].Properties(filepath.ToSlash(rel)) {
+			props[k] = v
+		}
+	}
+
+	props.resolve()
+	return props, nil
+}
+
+// parseFile parses the .editorconfig file at path, it returns nil if there
+// isn't one
+func parseFile(path string) (*File, error) {
+	r, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return Parse(r)
+}
+
+// resolve removes the properties that are unset and fills in those that
+// default to others
+func (p Properties) resolve() {
+	for k, v := range p {
+		if v == "unset" {
+			delete(p, k)
+		}
+	}
+
+	if p["indent_style"] == "tab" && len(p["indent_size"]) == 0 {
+		p["indent_size"] = "tab"
+	}
+	if _, ok := p["tab_width"]; !ok && len(p["indent_size"]) != 0 && p["indent_size"] != "tab" {
+		p["tab_width"] = p["indent_size"]
+	}
+	if _, ok := p["tab_width"]; ok && p["indent_size"] == "tab" {
+		p["indent_size"] = p["tab_width"]
+	}
+}
+
+// Int returns the value of a property that is a positive number, it returns
+// false when the property isn't set to one
+func (p Properties) Int(name string) (int, bool) {
+	n, err := strconv.Atoi(p[name])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Bool returns the value of a property that is true or false, it returns
+// false for ok when the property isn't set to either
+func (p Properties) Bool(name string) (value, ok bool) {
+	switch p[name] {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,178 @@
+package editorconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The glob tests of the EditorConfig core tests, from
+// https://github.com/editorconfig/editorconfig-core-test/tree/master/glob
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		glob  string
+		match []string
+		not   []string
+	}{
+		// star.in
+		{"a*e.c", []string{"ace.c", "abcde.c", "ae.c"}, []string{"a/e.c", "ace.h"}},
+		{"Bar/*", []string{"Bar/foo.txt"}, []string{"Bar/foo/bar.txt", "foo/Bar/foo.txt"}},
+		{"*", []string{"a.txt", "dir/a.txt", ".hidden"}, nil},
+
+		// question.in
+		{"som?.c", []string{"some.c", "dir/somx.c"}, []string{"som.c", "something.c", "som/.c"}},
+
+		// brackets.in
+		{"[ab].a", []string{"a.a", "b.a"}, []string{"c.a", "ab.a"}},
+		{"[!ab].b", []string{"c.b"}, []string{"a.b", "b.b"}},
+		{"[d-g].c", []string{"d.c", "f.c", "g.c"}, []string{"c.c", "h.c"}},
+		{"[!d-g].d", []string{"c.d", "h.d"}, []string{"f.d"}},
+		{"[abd-g].e", []string{"a.e", "e.e"}, []string{"c.e"}},
+		{"[-ab].f", []string{"-.f", "a.f"}, []string{"c.f"}},
+		{`[\]ab].g`, []string{"].g", "a.g"}, []string{`\.g`, "c.g"}},
+		{"[ab]].g", []string{"b].g"}, []string{"b.g", "]].g"}},
+		{`[!\]ab].g`, []string{"c.g"}, []string{"].g", "a.g"}},
+		{"[!ab]].g", []string{"c].g"}, []string{"a].g", "c.g"}},
+		{"ab[e/]cd.i", []string{"ab[e/]cd.i"}, []string{"ab/cd.i", "abecd.i"}},
+		{"ab[/c", []string{"ab[/c"}, []string{"abc"}},
+
+		// braces.in
+		{"*.{py,js,html}", []string{"test.py", "test.js", "test.html"}, []string{"test.pyc", "test."}},
+		{"{single}.b", []string{"{single}.b"}, []string{"single.b"}},
+		{"{}.c", []string{"{}.c"}, []string{".c"}},
+		{"a{b,c,}.d", []string{"a.d", "ab.d", "ac.d"}, []string{"abc.d"}},
+		{"a{,b,,c,}.e", []string{"a.e", "ab.e", "ac.e"}, []string{"abc.e"}},
+		{"{.f", []string{"{.f"}, []string{".f"}},
+		{"{word,{also},this}.g", []string{"word.g", "{also}.g", "this.g"}, []string{"also.g"}},
+		{"{},b}.h", []string{"{},b}.h"}, []string{"}.h", "b.h"}},
+		{"{{,b,c{d}.i", []string{"{{,b,c{d}.i"}, []string{"{.i", "b.i", "c{d}.i"}},
+		{`{a\,b,cd}.txt`, []string{"a,b.txt", "cd.txt"}, []string{"a.txt"}},
+		{`{e,\},f}.txt`, []string{"e.txt", "}.txt", "f.txt"}, nil},
+		{`{g,\\,i}.txt`, []string{"g.txt", `\.txt`, "i.txt"}, nil},
+		{"{some,a{*c,b}[ef]}.j", []string{"some.j", "abe.j", "abf.j", "axyce.j"}, []string{"ab.j", "a.j"}},
+		{"{3..120}", []string{"3", "15", "60", "120"}, []string{"1", "121", "5a", "060", "+5"}},
+		{"{-3..-1}", []string{"-3", "-1"}, []string{"0", "-4", "3"}},
+		{"{aardvark..antelope}", []string{"{aardvark..antelope}"}, []string{"aardvark", "ant"}},
+		{"{a,{1..3}}.k", []string{"a.k", "2.k"}, []string{"4.k"}},
+
+		// star_star.in
+		{"a**z.c", []string{"a/z.c", "amnz.c", "am/nz.c", "a/mnz.c", "amn/z.c", "a/mn/z.c"}, nil},
+		{"b/**z.c", []string{"b/z.c", "b/mnz.c", "b/mn/z.c"}, []string{"bz.c", "bmnz.c"}},
+		{"c**/z.c", []string{"c/z.c", "cmn/z.c", "c/mn/z.c"}, []string{"cz.c", "cmnz.c"}},
+		{"d/**/z.c", []string{"d/z.c", "d/mn/z.c", "d/m/n/z.c"}, []string{"dz.c", "d/mnz.c"}},
+
+		// utf8char.in
+		{"中文.txt", []string{"中文.txt", "dir/中文.txt"}, []string{"中.txt"}},
+		{"?.txt", []string{"中.txt"}, []string{"中文.txt"}},
+
+		// Globs with a slash are relative to the directory of the file
+		{"/top.txt", []string{"top.txt"}, []string{"dir/top.txt"}},
+		{"dir/*.txt", []string{"dir/a.txt"}, []string{"other/dir/a.txt"}},
+		{`\*.txt`, []string{"*.txt"}, []string{"a.txt"}},
+	}
+
+	for _, test := range tests {
+		for _, path := range test.match {
+			if !Match(test.glob, path) {
+				t.Errorf("Match(%q, %q) = false, want true", test.glob, path)
+			}
+		}
+		for _, path := range test.not {
+			if Match(test.glob, path) {
+				t.Errorf("Match(%q, %q) = true, want false", test.glob, path)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	in := `# comment
+; another comment
+root = TRUE
+
+[*]
+indent_style = Space
+Indent_Size=4
+key = Value with = sign
+
+  [*.{go,mod}]
+indent_style = tab
+not a property
+`
+
+	f, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &File{
+		Root: true,
+		Sections: []Section{
+			{Glob: "*", Properties: Properties{"indent_style": "space", "indent_size": "4", "key": "Value with = sign"}},
+			{Glob: "*.{go,mod}", Properties: Properties{"indent_style": "tab"}},
+		},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("Parse() = %+v, want %+v", f, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		// Above the root so it is ignored
+		Filename: "root = true\n[*]\ncharset = latin1\n",
+		"project/" + Filename: `root = true
+[*]
+indent_style = space
+indent_size = 4
+end_of_line = lf
+
+[*.go]
+indent_style = tab
+indent_size = unset
+`,
+		"project/sub/" + Filename: `[*.go]
+tab_width = 8
+[/sub.txt]
+end_of_line = crlf
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file string
+		want Properties
+	}{
+		{"project/a.txt", Properties{"indent_style": "space", "indent_size": "4", "tab_width": "4", "end_of_line": "lf"}},
+		// indent_size defaults to tab_width with tabs
+		{"project/a.go", Properties{"indent_style": "tab", "indent_size": "tab", "end_of_line": "lf"}},
+		{"project/sub/a.go", Properties{"indent_style": "tab", "indent_size": "8", "tab_width": "8", "end_of_line": "lf"}},
+		// Globs with a slash are relative to their file
+		{"project/sub/sub.txt", Properties{"indent_style": "space", "indent_size": "4", "tab_width": "4", "end_of_line": "crlf"}},
+		{"project/sub/dir/sub.txt", Properties{"indent_style": "space", "indent_size": "4", "tab_width": "4", "end_of_line": "lf"}},
+		{"a.txt", Properties{"charset": "latin1"}},
+	}
+
+	for _, test := range tests {
+		got, err := Lookup(filepath.Join(dir, test.file))
+		if err != nil {
+			t.Errorf("Lookup(%q) error: %s", test.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lookup(%q) = %v, want %v", test.file, got, test.want)
+		}
+	}
+}
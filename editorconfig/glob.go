@@ -0,0 +1,260 @@
+package editorconfig
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Match reports whether the path matches the glob of a section. The path is
+// relative to the directory of the .editorconfig file and separated by
+// slashes.
+//
+// A glob without a slash matches files in any directory, otherwise it is
+// relative to the directory of the .editorconfig file. In a glob "*" is any
+// characters except slashes and "**" any characters at all, "?" is any
+// character except a slash, "[abc]" or "[a-c]" is one of the characters and
+// "[!abc]" any other. "{s1,s2,s3}" is any of the strings, which can be globs
+// themselves, "{n1..n2}" is a whole number from n1 to n2 and "\" escapes the
+// character after it.
+func Match(glob, path string) bool {
+	if strings.ContainsRune(glob, '/') {
+		glob = strings.TrimPrefix(glob, "/")
+	} else {
+		glob = "**/" + glob
+	}
+
+	g := compile("/" + glob)
+	return g.match("/" + path)
+}
+
+// glob is a glob translated to a regular expression
+type glob struct {
+	re *regexp.Regexp
+	// The ranges of the {n1..n2} in the glob, in the order of the groups
+	// of re that match them
+	ranges [][2]int
+}
+
+func compile(pattern string) glob {
+	expr, ranges := translate(pattern, false)
+	re, err := regexp.Compile("^(?s:" + expr + ")$")
+	if err != nil {
+		// Anything that isn't valid is escaped, so this shouldn't happen,
+		// but then the glob can only match itself
+		re = regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+		ranges = nil
+	}
+	return glob{re: re, ranges: ranges}
+}
+
+func (g glob) match(path string) bool {
+	m := g.re.FindStringSubmatchIndex(path)
+	if m == nil {
+		return false
+	}
+
+	for i, r := range g.ranges {
+		// The range may be in an alternative that didn't match
+		if m[2*i+2] == -1 {
+			continue
+		}
+
+		num := path[m[2*i+2]:m[2*i+3]]
+		n, err := strconv.Atoi(num)
+		// Numbers are written without leading zeros or a plus sign
+		if err != nil || strconv.Itoa(n) != num || n < r[0] || n > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+var numericRange = regexp.MustCompile(`^([+-]?\d+)\.\.([+-]?\d+)$`)
+
+// translate returns the regular expression for the glob. Braces are only
+// alternatives when they are all closed, inside others they are always
+// literal.
+func translate(pattern string, nested bool) (string, [][2]int) {
+	var b strings.Builder
+	var ranges [][2]int
+
+	braces := !nested && bracesMatch(pattern)
+	depth := 0
+	inBrackets := false
+	escaped := false
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		if escaped {
+			escaped = false
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+
+		// Only ] and escapes are special in brackets
+		if inBrackets {
+			switch c {
+			case '\\':
+				escaped = true
+			case ']':
+				inBrackets = false
+				b.WriteByte(']')
+			case '-':
+				b.WriteByte('-')
+			default:
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+			continue
+		}
+
+		switch c {
+		case '\\':
+			escaped = true
+
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+
+		case '?':
+			b.WriteString("[^/]")
+
+		case '[':
+			// A slash can't be matched by brackets, so they are
+			// literal
+			end := closingBracket(pattern, i+1)
+			if end == -1 {
+				b.WriteString(`\[`)
+				break
+			}
+			if strings.ContainsRune(pattern[i+1:end], '/') {
+				b.WriteString(regexp.QuoteMeta(pattern[i : end+1]))
+				i = end
+				break
+			}
+
+			inBrackets = true
+			b.WriteByte('[')
+			if i+1 < len(pattern) && (pattern[i+1] == '!' || pattern[i+1] == '^') {
+				b.WriteByte('^')
+				i++
+			}
+
+		case '{':
+			end, comma := closingBrace(pattern, i+1)
+			if !comma && end != -1 {
+				inner := pattern[i+1 : end]
+				if m := numericRange.FindStringSubmatch(inner); m != nil {
+					lo, _ := strconv.Atoi(m[1])
+					hi, _ := strconv.Atoi(m[2])
+					ranges = append(ranges, [2]int{lo, hi})
+					b.WriteString(`([+-]?\d+)`)
+				} else {
+					// A single choice is literal
+					expr, innerRanges := translate(inner, true)
+					b.WriteString(`\{` + expr + `\}`)
+					ranges = append(ranges, innerRanges...)
+				}
+				i = end
+				break
+			}
+
+			if braces {
+				b.WriteString("(?:")
+				depth++
+			} else {
+				b.WriteString(`\{`)
+			}
+
+		case ',':
+			if depth > 0 {
+				b.WriteByte('|')
+			} else {
+				b.WriteString(",")
+			}
+
+		case '}':
+			if depth > 0 {
+				b.WriteByte(')')
+				depth--
+			} else {
+				b.WriteString(`\}`)
+			}
+
+		case '/':
+			// "/**/" matches any number of directories, including none
+			if strings.HasPrefix(pattern[i+1:], "**/") {
+				b.WriteString("(?:/|/.*/)")
+				i += 3
+			} else {
+				b.WriteByte('/')
+			}
+
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	if escaped {
+		b.WriteString(`\\`)
+	}
+	// Braces in brackets are counted by bracesMatch but aren't closed here
+	for ; depth > 0; depth-- {
+		b.WriteByte(')')
+	}
+	return b.String(), ranges
+}
+
+// closingBracket returns the index of the ] that closes the bracket expression
+// starting at i, or -1
+func closingBracket(pattern string, i int) int {
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// closingBrace returns the index of the } that closes the brace starting at i,
+// or -1, and whether there is a comma before it
+func closingBrace(pattern string, i int) (int, bool) {
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ',':
+			return -1, true
+		case '}':
+			return i, false
+		}
+	}
+	return -1, false
+}
+
+// bracesMatch reports whether every unescaped { has a }
+func bracesMatch(pattern string) bool {
+	open, closed := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			open++
+		case '}':
+			closed++
+		}
+	}
+	return open == closed
+}
@@ -0,0 +1,169 @@
+// Fuzzy matching of a pattern against candidate strings, in the style of fzf.
+package fuzzy
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Scoring constants. A matching character is always worth more than a gap
+// costs so that matches spread out over a long candidate still score above
+// zero, the bonuses reward matches that the user is likely to have meant.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// Matching the start of a word, e.g. the "b" in "foo/bar" or "foo_bar"
+	bonusBoundary = 8
+	// Matching an uppercase letter after a lowercase one, e.g. "fooBar"
+	bonusCamel = 7
+	// Matching several characters in a row
+	bonusConsecutive = 4
+	// The bonus of the first character of the pattern is multiplied by this
+	bonusFirstCharMultiplier = 2
+)
+
+// Match reports whether all the runes in pattern appear in text in order and
+// scores the match, higher is better. Matching ignores case unless the pattern
+// contains an uppercase letter.
+func Match(pattern, text string) (score int, ok bool) {
+	if len(pattern) == 0 {
+		return 0, true
+	}
+
+	// Use the stack for the common case of short strings, this is called
+	// for every file in a project on each key press
+	var pbuf [32]rune
+	var tbuf, obuf [256]rune
+
+	p := pbuf[:0]
+	for _, r := range pattern {
+		p = append(p, r)
+	}
+	caseSensitive := false
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			caseSensitive = true
+			break
+		}
+	}
+
+	t, orig := tbuf[:0], obuf[:0]
+	for _, r := range text {
+		orig = append(orig, r)
+		if !caseSensitive {
+			r = toLower(r)
+		}
+		t = append(t, r)
+	}
+
+	// Find the first position where the whole pattern has been matched
+	pi, end := 0, -1
+	for i, r := range t {
+		if r == p[pi] {
+			pi++
+			if pi == len(p) {
+				end = i
+				break
+			}
+		}
+	}
+	if end == -1 {
+		return 0, false
+	}
+
+	// Then go backwards to find the shortest window that contains it
+	pi, start := len(p)-1, end
+	for i := end; i >= 0; i-- {
+		if t[i] == p[pi] {
+			pi--
+			if pi < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	return scoreWindow(p, orig, t, start, end), true
+}
+
+func toLower(r rune) rune {
+	if r < utf8.RuneSelf {
+		if 'A' <= r && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		return r
+	}
+	return unicode.ToLower(r)
+}
+
+// scoreWindow scores the match of p in t[start:end+1]. The original text is
+// needed as the bonuses depend on the case of the characters.
+func scoreWindow(p, orig, t []rune, start, end int) int {
+	var (
+		total       int
+		pi          int
+		inGap       bool
+		consecutive int
+		prev        rune = '/'
+	)
+
+	if start > 0 {
+		prev = orig[start-1]
+	}
+
+	for i := start; i <= end; i++ {
+		r := orig[i]
+
+		if pi < len(p) && t[i] == p[pi] {
+			b := bonus(prev, r)
+			if pi == 0 {
+				b *= bonusFirstCharMultiplier
+			}
+
+			if consecutive > 0 {
+				b += bonusConsecutive
+			}
+
+			total += scoreMatch + b
+			consecutive++
+			inGap = false
+			pi++
+		} else {
+			if inGap {
+				total += scoreGapExtension
+			} else {
+				total += scoreGapStart
+			}
+			consecutive = 0
+			inGap = true
+		}
+
+		prev = r
+	}
+
+	return total
+}
+
+// bonus scores how likely it is that r is the start of something the user
+// would type, given the rune before it
+func bonus(prev, r rune) int {
+	switch {
+	case isDelimiter(prev) && !isDelimiter(r):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(r):
+		return bonusCamel
+	case !unicode.IsDigit(prev) && unicode.IsDigit(r):
+		return bonusCamel
+	}
+	return 0
+}
+
+func isDelimiter(r rune) bool {
+	switch r {
+	case '/', '_', '-', '.', ' ', '\\', ':':
+		return true
+	}
+	return r == utf8.RuneError || unicode.IsSpace(r)
+}
@@ -0,0 +1,58 @@
+package fuzzy
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, text string
+		ok            bool
+	}{
+		{"", "anything", true},
+		{"abc", "abc", true},
+		{"abc", "a/b/c", true},
+		{"abc", "ABC", true},
+		{"ABC", "abc", false},
+		{"acb", "abc", false},
+		{"core", "core/li.go", true},
+		{"lig", "core/li.go", true},
+		{"xyz", "core/li.go", false},
+		{"li.go.", "core/li.go", false},
+	} {
+		if _, ok := Match(test.pattern, test.text); ok != test.ok {
+			t.Errorf("Match(%q, %q) ok=%v, expected %v", test.pattern, test.text, ok, test.ok)
+		}
+	}
+}
+
+func TestMatchRanking(t *testing.T) {
+	// For each test the first text should be ranked above the second
+	for _, test := range []struct {
+		pattern       string
+		better, worse string
+	}{
+		// consecutive characters
+		{"or", "core", "coder"},
+		// start of a path component
+		{"sdk", "core/sdk.go", "config/sidekick.go"},
+		// start of a word
+		{"fb", "foo_bar", "fizzbuzz"},
+		// camel case
+		{"fb", "fooBar", "foobar"},
+		// shorter gap
+		{"ag", "a/b/g", "a/bbbbbbbbbbbbbb/g"},
+	} {
+		better, ok := Match(test.pattern, test.better)
+		if !ok {
+			t.Fatalf("%q should match %q", test.pattern, test.better)
+		}
+
+		worse, ok := Match(test.pattern, test.worse)
+		if !ok {
+			t.Fatalf("%q should match %q", test.pattern, test.worse)
+		}
+
+		if better <= worse {
+			t.Errorf("pattern=%q expected %q (%d) to score higher than %q (%d)", test.pattern, test.better, better, test.worse, worse)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package lsp is a client for the Language Server Protocol, it talks to a
+// language server over its stdin and stdout.
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Client is a connection to a language server. Its methods block until the
+// server responds so they should not be called from the editor's event loop.
+type Client struct {
+	conn *Conn
+	cmd  *exec.Cmd
+
+	// OnDiagnostics is called with the diagnostics the server publishes. It
+	// is called from the goroutine reading the connection.
+	OnDiagnostics func(PublishDiagnosticsParams)
+
+	syncKind int
+}
+
+// Start runs the language server in dir and connects to it. The connection
+// must still be initialized with Initialize.
+func Start(command []string, dir string) (*Client, error) {
+	if len(command) == 0 {
+		return nil, errors.New("no language server command")
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := NewClient(&pipe{stdout, stdin})
+	c.cmd = cmd
+	return c, nil
+}
+
+// pipe joins the standard input and output of the server
+type pipe struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (p *pipe) Close() error {
+	err := p.WriteCloser.Close()
+	if err2 := p.ReadCloser.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// NewClient returns a client for a server connected by rwc
+func NewClient(rwc io.ReadWriteCloser) *Client {
+	c := &Client{}
+	c.conn = NewConn(rwc, c.handle)
+	return c
+}
+
+// handle responds to the requests and notifications from the server
+func (c *Client) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p PublishDiagnosticsParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if c.OnDiagnostics != nil {
+			c.OnDiagnostics(p)
+		}
+		return nil, nil
+	case "workspace/configuration":
+		// There is no configuration, every item is null
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return make([]interface{}, len(p.Items)), nil
+	}
+
+	// Requests like window/workDoneProgress/create and
+	// client/registerCapability only need acknowledging, and notifications
+	// like window/logMessage are ignored
+	return nil, nil
+}
+
+// Initialize performs the initialization handshake for the project at root
+func (c *Client) Initialize(root string) error {
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   FileURI(root),
+		"clientInfo": map[string]string{
+			"name": "li",
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"synchronization": map[string]interface{}{
+					"dynamicRegistration": false,
+				},
+				"hover": map[string]interface{}{
+					"contentFormat": []string{"plaintext"},
+				},
+				"definition": map[string]interface{}{
+					"linkSupport": true,
+				},
+				"rename": map[string]interface{}{},
+				"completion": map[string]interface{}{
+					"completionItem": map[string]interface{}{
+						"snippetSupport": false,
+					},
+				},
+				"publishDiagnostics": map[string]interface{}{
+					"versionSupport": true,
+				},
+			},
+			"workspace": map[string]interface{}{
+				"configuration":    true,
+				"workspaceEdit":    map[string]interface{}{"documentChanges": true},
+				"workspaceFolders": false,
+			},
+		},
+	}
+
+	var result struct {
+		Capabilities struct {
+			TextDocumentSync json.RawMessage `json:"textDocumentSync"`
+		} `json:"capabilities"`
+	}
+	if err := c.conn.Call("initialize", params, &result); err != nil {
+		return errors.Wrap(err, "initialize")
+	}
+
+	// The sync kind is either a number or in an object of options
+	c.syncKind = SyncNone
+	if sync := result.Capabilities.TextDocumentSync; len(sync) != 0 {
+		if err := json.Unmarshal(sync, &c.syncKind); err != nil {
+			var opts struct {
+				Change int `json:"change"`
+			}
+			if err := json.Unmarshal(sync, &opts); err == nil {
+				c.syncKind = opts.Change
+			}
+		}
+	}
+
+	return c.conn.Notify("initialized", struct{}{})
+}
+
+// SyncKind is how the server wants changes to documents to be sent, one of
+// SyncNone, SyncFull or SyncIncremental
+func (c *Client) SyncKind() int {
+	return c.syncKind
+}
+
+// Shutdown asks the server to exit and closes the connection
+func (c *Client) Shutdown() error {
+	err := c.conn.Call("shutdown", nil, nil)
+	if err == nil {
+		err = c.conn.Notify("exit", nil)
+	}
+
+	c.conn.Close()
+	if c.cmd != nil {
+		c.cmd.Wait()
+	}
+	return err
+}
+
+// Kill stops the server without asking it, such as one that is still being
+// initialized, and closes the connection
+func (c *Client) Kill() {
+	if c.cmd != nil {
+		c.cmd.Process.Kill()
+	}
+
+	c.conn.Close()
+	if c.cmd != nil {
+		c.cmd.Wait()
+	}
+}
+
+func (c *Client) DidOpen(uri, languageID string, version int, text string) error {
+	return c.conn.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": TextDocumentItem{
+			URI:        uri,
+			LanguageID: languageID,
+			Version:    version,
+			Text:       text,
+		},
+	})
+}
+
+func (c *Client) DidChange(uri string, version int, changes []TextDocumentContentChangeEvent) error {
+	return c.conn.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: version},
+		"contentChanges": changes,
+	})
+}
+
+func (c *Client) DidSave(uri string) error {
+	return c.conn.Notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+	})
+}
+
+func (c *Client) DidClose(uri string) error {
+	return c.conn.Notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+	})
+}
+
+func positionParams(uri string, pos Position) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     pos,
+	}
+}
+
+// Definition returns where the symbol at the position is defined
+func (c *Client) Definition(uri string, pos Position) ([]Location, error) {
+	var raw json.RawMessage
+	if err := c.conn.Call("textDocument/definition", positionParams(uri, pos), &raw); err != nil {
+		return nil, err
+	}
+	return parseLocations(raw)
+}
+
+// Hover returns the documentation of the symbol at the position as text
+func (c *Client) Hover(uri string, pos Position) (string, error) {
+	var raw json.RawMessage
+	if err := c.conn.Call("textDocument/hover", positionParams(uri, pos), &raw); err != nil {
+		return "", err
+	}
+	return parseHover(raw)
+}
+
+// References returns where the symbol at the position is used, including its
+// declaration
+func (c *Client) References(uri string, pos Position) ([]Location, error) {
+	params := struct {
+		TextDocumentPositionParams
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}{TextDocumentPositionParams: positionParams(uri, pos)}
+	params.Context.IncludeDeclaration = true
+
+	var raw json.RawMessage
+	if err := c.conn.Call("textDocument/references", params, &raw); err != nil {
+		return nil, err
+	}
+	return parseLocations(raw)
+}
+
+// Completion returns the candidates for completing the text at the position
+func (c *Client) Completion(uri string, pos Position) ([]CompletionItem, error) {
+	var raw json.RawMessage
+	if err := c.conn.Call("textDocument/completion", positionParams(uri, pos), &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	// The result is either a list of items or a CompletionList
+	var items []CompletionItem
+	if raw[0] == '[' {
+		err := json.Unmarshal(raw, &items)
+		return items, err
+	}
+
+	var list struct {
+		Items []CompletionItem `json:"items"`
+	}
+	err := json.Unmarshal(raw, &list)
+	return list.Items, err
+}
+
+// Rename returns the edits that rename the symbol at the position
+func (c *Client) Rename(uri string, pos Position, newName string) (WorkspaceEdit, error) {
+	params := struct {
+		TextDocumentPositionParams
+		NewName string `json:"newName"`
+	}{positionParams(uri, pos), newName}
+
+	var edit WorkspaceEdit
+	err := c.conn.Call("textDocument/rename", params, &edit)
+	return edit, err
+}
+
+// Formatting returns the edits that format the document
+func (c *Client) Formatting(uri string, opts FormattingOptions) ([]TextEdit, error) {
+	params := map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+		"options":      opts,
+	}
+
+	var edits []TextEdit
+	err := c.conn.Call("textDocument/formatting", params, &edits)
+	return edits, err
+}
@@ -0,0 +1,293 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-process language server that keeps a copy of the open
+// documents, the way a real server would
+type fakeServer struct {
+	conn *Conn
+
+	mu   sync.Mutex
+	docs map[string][]string
+}
+
+// pipeConn joins two pipes into a connection
+type pipeConn struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (p pipeConn) Close() error {
+	p.PipeReader.Close()
+	return p.PipeWriter.Close()
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeServer) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	s := &fakeServer{docs: map[string][]string{}}
+	s.conn = NewConn(pipeConn{sr, sw}, s.handle)
+
+	c := NewClient(pipeConn{cr, cw})
+	t.Cleanup(func() {
+		c.conn.Close()
+		s.conn.Close()
+	})
+
+	return c, s
+}
+
+func (s *fakeServer) handle(method string, params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{"openClose": true, "change": SyncIncremental},
+			},
+		}, nil
+	case "initialized", "shutdown", "exit":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct{ TextDocument TextDocumentItem }
+		json.Unmarshal(params, &p)
+		s.docs[p.TextDocument.URI] = strings.Split(p.TextDocument.Text, "\n")
+
+		// Complain about the first line, asynchronously like a real server
+		go s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI: p.TextDocument.URI,
+			Diagnostics: []Diagnostic{{
+				Range:    Range{Position{0, 0}, Position{0, 1}},
+				Severity: SeverityError,
+				Message:  "bad",
+			}},
+		})
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument   VersionedTextDocumentIdentifier
+			ContentChanges []TextDocumentContentChangeEvent
+		}
+		json.Unmarshal(params, &p)
+		for _, c := range p.ContentChanges {
+			s.docs[p.TextDocument.URI] = applyChange(s.docs[p.TextDocument.URI], c)
+		}
+		return nil, nil
+	case "textDocument/definition":
+		var p TextDocumentPositionParams
+		json.Unmarshal(params, &p)
+		return []map[string]interface{}{{
+			"targetUri":            p.TextDocument.URI,
+			"targetRange":          Range{Position{3, 0}, Position{5, 1}},
+			"targetSelectionRange": Range{Position{3, 5}, Position{3, 8}},
+		}}, nil
+	case "textDocument/hover":
+		return map[string]interface{}{
+			"contents": map[string]string{"kind": "plaintext", "value": "func f()"},
+		}, nil
+	case "textDocument/references":
+		var p TextDocumentPositionParams
+		json.Unmarshal(params, &p)
+		return []Location{
+			{URI: p.TextDocument.URI, Range: Range{Position{1, 2}, Position{1, 3}}},
+			{URI: p.TextDocument.URI, Range: Range{Position{4, 0}, Position{4, 1}}},
+		}, nil
+	case "textDocument/rename":
+		var p struct {
+			TextDocumentPositionParams
+			NewName string
+		}
+		json.Unmarshal(params, &p)
+		return WorkspaceEdit{
+			DocumentChanges: []TextDocumentEdit{{
+				TextDocument: VersionedTextDocumentIdentifier{URI: p.TextDocument.URI, Version: 1},
+				Edits:        []TextEdit{{Range: Range{Position{0, 0}, Position{0, 1}}, NewText: p.NewName}},
+			}},
+		}, nil
+	case "textDocument/completion":
+		return map[string]interface{}{
+			"isIncomplete": false,
+			"items": []CompletionItem{
+				{Label: "Println", Kind: 3},
+				{Label: "Printf", InsertText: "Printf"},
+			},
+		}, nil
+	case "textDocument/formatting":
+		return nil, &ResponseError{Code: -32603, Message: "cannot format"}
+	}
+
+	return nil, &ResponseError{Code: CodeMethodNotFound, Message: method}
+}
+
+// applyChange applies an incremental change to the lines of a document
+func applyChange(lines []string, c TextDocumentContentChangeEvent) []string {
+	if c.Range == nil {
+		return strings.Split(c.Text, "\n")
+	}
+
+	start, end := c.Range.Start, c.Range.End
+	first := []rune(lines[start.Line])
+	last := []rune(lines[end.Line])
+
+	text := string(first[:FromUTF16(first, start.Character)]) + c.Text + string(last[FromUTF16(last, end.Character):])
+
+	res := append([]string{}, lines[:start.Line]...)
+	res = append(res, strings.Split(text, "\n")...)
+	return append(res, lines[end.Line+1:]...)
+}
+
+func TestDocumentSync(t *testing.T) {
+	c, s := newTestClient(t)
+
+	diags := make(chan PublishDiagnosticsParams, 1)
+	c.OnDiagnostics = func(p PublishDiagnosticsParams) { diags <- p }
+
+	if err := c.Initialize("."); err != nil {
+		t.Fatal(err)
+	}
+	if c.SyncKind() != SyncIncremental {
+		t.Fatalf("sync kind %d, want %d", c.SyncKind(), SyncIncremental)
+	}
+
+	uri := FileURI("a.go")
+	if err := c.DidOpen(uri, "go", 1, "a\nb\nc\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case p := <-diags:
+		if p.URI != uri || len(p.Diagnostics) != 1 || p.Diagnostics[0].Message != "bad" {
+			t.Errorf("unexpected diagnostics %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no diagnostics published")
+	}
+
+	changes := []struct {
+		y, n int
+		rows []string
+	}{
+		// Replace "b" with two rows
+		{1, 1, []string{"b1", "b2"}},
+		// Delete "a"
+		{0, 1, nil},
+		// Insert a row before the end
+		{3, 0, []string{"d"}},
+	}
+
+	for i, ch := range changes {
+		// Rows are sent the way the editor does, as whole lines
+		var text strings.Builder
+		for _, r := range ch.rows {
+			text.WriteString(r + "\n")
+		}
+
+		err := c.DidChange(uri, i+2, []TextDocumentContentChangeEvent{{
+			Range: &Range{Position{ch.y, 0}, Position{ch.y + ch.n, 0}},
+			Text:  text.String(),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Notifications are handled in order, so a request made after them is
+	// answered after they have been applied
+	if _, err := c.Hover(uri, Position{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	got := strings.Join(s.docs[uri], "\n")
+	s.mu.Unlock()
+
+	if want := "b1\nb2\nc\nd\n"; got != want {
+		t.Errorf("server has %q, want %q", got, want)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	c, _ := newTestClient(t)
+	if err := c.Initialize("."); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := FileURI("a.go")
+
+	locs, err := c.Definition(uri, Position{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{URI: uri, Range: Range{Position{3, 5}, Position{3, 8}}}
+	if len(locs) != 1 || locs[0] != want {
+		t.Errorf("definition %+v, want %+v", locs, want)
+	}
+
+	hover, err := c.Hover(uri, Position{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hover != "func f()" {
+		t.Errorf("hover %q, want %q", hover, "func f()")
+	}
+
+	locs, err = c.References(uri, Position{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 2 || locs[1].Range.Start.Line != 4 {
+		t.Errorf("unexpected references %+v", locs)
+	}
+
+	items, err := c.Completion(uri, Position{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Label != "Println" || items[1].InsertText != "Printf" {
+		t.Errorf("unexpected completions %+v", items)
+	}
+
+	edit, err := c.Rename(uri, Position{0, 0}, "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits := edit.Edits()[uri]
+	if len(edits) != 1 || edits[0].NewText != "g" {
+		t.Errorf("unexpected rename edits %+v", edit.Edits())
+	}
+
+	if _, err := c.Formatting(uri, FormattingOptions{TabSize: 8}); err == nil || !strings.Contains(err.Error(), "cannot format") {
+		t.Errorf("formatting error %v, want the server's error", err)
+	}
+
+	if err := c.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Hover(uri, Position{}); err == nil {
+		t.Error("request succeeded after shutdown")
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	// 'é' is one code unit, '😀' is two
+	line := []rune("é😀x")
+
+	for x, col := range []int{0, 1, 3, 4} {
+		if got := ToUTF16(line, x); got != col {
+			t.Errorf("ToUTF16(%d) = %d, want %d", x, got, col)
+		}
+		if got := FromUTF16(line, col); got != x {
+			t.Errorf("FromUTF16(%d) = %d, want %d", col, got, x)
+		}
+	}
+}
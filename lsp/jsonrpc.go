@@ -0,0 +1,273 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrClosed is returned by calls that are waiting on a response when the
+// connection is closed
+var ErrClosed = errors.New("connection closed")
+
+// Handler handles the requests and notifications sent by the other end of a
+// connection. The result is only used for requests. It is called from the
+// goroutine reading the connection, so it must not make calls itself.
+type Handler func(method string, params json.RawMessage) (interface{}, error)
+
+// ResponseError is the error returned by the other end for a failed request
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Error code for requests of an unknown method
+const CodeMethodNotFound = -32601
+
+// message is any JSON-RPC message, the fields present determine whether it
+// is a request, response or notification
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+// Conn is a JSON-RPC 2.0 connection that uses the LSP base protocol, where
+// every message is preceded by a Content-Length header.
+type Conn struct {
+	rwc     io.ReadWriteCloser
+	handler Handler
+
+	// guards writing messages
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	closed  bool
+}
+
+// NewConn starts reading messages from rwc, requests and notifications are
+// sent to handler
+func NewConn(rwc io.ReadWriteCloser, handler Handler) *Conn {
+	c := &Conn{
+		rwc:     rwc,
+		handler: handler,
+		pending: map[int64]chan *message{},
+	}
+
+	go c.readLoop()
+	return c
+}
+
+// Call sends a request and waits for the response, which is decoded into
+// result unless it is nil
+func (c *Conn) Call(method string, params, result interface{}) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.write(struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Method  string           `json:"method"`
+		Params  interface{}      `json:"params,omitempty"`
+	}{"2.0", &rawID, method, params}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return ErrClosed
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+
+	// Some results are unions of different types, let the caller decode
+	// them
+	if raw, ok := result.(*json.RawMessage); ok {
+		*raw = resp.Result
+		return nil
+	}
+
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Notify sends a notification, which has no response
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{"2.0", method, params})
+}
+
+func (c *Conn) Close() error {
+	return c.rwc.Close()
+}
+
+func (c *Conn) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if _, err := fmt.Fprintf(c.rwc, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.rwc.Write(data)
+	return err
+}
+
+func (c *Conn) readLoop() {
+	defer func() {
+		c.mu.Lock()
+		c.closed = true
+		for id, ch := range c.pending {
+			close(ch)
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c.rwc)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case len(msg.Method) != 0:
+			c.handle(msg)
+		case msg.ID != nil:
+			id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+
+			c.mu.Lock()
+			ch, ok := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+
+			if ok {
+				ch <- msg
+			}
+		}
+	}
+}
+
+// handle passes a request or notification to the handler, responding to
+// requests with its result
+func (c *Conn) handle(msg *message) {
+	var (
+		result interface{}
+		err    error
+	)
+
+	if c.handler != nil {
+		result, err = c.handler(msg.Method, msg.Params)
+	} else {
+		err = &ResponseError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+
+	// Notifications don't get a response
+	if msg.ID == nil {
+		return
+	}
+
+	if err != nil {
+		respErr, ok := err.(*ResponseError)
+		if !ok {
+			respErr = &ResponseError{Code: -32603, Message: err.Error()}
+		}
+
+		c.write(struct {
+			JSONRPC string           `json:"jsonrpc"`
+			ID      *json.RawMessage `json:"id"`
+			Error   *ResponseError   `json:"error"`
+		}{"2.0", msg.ID, respErr})
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		data = []byte("null")
+	}
+
+	c.write(struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Result  json.RawMessage  `json:"result"`
+	}{"2.0", msg.ID, data})
+}
+
+func readMessage(r *bufio.Reader) (*message, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid Content-Length")
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, errors.New("message has no Content-Length")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, errors.Wrap(err, "decoding message")
+	}
+	return &msg, nil
+}
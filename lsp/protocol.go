@@ -0,0 +1,264 @@
+package lsp
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// The subset of the Language Server Protocol types that li uses, see
+// https://microsoft.github.io/language-server-protocol/specification
+
+// Position in a document. Both are zero based and the character offset is
+// in UTF-16 code units.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range in a document, End is exclusive
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// TextDocumentContentChangeEvent replaces the range with the text, or the whole
+// document when there is no range
+type TextDocumentContentChangeEvent struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// Values of TextDocumentSyncKind
+const (
+	SyncNone        = 0
+	SyncFull        = 1
+	SyncIncremental = 2
+)
+
+// Values of DiagnosticSeverity
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+)
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// CompletionItem is a candidate for completing the text at a position. The
+// text to insert is TextEdit's, InsertText or Label, whichever is set first.
+type CompletionItem struct {
+	Label            string    `json:"label"`
+	Kind             int       `json:"kind,omitempty"`
+	Detail           string    `json:"detail,omitempty"`
+	InsertText       string    `json:"insertText,omitempty"`
+	InsertTextFormat int       `json:"insertTextFormat,omitempty"`
+	TextEdit         *TextEdit `json:"textEdit,omitempty"`
+}
+
+// Values of CompletionItem.InsertTextFormat
+const (
+	FormatPlainText = 1
+	FormatSnippet   = 2
+)
+
+type FormattingOptions struct {
+	TabSize      int  `json:"tabSize"`
+	InsertSpaces bool `json:"insertSpaces"`
+}
+
+// WorkspaceEdit is a change to several documents. Servers may describe it with
+// either field.
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []TextDocumentEdit    `json:"documentChanges,omitempty"`
+}
+
+type TextDocumentEdit struct {
+	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit                      `json:"edits"`
+}
+
+// Edits returns the edits to make to each document
+func (w WorkspaceEdit) Edits() map[string][]TextEdit {
+	edits := map[string][]TextEdit{}
+	for uri, e := range w.Changes {
+		edits[uri] = append(edits[uri], e...)
+	}
+	for _, d := range w.DocumentChanges {
+		// File operations, such as renaming a file, have no document
+		if len(d.TextDocument.URI) != 0 {
+			edits[d.TextDocument.URI] = append(edits[d.TextDocument.URI], d.Edits...)
+		}
+	}
+	return edits
+}
+
+// FileURI converts a file path into a "file://" URI
+func FileURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
+
+// URIPath converts a "file://" URI into a file path
+func URIPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return strings.TrimPrefix(uri, "file://")
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// ToUTF16 converts the rune index x in the line to a UTF-16 offset
+func ToUTF16(line []rune, x int) int {
+	if x > len(line) {
+		x = len(line)
+	}
+
+	n := 0
+	for _, r := range line[:x] {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// FromUTF16 converts the UTF-16 offset in the line to a rune index
+func FromUTF16(line []rune, col int) int {
+	n := 0
+	for i, r := range line {
+		if n >= col {
+			return i
+		}
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+// parseLocations parses the result of requests like textDocument/definition,
+// which may be null, a Location, a list of them or a list of LocationLinks
+func parseLocations(raw json.RawMessage) ([]Location, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	type locationOrLink struct {
+		Location
+		TargetURI            string `json:"targetUri"`
+		TargetSelectionRange Range  `json:"targetSelectionRange"`
+	}
+
+	var list []locationOrLink
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+	} else {
+		var l locationOrLink
+		if err := json.Unmarshal(raw, &l); err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+
+	locs := make([]Location, len(list))
+	for i, l := range list {
+		if len(l.TargetURI) != 0 {
+			locs[i] = Location{URI: l.TargetURI, Range: l.TargetSelectionRange}
+		} else {
+			locs[i] = l.Location
+		}
+	}
+	return locs, nil
+}
+
+// parseHover returns the text of a hover result. Its contents may be a
+// MarkupContent, a MarkedString or a list of MarkedStrings, where a
+// MarkedString is either a string or an object with a value.
+func parseHover(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var hover struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &hover); err != nil {
+		return "", err
+	}
+
+	var parts []json.RawMessage
+	if len(hover.Contents) != 0 && hover.Contents[0] == '[' {
+		if err := json.Unmarshal(hover.Contents, &parts); err != nil {
+			return "", err
+		}
+	} else {
+		parts = []json.RawMessage{hover.Contents}
+	}
+
+	var texts []string
+	for _, p := range parts {
+		var s string
+		if err := json.Unmarshal(p, &s); err == nil {
+			texts = append(texts, s)
+			continue
+		}
+
+		var v struct {
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(p, &v); err != nil {
+			return "", err
+		}
+		texts = append(texts, v.Value)
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
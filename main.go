@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"codeberg.org/wlcsm/li/config"
 	"codeberg.org/wlcsm/li/core"
@@ -21,7 +22,14 @@ func run() error {
 		Config: core.DisplayConfig{
 			Tabstop: 8,
 		},
-		Keymap:    config.ProcessKey,
+		Keymap:       config.ProcessKey,
+		SwapInterval: 4 * time.Second,
+		Hooks:        config.Hooks,
+		IdleTime:     time.Second,
+		Mode:         config.CommandMode.String(),
+		SessionFile:  core.DefaultSessionFile(),
+		SyntaxLookup: config.SyntaxConf,
+		Colorscheme:  config.Colorscheme,
 	}
 
 	return core.NewEditor(conf, os.Args)